@@ -0,0 +1,365 @@
+package zim
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// illustrationKeyPrefix prefixes the keys of the illustrations, such as
+// "Illustration_48x48@1".
+const illustrationKeyPrefix = "Illustration_"
+
+// ArchiveMetadata is the parsed metadata of an archive.
+type ArchiveMetadata struct {
+	Name            string
+	Title           string
+	Description     string
+	LongDescription string
+	Creator         string
+	Publisher       string
+	Flavour         string
+	Source          string
+	Scraper         string
+	License         string
+	Relation        string
+
+	// Date is the publication date of the archive, the zero time if it is
+	// missing or is not formatted as YYYY-MM-DD.
+	Date time.Time
+	// Languages are the ISO 639-3 codes of the languages of the archive, by
+	// order of importance.
+	Languages []string
+	Tags      Tags
+	// Counter is the number of entries of the archive by mime type.
+	Counter MimeCounter
+	// Illustrations are the illustrations of the archive, ordered by size
+	// and scale.
+	Illustrations []Illustration
+
+	// Custom holds the metadata which are not mapped to a field.
+	Custom map[MetadataKey]string
+}
+
+// Illustration is a square PNG image illustrating an archive, such as its
+// favicon.
+type Illustration struct {
+	Key    MetadataKey
+	Width  int
+	Height int
+	Scale  int
+	Data   []byte
+}
+
+// IllustrationKey returns the metadata key of the illustration with the
+// given size and scale.
+func IllustrationKey(size int, scale int) MetadataKey {
+	return MetadataKey(fmt.Sprintf("%s%dx%d@%d", illustrationKeyPrefix, size, size, scale))
+}
+
+// ParseIllustrationKey returns the width, height and scale of the
+// illustration with the given metadata key, such as "Illustration_48x48@1".
+// ok is false if the key does not designate an illustration.
+func ParseIllustrationKey(key MetadataKey) (width int, height int, scale int, ok bool) {
+	spec, found := strings.CutPrefix(string(key), illustrationKeyPrefix)
+	if !found {
+		return 0, 0, 0, false
+	}
+
+	size, rawScale, found := strings.Cut(spec, "@")
+	if !found {
+		return 0, 0, 0, false
+	}
+
+	rawWidth, rawHeight, found := strings.Cut(size, "x")
+	if !found {
+		return 0, 0, 0, false
+	}
+
+	values := make([]int, 0, 3)
+
+	for _, raw := range []string{rawWidth, rawHeight, rawScale} {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			return 0, 0, 0, false
+		}
+
+		values = append(values, value)
+	}
+
+	return values[0], values[1], values[2], true
+}
+
+// ParseLanguages parses the comma separated ISO 639-3 codes of the
+// "Language" metadata.
+func ParseLanguages(value string) []string {
+	languages := make([]string, 0)
+
+	for _, lang := range strings.Split(value, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			languages = append(languages, lang)
+		}
+	}
+
+	return languages
+}
+
+// Tags is the set of tags of an archive. Tags of the form "_name:value",
+// such as "_category:wikipedia" or "_pictures:no", are properties of the
+// archive, see https://wiki.openzim.org/wiki/Tags.
+type Tags struct {
+	tags       []string
+	properties map[string]string
+}
+
+// ParseTags parses the semicolon separated tags of the "Tags" metadata.
+func ParseTags(value string) Tags {
+	tags := Tags{
+		tags:       make([]string, 0),
+		properties: make(map[string]string),
+	}
+
+	for _, tag := range strings.Split(value, ";") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		tags.tags = append(tags.tags, tag)
+
+		if property, found := strings.CutPrefix(tag, "_"); found {
+			name, value, _ := strings.Cut(property, ":")
+			tags.properties[name] = value
+		}
+	}
+
+	return tags
+}
+
+// List returns the tags, properties included, in their original order.
+func (t Tags) List() []string {
+	list := make([]string, len(t.tags))
+	copy(list, t.tags)
+
+	return list
+}
+
+// Has returns true if the set contains the given tag.
+func (t Tags) Has(tag string) bool {
+	for _, existing := range t.tags {
+		if existing == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Property returns the value of the "_name:value" tag with the given name.
+func (t Tags) Property(name string) (string, bool) {
+	value, exists := t.properties[name]
+	return value, exists
+}
+
+// Category returns the value of the "_category" property.
+func (t Tags) Category() string {
+	category, _ := t.Property("category")
+	return category
+}
+
+// HasPictures returns false if the archive is flagged as not having
+// pictures, with "_pictures:no" or the legacy "nopic" tag.
+func (t Tags) HasPictures() bool {
+	return t.hasContent("pictures", "nopic")
+}
+
+// HasVideos returns false if the archive is flagged as not having videos,
+// with "_videos:no" or the legacy "novid" tag.
+func (t Tags) HasVideos() bool {
+	return t.hasContent("videos", "novid")
+}
+
+// HasDetails returns false if the archive is flagged as only having the
+// introduction of the articles, with "_details:no" or the legacy "nodet"
+// tag.
+func (t Tags) HasDetails() bool {
+	return t.hasContent("details", "nodet")
+}
+
+// HasFullTextIndex returns true if the archive is flagged as embedding a
+// full-text index, with "_ftindex:yes" or the legacy "_ftindex" tag.
+func (t Tags) HasFullTextIndex() bool {
+	value, exists := t.Property("ftindex")
+	return exists && value != "no"
+}
+
+func (t Tags) hasContent(property string, legacyTag string) bool {
+	if value, exists := t.Property(property); exists {
+		return value != "no"
+	}
+
+	return !t.Has(legacyTag)
+}
+
+// MimeCounter is the number of entries of an archive by mime type.
+type MimeCounter map[string]uint64
+
+// ParseCounter parses the "Counter" metadata, such as
+// "text/html=143;image/png=1". Mime types may have parameters, themselves
+// separated by semicolons. Malformed items are ignored.
+func ParseCounter(value string) MimeCounter {
+	counter := make(MimeCounter)
+	mimeType := ""
+
+	for _, part := range strings.Split(value, ";") {
+		idx := strings.LastIndex(part, "=")
+		if idx == -1 {
+			mimeType += part + ";"
+			continue
+		}
+
+		count, err := strconv.ParseUint(part[idx+1:], 10, 64)
+		if err != nil {
+			// Parameter of the mime type
+			mimeType += part + ";"
+			continue
+		}
+
+		mimeType = strings.TrimSpace(mimeType + part[:idx])
+		counter[mimeType] += count
+		mimeType = ""
+	}
+
+	return counter
+}
+
+// ArticleCount returns the number of HTML entries.
+func (c MimeCounter) ArticleCount() uint64 {
+	return c.count(func(mediaType string) bool {
+		return mediaType == "text/html"
+	})
+}
+
+// MediaCount returns the number of image, audio and video entries.
+func (c MimeCounter) MediaCount() uint64 {
+	return c.count(func(mediaType string) bool {
+		return strings.HasPrefix(mediaType, "image/") ||
+			strings.HasPrefix(mediaType, "video/") ||
+			strings.HasPrefix(mediaType, "audio/")
+	})
+}
+
+func (c MimeCounter) count(match func(mediaType string) bool) uint64 {
+	total := uint64(0)
+
+	for mimeType, count := range c {
+		mediaType, _, _ := strings.Cut(mimeType, ";")
+
+		if match(strings.TrimSpace(mediaType)) {
+			total += count
+		}
+	}
+
+	return total
+}
+
+// ArchiveMetadata returns the parsed metadata of the archive.
+func (r *Reader) ArchiveMetadata() (*ArchiveMetadata, error) {
+	return r.ArchiveMetadataContext(context.Background())
+}
+
+// ArchiveMetadataContext is like ArchiveMetadata but stops on the
+// cancellation of the given context.
+func (r *Reader) ArchiveMetadataContext(ctx context.Context) (*ArchiveMetadata, error) {
+	raw, err := r.AllMetadataContext(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	metadata := &ArchiveMetadata{
+		Languages:     make([]string, 0),
+		Tags:          ParseTags(""),
+		Counter:       make(MimeCounter),
+		Illustrations: make([]Illustration, 0),
+		Custom:        make(map[MetadataKey]string),
+	}
+
+	fields := map[MetadataKey]*string{
+		MetadataName:            &metadata.Name,
+		MetadataTitle:           &metadata.Title,
+		MetadataDescription:     &metadata.Description,
+		MetadataLongDescription: &metadata.LongDescription,
+		MetadataCreator:         &metadata.Creator,
+		MetadataPublisher:       &metadata.Publisher,
+		MetadataFlavour:         &metadata.Flavour,
+		MetadataSource:          &metadata.Source,
+		MetadataScraper:         &metadata.Scraper,
+		MetadataLicense:         &metadata.License,
+		MetadataRelation:        &metadata.Relation,
+	}
+
+	for key, value := range raw {
+		if field, exists := fields[key]; exists {
+			*field = value
+			continue
+		}
+
+		switch key {
+		case MetadataDate:
+			if date, err := time.Parse(time.DateOnly, strings.TrimSpace(value)); err == nil {
+				metadata.Date = date
+			}
+
+		case MetadataLanguage:
+			metadata.Languages = ParseLanguages(value)
+
+		case MetadataTags:
+			metadata.Tags = ParseTags(value)
+
+		case MetadataCounter:
+			metadata.Counter = ParseCounter(value)
+
+		default:
+			if width, height, scale, ok := ParseIllustrationKey(key); ok {
+				metadata.Illustrations = append(metadata.Illustrations, Illustration{
+					Key:    key,
+					Width:  width,
+					Height: height,
+					Scale:  scale,
+					Data:   []byte(value),
+				})
+
+				continue
+			}
+
+			metadata.Custom[key] = value
+		}
+	}
+
+	sort.Slice(metadata.Illustrations, func(i, j int) bool {
+		a, b := metadata.Illustrations[i], metadata.Illustrations[j]
+		if a.Width != b.Width {
+			return a.Width < b.Width
+		}
+
+		return a.Scale < b.Scale
+	})
+
+	return metadata, nil
+}
+
+// Illustration returns the illustration with the given size and scale.
+func (m *ArchiveMetadata) Illustration(size int, scale int) (*Illustration, bool) {
+	for i, illustration := range m.Illustrations {
+		if illustration.Width == size && illustration.Height == size && illustration.Scale == scale {
+			return &m.Illustrations[i], true
+		}
+	}
+
+	return nil, false
+}
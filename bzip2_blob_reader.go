@@ -0,0 +1,20 @@
+package zim
+
+import (
+	"compress/bzip2"
+	"io"
+)
+
+func init() {
+	RegisterDecoder(CompressionBZip2, BZip2Decoder)
+}
+
+// BZip2Decoder is the default ClusterDecoderFactory for bzip2 compressed
+// clusters.
+func BZip2Decoder(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(r)), nil
+}
+
+func NewBZip2BlobReader(reader *Reader, clusterStartOffset, clusterEndOffset uint64, blobIndex uint32, blobSize int) *CompressedBlobReader {
+	return newCompressedBlobReader(reader, BZip2Decoder, clusterStartOffset, clusterEndOffset, blobIndex, blobSize)
+}
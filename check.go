@@ -0,0 +1,417 @@
+package zim
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const headerSize = 80
+
+// maxRedirectDepth is the maximum number of redirects followed when
+// resolving or checking redirect chains, protecting against redirect loops.
+const maxRedirectDepth = 32
+
+type ProblemKind string
+
+const (
+	ProblemInvalidHeader         ProblemKind = "invalid-header"
+	ProblemInvalidEntryPointer   ProblemKind = "invalid-entry-pointer"
+	ProblemInvalidEntry          ProblemKind = "invalid-entry"
+	ProblemUnsortedEntries       ProblemKind = "unsorted-entries"
+	ProblemInvalidMimeType       ProblemKind = "invalid-mime-type"
+	ProblemInvalidRedirect       ProblemKind = "invalid-redirect"
+	ProblemInvalidTitlePointer   ProblemKind = "invalid-title-pointer"
+	ProblemUnsortedTitles        ProblemKind = "unsorted-titles"
+	ProblemInvalidClusterPointer ProblemKind = "invalid-cluster-pointer"
+	ProblemInvalidCluster        ProblemKind = "invalid-cluster"
+	ProblemInvalidBlob           ProblemKind = "invalid-blob"
+)
+
+// Problem is a structural inconsistency found by Reader.Check().
+type Problem struct {
+	Kind ProblemKind
+	// Index is the index of the entry, title or cluster concerned by the
+	// problem, or -1 if the problem concerns the archive as a whole.
+	Index   int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Index < 0 {
+		return fmt.Sprintf("%s: %s", p.Kind, p.Message)
+	}
+
+	return fmt.Sprintf("%s [%d]: %s", p.Kind, p.Index, p.Message)
+}
+
+// Check validates the structure of the archive: header positions, URL,
+// title and cluster pointers, mime type indexes, redirect targets and blob
+// boundaries. Each cluster is decompressed once, without keeping its
+// content in memory.
+//
+// The returned problems describe the inconsistencies found, an error is
+// only returned if the archive could not be read or if the context is done.
+func (r *Reader) Check(ctx context.Context) ([]Problem, error) {
+	checker := &archiveChecker{
+		reader: r,
+		ctx:    ctx,
+	}
+
+	steps := []func() error{
+		checker.checkHeader,
+		checker.checkClusters,
+		checker.checkEntries,
+		checker.checkTitles,
+	}
+
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return checker.problems, nil
+}
+
+type archiveChecker struct {
+	reader   *Reader
+	ctx      context.Context
+	problems []Problem
+
+	// blobCounts holds the number of blobs of each cluster, or -1 if the
+	// cluster could not be read.
+	blobCounts []int
+}
+
+func (c *archiveChecker) report(kind ProblemKind, index int, format string, args ...any) {
+	c.problems = append(c.problems, Problem{
+		Kind:    kind,
+		Index:   index,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *archiveChecker) checkHeader() error {
+	r := c.reader
+
+	if r.mimeListPos < headerSize {
+		c.report(ProblemInvalidHeader, -1, "mime list position '%d' overlaps the header", r.mimeListPos)
+	}
+
+	positions := map[string]uint64{
+		"mime list":            r.mimeListPos,
+		"URL pointer list":     r.urlPtrPos,
+		"cluster pointer list": r.clusterPtrPos,
+	}
+
+	if r.titlePtrPos != 0 && r.titlePtrPos != noTitlePtrPos {
+		positions["title pointer list"] = r.titlePtrPos
+	}
+
+	for name, pos := range positions {
+		if pos >= r.checksumPos {
+			c.report(ProblemInvalidHeader, -1, "%s position '%d' is beyond checksum position '%d'", name, pos, r.checksumPos)
+		}
+	}
+
+	if r.mainPage != 0xffffffff && r.mainPage >= r.entryCount {
+		c.report(ProblemInvalidHeader, -1, "main page index '%d' out of bounds", r.mainPage)
+	}
+
+	if r.layoutPage != 0xffffffff && r.layoutPage >= r.entryCount {
+		c.report(ProblemInvalidHeader, -1, "layout page index '%d' out of bounds", r.layoutPage)
+	}
+
+	return nil
+}
+
+func (c *archiveChecker) checkClusters() error {
+	r := c.reader
+
+	c.blobCounts = make([]int, r.clusterCount)
+
+	for idx := 0; idx < int(r.clusterCount); idx++ {
+		if err := c.ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		c.blobCounts[idx] = -1
+
+		start, next := r.clusterIndex[idx], r.clusterIndex[idx+1]
+
+		if start < headerSize || start >= r.checksumPos {
+			c.report(ProblemInvalidClusterPointer, idx, "cluster position '%d' out of bounds", start)
+			continue
+		}
+
+		if next <= start {
+			c.report(ProblemInvalidClusterPointer, idx, "cluster position '%d' is not before next cluster position '%d'", start, next)
+			continue
+		}
+
+		blobCount, err := c.checkCluster(idx, start, next)
+		if err != nil {
+			if ctxErr := c.ctx.Err(); ctxErr != nil {
+				return errors.WithStack(ctxErr)
+			}
+
+			c.report(ProblemInvalidCluster, idx, "%s", err)
+			continue
+		}
+
+		c.blobCounts[idx] = blobCount
+	}
+
+	return nil
+}
+
+// checkCluster validates the blob offsets of the given cluster and returns
+// its number of blobs.
+func (c *archiveChecker) checkCluster(idx int, start, next uint64) (int, error) {
+	r := c.reader
+
+	header := make([]byte, 1)
+	if err := r.readRange(int64(start), header); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	compression := Compression((header[0] << 4) >> 4)
+	extended := (header[0]<<3)>>7 == 1
+
+	blobSize := uint64(4)
+	if extended {
+		blobSize = 8
+	}
+
+	// The cluster is read through the context, decompressing a large one
+	// may take a while
+	var data io.Reader = &contextReader{
+		ctx:    c.ctx,
+		reader: io.NewSectionReader(r.reader, int64(start+1), int64(next-start-1)),
+	}
+
+	if compression != CompressionNone && compression != CompressionNoneZeno {
+		decoderFactory, err := r.decoder(compression)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		decoder, err := decoderFactory(bufio.NewReader(data))
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		defer decoder.Close()
+
+		data = decoder
+	}
+
+	buffered := bufio.NewReader(data)
+
+	readOffset := func() (uint64, error) {
+		raw := make([]byte, blobSize)
+		if _, err := io.ReadFull(buffered, raw); err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		if extended {
+			return binary.LittleEndian.Uint64(raw), nil
+		}
+
+		return uint64(binary.LittleEndian.Uint32(raw)), nil
+	}
+
+	first, err := readOffset()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not read first blob offset")
+	}
+
+	if first%blobSize != 0 || first < blobSize {
+		return 0, errors.Errorf("invalid first blob offset '%d'", first)
+	}
+
+	offsetCount := first / blobSize
+	previous := first
+
+	for i := uint64(1); i < offsetCount; i++ {
+		offset, err := readOffset()
+		if err != nil {
+			return 0, errors.Wrapf(err, "could not read blob offset '%d'", i)
+		}
+
+		if offset < previous {
+			c.report(ProblemInvalidBlob, idx, "blob '%d' ends at '%d' before it starts at '%d'", i-1, offset, previous)
+		}
+
+		previous = offset
+	}
+
+	remaining, err := io.Copy(io.Discard, buffered)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not read cluster data")
+	}
+
+	if size := first + uint64(remaining); previous > size {
+		c.report(ProblemInvalidBlob, idx, "last blob ends at '%d', beyond cluster data size '%d'", previous, size)
+	}
+
+	return int(offsetCount - 1), nil
+}
+
+func (c *archiveChecker) checkEntries() error {
+	r := c.reader
+
+	var previous Entry
+
+	for idx, ptr := range r.urlIndex {
+		if err := c.ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if ptr < headerSize || ptr >= r.checksumPos {
+			c.report(ProblemInvalidEntryPointer, idx, "entry position '%d' out of bounds", ptr)
+			continue
+		}
+
+		base, err := r.parseBaseEntry(int64(ptr))
+		if err != nil {
+			c.report(ProblemInvalidEntry, idx, "%s", err)
+			continue
+		}
+
+		if base.mimeTypeIndex != zimRedirect && int(base.mimeTypeIndex) >= len(r.mimeTypes) {
+			c.report(ProblemInvalidMimeType, idx, "mime type index '%d' out of bounds", base.mimeTypeIndex)
+			continue
+		}
+
+		entry, err := r.parseEntryAt(int(idx), int64(ptr))
+		if err != nil {
+			c.report(ProblemInvalidEntry, idx, "%s", err)
+			continue
+		}
+
+		if previous != nil && compareURL(previous.Namespace(), previous.URL(), entry.Namespace(), entry.URL()) >= 0 {
+			c.report(ProblemUnsortedEntries, idx, "entry '%s' is not after entry '%s'", entry.FullURL(), previous.FullURL())
+		}
+
+		previous = entry
+
+		switch typed := entry.(type) {
+		case *ContentEntry:
+			c.checkContentEntry(idx, typed)
+		case *RedirectEntry:
+			if err := c.checkRedirectEntry(idx, typed); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *archiveChecker) checkContentEntry(idx int, entry *ContentEntry) {
+	if entry.clusterIndex >= c.reader.clusterCount {
+		c.report(ProblemInvalidBlob, idx, "cluster index '%d' out of bounds for entry '%s'", entry.clusterIndex, entry.FullURL())
+		return
+	}
+
+	blobCount := c.blobCounts[entry.clusterIndex]
+	if blobCount < 0 {
+		return
+	}
+
+	if int(entry.blobIndex) >= blobCount {
+		c.report(ProblemInvalidBlob, idx, "blob index '%d' out of bounds for entry '%s' in cluster '%d' with '%d' blobs", entry.blobIndex, entry.FullURL(), entry.clusterIndex, blobCount)
+	}
+}
+
+func (c *archiveChecker) checkRedirectEntry(idx int, entry *RedirectEntry) error {
+	r := c.reader
+	visited := map[uint32]struct{}{uint32(idx): {}}
+	current := entry
+
+	for depth := 0; depth < maxRedirectDepth; depth++ {
+		if current.redirectIndex >= r.entryCount {
+			c.report(ProblemInvalidRedirect, idx, "redirect target index '%d' out of bounds for entry '%s'", current.redirectIndex, entry.FullURL())
+			return nil
+		}
+
+		if _, exists := visited[current.redirectIndex]; exists {
+			c.report(ProblemInvalidRedirect, idx, "redirect loop detected for entry '%s'", entry.FullURL())
+			return nil
+		}
+
+		visited[current.redirectIndex] = struct{}{}
+
+		ptr := r.urlIndex[current.redirectIndex]
+		if ptr < headerSize || ptr >= r.checksumPos {
+			// Already reported as an invalid entry pointer
+			return nil
+		}
+
+		target, err := r.parseEntryAt(int(current.redirectIndex), int64(ptr))
+		if err != nil {
+			// Already reported as an invalid entry
+			return nil
+		}
+
+		next, ok := target.(*RedirectEntry)
+		if !ok {
+			return nil
+		}
+
+		current = next
+	}
+
+	c.report(ProblemInvalidRedirect, idx, "redirect chain of entry '%s' exceeds '%d' redirects", entry.FullURL(), maxRedirectDepth)
+
+	return nil
+}
+
+func (c *archiveChecker) checkTitles() error {
+	r := c.reader
+
+	if r.titleIndex == nil {
+		return nil
+	}
+
+	if len(r.titleIndex) != int(r.entryCount) {
+		c.report(ProblemInvalidTitlePointer, -1, "title index has '%d' entries, expected '%d'", len(r.titleIndex), r.entryCount)
+	}
+
+	var previous Entry
+
+	for pos, idx := range r.titleIndex {
+		if err := c.ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if idx >= r.entryCount {
+			c.report(ProblemInvalidTitlePointer, pos, "entry index '%d' out of bounds", idx)
+			continue
+		}
+
+		ptr := r.urlIndex[idx]
+		if ptr < headerSize || ptr >= r.checksumPos {
+			continue
+		}
+
+		entry, err := r.parseEntryAt(int(idx), int64(ptr))
+		if err != nil {
+			continue
+		}
+
+		if previous != nil && compareURL(previous.Namespace(), previous.Title(), entry.Namespace(), entry.Title()) > 0 {
+			c.report(ProblemUnsortedTitles, pos, "entry '%s' is not after entry '%s' in title order", entry.FullURL(), previous.FullURL())
+		}
+
+		previous = entry
+	}
+
+	return nil
+}
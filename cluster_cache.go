@@ -0,0 +1,201 @@
+package zim
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/pkg/errors"
+)
+
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// ClusterCacheStats returns the hit and miss counters of the
+// decompressed cluster cache shared by the blob readers.
+func (r *Reader) ClusterCacheStats() CacheStats {
+	return CacheStats{
+		Hits:   r.clusterCacheHits.Load(),
+		Misses: r.clusterCacheMisses.Load(),
+	}
+}
+
+// clusterCache is a LRU cache of decompressed clusters, by start offset,
+// bounded both by its number of clusters and by their total size.
+type clusterCache struct {
+	mutex   sync.Mutex
+	cache   *lru.Cache[uint64, []byte]
+	size    int64
+	maxSize int64
+}
+
+func newClusterCache(maxClusters int, maxSize int64) (*clusterCache, error) {
+	c := &clusterCache{maxSize: maxSize}
+
+	cache, err := lru.NewWithEvict(maxClusters, func(_ uint64, data []byte) {
+		c.size -= int64(len(data))
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	c.cache = cache
+
+	return c, nil
+}
+
+func (c *clusterCache) Get(clusterStartOffset uint64) ([]byte, bool) {
+	return c.cache.Get(clusterStartOffset)
+}
+
+func (c *clusterCache) Contains(clusterStartOffset uint64) bool {
+	return c.cache.Contains(clusterStartOffset)
+}
+
+// Add caches the given decompressed cluster, evicting the least recently
+// used ones until the cache fits in its maximum size. Clusters larger than
+// the maximum size are not cached.
+func (c *clusterCache) Add(clusterStartOffset uint64, data []byte) {
+	if int64(len(data)) > c.maxSize {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// The eviction callback updating the size is called synchronously by
+	// the cache, under the mutex.
+	if found, _ := c.cache.ContainsOrAdd(clusterStartOffset, data); found {
+		return
+	}
+
+	c.size += int64(len(data))
+
+	for c.size > c.maxSize {
+		if _, _, ok := c.cache.RemoveOldest(); !ok {
+			break
+		}
+	}
+}
+
+// clusterLoad is a decompression of a cluster, shared by the readers
+// requesting the cluster while it is in progress.
+type clusterLoad struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// loadCluster returns the decompressed data of the cluster at the given
+// offsets, using the shared cluster cache if it is enabled. Clusters are
+// identified by their start offset. Concurrent loads of the same cluster are
+// decompressed only once. The returned slice must not be modified.
+func (r *Reader) loadCluster(ctx context.Context, clusterStartOffset, clusterEndOffset uint64, decoderFactory ClusterDecoderFactory) ([]byte, error) {
+	if r.clusterCache != nil {
+		if data, found := r.clusterCache.Get(clusterStartOffset); found {
+			r.clusterCacheHits.Add(1)
+			return data, nil
+		}
+
+		r.clusterCacheMisses.Add(1)
+	}
+
+	for {
+		r.clusterLoadsMutex.Lock()
+
+		load, exists := r.clusterLoads[clusterStartOffset]
+		if !exists {
+			break
+		}
+
+		r.clusterLoadsMutex.Unlock()
+
+		select {
+		case <-load.done:
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		}
+
+		// The decompression was interrupted by the context of another
+		// reader, try again with ours.
+		if isContextError(load.err) && ctx.Err() == nil {
+			continue
+		}
+
+		return load.data, load.err
+	}
+
+	if r.clusterLoads == nil {
+		r.clusterLoads = make(map[uint64]*clusterLoad)
+	}
+
+	load := &clusterLoad{done: make(chan struct{})}
+	r.clusterLoads[clusterStartOffset] = load
+
+	r.clusterLoadsMutex.Unlock()
+
+	load.data, load.err = r.decompressCluster(ctx, clusterStartOffset, clusterEndOffset, decoderFactory)
+	if load.err == nil && r.clusterCache != nil {
+		r.clusterCache.Add(clusterStartOffset, load.data)
+	}
+
+	r.clusterLoadsMutex.Lock()
+	delete(r.clusterLoads, clusterStartOffset)
+	r.clusterLoadsMutex.Unlock()
+
+	close(load.done)
+
+	return load.data, load.err
+}
+
+func (r *Reader) decompressCluster(ctx context.Context, clusterStartOffset, clusterEndOffset uint64, decoderFactory ClusterDecoderFactory) ([]byte, error) {
+	compressed := io.NewSectionReader(r.reader, int64(clusterStartOffset+1), int64(clusterEndOffset-clusterStartOffset))
+
+	decoder, err := decoderFactory(bufio.NewReader(&contextReader{ctx: ctx, reader: compressed}))
+	if err != nil {
+		return nil, errors.WithStack(contextErrorOr(ctx, err))
+	}
+
+	defer decoder.Close()
+
+	data, err := io.ReadAll(decoder)
+	if err != nil {
+		return nil, errors.WithStack(contextErrorOr(ctx, err))
+	}
+
+	return data, nil
+}
+
+// cachedCluster returns the decompressed data of the cluster starting at the
+// given offset if it is available in the cluster cache.
+func (r *Reader) cachedCluster(clusterStartOffset uint64) ([]byte, bool) {
+	if r.clusterCache == nil {
+		return nil, false
+	}
+
+	data, found := r.clusterCache.Get(clusterStartOffset)
+	if found {
+		r.clusterCacheHits.Add(1)
+	}
+
+	return data, found
+}
+
+// shouldStreamCluster returns true if the blobs of the cluster starting at
+// the given offset should be decoded on the fly instead of decompressing the
+// whole cluster in memory.
+func (r *Reader) shouldStreamCluster(clusterStartOffset uint64, compressedSize uint64) bool {
+	if r.streamingThreshold < 0 || compressedSize <= uint64(r.streamingThreshold) {
+		return false
+	}
+
+	if r.clusterCache != nil && r.clusterCache.Contains(clusterStartOffset) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"gitlab.com/wpetit/goweb/logger"
+)
+
+// minCompressSize is the size under which responses of known length are
+// not worth compressing.
+const minCompressSize = 1024
+
+const (
+	encodingZstd = "zstd"
+	encodingGzip = "gzip"
+)
+
+// encodings are the supported content encodings, by order of preference.
+var encodings = []string{encodingZstd, encodingGzip}
+
+type resettableWriteCloser interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	encodingGzip: {
+		New: func() any {
+			return gzip.NewWriter(io.Discard)
+		},
+	},
+	encodingZstd: {
+		New: func() any {
+			encoder, err := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				panic(errors.WithStack(err))
+			}
+
+			return encoder
+		},
+	},
+}
+
+// compressHandler compresses the responses of the given handler with the
+// encoding preferred by the client.
+func compressHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method != http.MethodGet || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+		}
+
+		defer func() {
+			if err := cw.Close(); err != nil {
+				// The client is most likely gone
+				logger.Debug(r.Context(), "could not close encoder", logger.E(errors.WithStack(err)))
+			}
+		}()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding returns the supported encoding with the highest quality
+// value in the given Accept-Encoding header, or an empty string if none is
+// acceptable.
+func negotiateEncoding(header string) string {
+	qualities := make(map[string]float64)
+
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if coding == "" {
+			continue
+		}
+
+		quality := 1.0
+
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+
+			quality = parsed
+		}
+
+		qualities[strings.ToLower(coding)] = quality
+	}
+
+	best, bestQuality := "", 0.0
+
+	for _, encoding := range encodings {
+		quality, exists := qualities[encoding]
+		if !exists {
+			quality, exists = qualities["*"]
+		}
+
+		if exists && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
+
+// isCompressible returns true if the given content type designates a
+// textual format.
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml", "image/svg+xml":
+		return true
+	}
+
+	return strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json")
+}
+
+// compressWriter decides whether to compress the response when its header
+// is written.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	encoder     resettableWriteCloser
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.wroteHeader = true
+
+	if w.shouldCompress(status) {
+		header := w.Header()
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+
+		// The compressed representation differs from the identity one
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		w.encoder = encoderPools[w.encoding].Get().(resettableWriteCloser)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) shouldCompress(status int) bool {
+	if status != http.StatusOK {
+		return false
+	}
+
+	header := w.Header()
+
+	if header.Get("Content-Encoding") != "" || !isCompressible(header.Get("Content-Type")) {
+		return false
+	}
+
+	if length := header.Get("Content-Length"); length != "" {
+		size, err := strconv.ParseInt(length, 10, 64)
+		if err == nil && size < minCompressSize {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(data)
+	}
+
+	return w.encoder.Write(data)
+}
+
+func (w *compressWriter) Flush() {
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+
+	return hijacker.Hijack()
+}
+
+// Close flushes the encoder, if any, and returns it to its pool.
+func (w *compressWriter) Close() error {
+	if w.encoder == nil {
+		return nil
+	}
+
+	encoder := w.encoder
+	w.encoder = nil
+
+	err := encoder.Close()
+
+	encoder.Reset(io.Discard)
+	encoderPools[w.encoding].Put(encoder)
+
+	return errors.WithStack(err)
+}
+
+var (
+	_ http.Flusher  = &compressWriter{}
+	_ http.Hijacker = &compressWriter{}
+)
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Bornholm/go-zim"
+	zimFS "github.com/Bornholm/go-zim/fs"
+	"github.com/Bornholm/go-zim/index"
+	zimLibrary "github.com/Bornholm/go-zim/library"
+	"github.com/pkg/errors"
+	"gitlab.com/wpetit/goweb/logger"
+)
+
+// archive is an archive of the library served under /content/<name>/.
+type archive struct {
+	Name string
+	Book *zimLibrary.Book
+}
+
+// Title returns the title of the archive, or its name if it has none.
+func (a *archive) Title() string {
+	if a.Book.Title != "" {
+		return a.Book.Title
+	}
+
+	return a.Name
+}
+
+// library serves the archives of a zim.Library. Its catalog and the names
+// of its archives follow the refreshes of the zim.Library, as synchronized
+// by Sync().
+type library struct {
+	archives *zim.Library
+	catalog  *zimLibrary.Catalog
+	indexDir string
+	// file is the library.xml file kept in sync with the catalog, if any.
+	file string
+
+	mutex  sync.RWMutex
+	synced []zim.LibraryArchive
+	list   []*archive
+	byName map[string]*archive
+	// listed are the books of the library.xml file, as last loaded or
+	// written.
+	listed []*zimLibrary.Book
+
+	indexMutex sync.Mutex
+	// indexes are the side-car indexes by archive UUID, nil for the
+	// archives without index.
+	indexes map[string]*index.Index
+}
+
+// Archives returns the archives of the library, ordered by name.
+func (l *library) Archives() []*archive {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return l.list
+}
+
+// Catalog returns the catalog of the archives of the library.
+func (l *library) Catalog() *zimLibrary.Catalog {
+	return l.catalog
+}
+
+// Archive returns the archive with the given name.
+func (l *library) Archive(name string) (*archive, bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	archive, exists := l.byName[name]
+
+	return archive, exists
+}
+
+// Open returns a reader of the given archive, to be closed once done.
+func (l *library) Open(a *archive) (*zim.LibraryReader, error) {
+	reader, err := l.archives.OpenByUUID(a.Book.ID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return reader, nil
+}
+
+// handlerKey is the key of the content handlers stored with the readers of
+// the zim.Library, by archive name.
+type handlerKey string
+
+// Handler returns the handler serving the entries of the given reader of
+// the named archive. Handlers are built once per reader of the zim.Library,
+// keeping their caches between requests.
+func (l *library) Handler(name string, reader *zim.LibraryReader) http.Handler {
+	return reader.Value(handlerKey(name), func(r *zim.Reader) any {
+		return zimFS.NewHandler(
+			zimFS.New(r),
+			zimFS.WithBasePath(contentPath(name)),
+		)
+	}).(http.Handler)
+}
+
+// Search runs the given query against the full-text index embedded in the
+// archive, or against its side-car index if it has none. ErrNotFound is
+// returned if the archive is not indexed at all.
+func (l *library) Search(ctx context.Context, reader *zim.LibraryReader, query string, funcs ...zim.SearchOptionFunc) (*zim.SearchResults, error) {
+	results, err := reader.Search(ctx, query, funcs...)
+	if err == nil {
+		return results, nil
+	}
+
+	if !errors.Is(err, zim.ErrNotFound) {
+		return nil, errors.WithStack(err)
+	}
+
+	idx, err := l.index(ctx, reader.UUID())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if idx == nil {
+		return nil, errors.WithStack(zim.ErrNotFound)
+	}
+
+	results, err = idx.Search(ctx, reader.Reader, query, funcs...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return results, nil
+}
+
+// index returns the side-car index of the archive with the given UUID, nil
+// if it has none. Indexes are opened on first use.
+func (l *library) index(ctx context.Context, uuid string) (*index.Index, error) {
+	if l.indexDir == "" {
+		return nil, nil
+	}
+
+	l.indexMutex.Lock()
+	defer l.indexMutex.Unlock()
+
+	if idx, exists := l.indexes[uuid]; exists {
+		return idx, nil
+	}
+
+	idx, err := index.OpenFor(l.indexDir, uuid)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.WithStack(err)
+	}
+
+	if idx != nil {
+		logger.Info(ctx, "using side-car index", logger.F("uuid", uuid), logger.F("documents", idx.DocumentCount()))
+	}
+
+	l.indexes[uuid] = idx
+
+	return idx, nil
+}
+
+// Sync updates the catalog, the names of the archives and the library.xml
+// file if the archives of the zim.Library changed since the last call.
+func (l *library) Sync(ctx context.Context) error {
+	archives := l.archives.Archives()
+
+	l.mutex.RLock()
+	unchanged := slices.Equal(archives, l.synced)
+	l.mutex.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// The archives may have been synchronized concurrently
+	if slices.Equal(archives, l.synced) {
+		return nil
+	}
+
+	if err := l.catalog.Sync(ctx, l.archives); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if l.file != "" {
+		if err := l.syncLibraryFile(ctx); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	list := make([]*archive, 0)
+	byName := make(map[string]*archive)
+
+	for _, b := range l.catalog.Books() {
+		name := b.ContentName()
+
+		if _, exists := byName[name]; exists {
+			logger.Warn(ctx, "duplicate archive name", logger.F("name", name), logger.F("path", b.Path))
+			continue
+		}
+
+		a := &archive{Name: name, Book: b}
+
+		list = append(list, a)
+		byName[name] = a
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	l.synced = archives
+	l.list = list
+	l.byName = byName
+
+	return nil
+}
+
+// Watch refreshes the archives of the library at the given interval, until
+// the given context is done.
+func (l *library) Watch(ctx context.Context, interval time.Duration) {
+	l.archives.Watch(ctx, interval)
+}
+
+func (l *library) Close() error {
+	var firstErr error
+
+	l.indexMutex.Lock()
+	defer l.indexMutex.Unlock()
+
+	for _, idx := range l.indexes {
+		if idx == nil {
+			continue
+		}
+
+		if err := idx.Close(); err != nil && firstErr == nil {
+			firstErr = errors.WithStack(err)
+		}
+	}
+
+	if err := l.archives.Close(); err != nil && firstErr == nil {
+		firstErr = errors.WithStack(err)
+	}
+
+	return firstErr
+}
+
+// openLibrary opens the library of the archives at the given paths, each
+// path being either an archive or a directory of archives. Side-car indexes
+// are looked up in indexDir if it is not empty. The given library.xml file,
+// if not empty, is kept in sync with the archives, starting from its listed
+// books.
+func openLibrary(ctx context.Context, paths []string, indexDir string, file string, listed []*zimLibrary.Book) (*library, error) {
+	archives, err := zim.NewLibrary(paths)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	library := &library{
+		archives: archives,
+		catalog:  zimLibrary.NewCatalog(),
+		indexDir: indexDir,
+		file:     file,
+		listed:   listed,
+		list:     make([]*archive, 0),
+		byName:   make(map[string]*archive),
+		indexes:  make(map[string]*index.Index),
+	}
+
+	if err := library.Sync(ctx); err != nil {
+		library.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	return library, nil
+}
+
+// loadLibraryFile returns the books of the given library.xml file, nil if
+// it does not exist yet.
+func loadLibraryFile(path string) ([]*zimLibrary.Book, error) {
+	catalog, err := zimLibrary.Load(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	return catalog.Books(), nil
+}
+
+// syncLibraryFile writes the books of the catalog to the library.xml file
+// if they differ from the listed ones, as when archives were added or
+// replaced. The download URLs and indexes of the listed books are kept. The
+// mutex must be held.
+func (l *library) syncLibraryFile(ctx context.Context) error {
+	listedByID := make(map[string]*zimLibrary.Book, len(l.listed))
+	for _, b := range l.listed {
+		listedByID[b.ID] = b
+	}
+
+	catalogBooks := l.catalog.Books()
+	books := make([]*zimLibrary.Book, 0, len(catalogBooks))
+	changed := len(l.listed) != len(catalogBooks)
+
+	for _, b := range catalogBooks {
+		// Books of the catalog are shared with its readers, the listed
+		// fields are set on a copy
+		book := *b
+
+		previous, exists := listedByID[b.ID]
+		if exists {
+			book.URL = previous.URL
+			book.IndexPath = previous.IndexPath
+			book.IndexType = previous.IndexType
+		}
+
+		if !exists || !samePath(previous.Path, b.Path) || previous.Size/1024 != b.Size/1024 {
+			changed = true
+		}
+
+		books = append(books, &book)
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if err := zimLibrary.NewCatalog(books...).Save(l.file); err != nil {
+		return errors.WithStack(err)
+	}
+
+	l.listed = books
+
+	logger.Info(ctx, "library file updated", logger.F("path", l.file), logger.F("books", len(books)))
+
+	return nil
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+
+	return errA == nil && errB == nil && absA == absB
+}
+
+func contentPath(name string) string {
+	return "/content/" + name
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/wpetit/goweb/logger"
+)
+
+// logHandler logs a line for each request served by the given handler.
+func logHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		lw := &logWriter{ResponseWriter: w}
+
+		next.ServeHTTP(lw, r)
+
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+
+		logger.Info(
+			r.Context(), "http request",
+			logger.F("method", r.Method),
+			logger.F("path", r.URL.RequestURI()),
+			logger.F("status", lw.status),
+			logger.F("size", lw.size),
+			logger.F("duration", time.Since(start).String()),
+			logger.F("remoteAddr", r.RemoteAddr),
+			logger.F("userAgent", r.UserAgent()),
+		)
+	})
+}
+
+// logWriter records the status and the number of bytes of a response.
+type logWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *logWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	written, err := w.ResponseWriter.Write(data)
+	w.size += int64(written)
+
+	return written, err
+}
+
+func (w *logWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *logWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+
+	return hijacker.Hijack()
+}
+
+var (
+	_ http.Flusher  = &logWriter{}
+	_ http.Hijacker = &logWriter{}
+)
@@ -0,0 +1,162 @@
+// Command zim-server serves a library of ZIM archives over HTTP.
+//
+// Usage:
+//
+//	zim-server [flags] <archive or directory>...
+//
+// Each archive is served under /content/<name>/, name being its filename
+// without extension. The home page lists the archives of the library and
+// the /api/search and /api/suggest endpoints answer full-text and title
+// queries in JSON.
+//
+// Archives can also be listed in a Kiwix library.xml file with the -library
+// flag. The file is rewritten on startup if archives were added, replaced
+// or removed.
+//
+// The archives added, replaced or removed while the server runs are taken
+// into account every -refresh-interval.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	zimLibrary "github.com/Bornholm/go-zim/library"
+	"github.com/pkg/errors"
+	"gitlab.com/wpetit/goweb/logger"
+)
+
+var (
+	httpAddr        = ":8080"
+	indexDir        string
+	libraryFile     string
+	cacheMaxAge     = 24 * time.Hour
+	refreshInterval = time.Minute
+	shutdownTimeout = 30 * time.Second
+	debug           bool
+	logFormat       = string(logger.FormatHuman)
+)
+
+func init() {
+	flag.StringVar(&httpAddr, "addr", httpAddr, "http server address")
+	flag.StringVar(&indexDir, "index-dir", indexDir, "directory of the side-car full-text indexes")
+	flag.StringVar(&libraryFile, "library", libraryFile, "kiwix library.xml file listing the archives, updated when they change")
+	flag.DurationVar(&cacheMaxAge, "cache-max-age", cacheMaxAge, "max age of the archive entries in client caches")
+	flag.DurationVar(&refreshInterval, "refresh-interval", refreshInterval, "interval between two scans of the archives, 0 to disable")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", shutdownTimeout, "time given to the ongoing requests on shutdown")
+	flag.BoolVar(&debug, "debug", debug, "enable debug logs")
+	flag.StringVar(&logFormat, "log-format", logFormat, "log format, 'human' or 'json'")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <archive or directory>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() == 0 && libraryFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger.SetFormat(logger.Format(logFormat))
+
+	if debug {
+		logger.SetLevel(logger.LevelDebug)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, flag.Args()); err != nil {
+		logger.Error(ctx, "server failed", logger.E(err))
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, paths []string) error {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	var listed []*zimLibrary.Book
+
+	if libraryFile != "" {
+		books, err := loadLibraryFile(libraryFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, b := range books {
+			if b.Path == "" {
+				continue
+			}
+
+			if _, err := os.Stat(b.Path); errors.Is(err, os.ErrNotExist) {
+				logger.Warn(ctx, "archive of the library file is missing", logger.F("path", b.Path))
+				continue
+			}
+
+			paths = append(paths, b.Path)
+		}
+
+		listed = books
+	}
+
+	library, err := openLibrary(ctx, paths, indexDir, libraryFile, listed)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() {
+		if err := library.Close(); err != nil {
+			logger.Error(ctx, "could not close library", logger.E(err))
+		}
+	}()
+
+	logger.Info(ctx, "library opened", logger.F("archives", len(library.Archives())))
+
+	if refreshInterval > 0 {
+		go library.Watch(ctx, refreshInterval)
+	}
+
+	server := &http.Server{
+		Addr:              httpAddr,
+		Handler:           newServer(library, cacheMaxAge),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		logger.Info(ctx, "listening", logger.F("addr", httpAddr))
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return errors.WithStack(err)
+	case <-ctx.Done():
+	}
+
+	logger.Info(ctx, "shutting down", logger.F("timeout", shutdownTimeout.String()))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bornholm/go-zim"
+	zimFS "github.com/Bornholm/go-zim/fs"
+	zimLibrary "github.com/Bornholm/go-zim/library"
+	"github.com/pkg/errors"
+	"gitlab.com/wpetit/goweb/logger"
+)
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 100
+
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// server serves the archives of a library, its home page and its search
+// endpoints.
+type server struct {
+	library     *library
+	cacheMaxAge time.Duration
+	mux         *http.ServeMux
+}
+
+// newServer returns the handler of the given library. Archive entries are
+// cached by clients for cacheMaxAge.
+func newServer(library *library, cacheMaxAge time.Duration) http.Handler {
+	s := &server{
+		library:     library,
+		cacheMaxAge: cacheMaxAge,
+		mux:         http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/", s.serveHome)
+	s.mux.HandleFunc("/content/", s.serveContent)
+	s.mux.HandleFunc("/favicon/", s.serveFavicon)
+	s.mux.HandleFunc("/search", s.serveSearchPage)
+	s.mux.HandleFunc("/api/search", s.serveSearch)
+	s.mux.HandleFunc("/api/suggest", s.serveSuggest)
+	s.mux.Handle("/catalog/", zimLibrary.NewHandler(library.Catalog()))
+
+	return logHandler(compressHandler(s.syncHandler(s.mux)))
+}
+
+// syncHandler synchronizes the library with its archives before serving
+// the requests.
+func (s *server) syncHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.library.Sync(r.Context()); err != nil {
+			s.serveError(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type homeArchive struct {
+	Name         string
+	Title        string
+	Description  string
+	Language     string
+	Date         string
+	ArticleCount uint64
+	URL          string
+	FaviconURL   string
+}
+
+func (s *server) serveHome(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	archives := make([]homeArchive, 0, len(s.library.Archives()))
+
+	for _, a := range s.library.Archives() {
+		item := homeArchive{
+			Name:         a.Name,
+			Title:        a.Title(),
+			Description:  a.Book.Description,
+			Language:     strings.Join(a.Book.Languages, ","),
+			Date:         a.Book.Date,
+			ArticleCount: a.Book.ArticleCount,
+			URL:          contentPath(a.Name) + "/",
+		}
+
+		if a.Book.Favicon != nil {
+			item.FaviconURL = faviconPath(a.Name)
+		}
+
+		archives = append(archives, item)
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+
+	s.renderTemplate(w, r, "home.html", struct {
+		Archives []homeArchive
+	}{
+		Archives: archives,
+	})
+}
+
+func (s *server) serveContent(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/content/")
+	name, _, hasSlash := strings.Cut(rest, "/")
+
+	archive, exists := s.library.Archive(name)
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !hasSlash {
+		http.Redirect(w, r, contentPath(name)+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	reader, err := s.library.Open(archive)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+
+	defer reader.Close()
+
+	s.library.Handler(name, reader).ServeHTTP(s.cacheWriter(w), r)
+}
+
+func (s *server) serveFavicon(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/favicon/")
+
+	archive, exists := s.library.Archive(name)
+	if !exists || archive.Book.Favicon == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	reader, err := s.library.Open(archive)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+
+	defer reader.Close()
+
+	favicon, err := reader.Favicon()
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+
+	blob, err := favicon.ReaderContext(r.Context())
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+
+	defer blob.Close()
+
+	w = s.cacheWriter(w)
+
+	header := w.Header()
+	header.Set("ETag", zimFS.ETag(reader.Reader, favicon))
+
+	// Illustrations of the metadata namespace are not always given an image
+	// mime type, the content is sniffed instead
+	if mimeType := favicon.MimeType(); strings.HasPrefix(mimeType, "image/") {
+		header.Set("Content-Type", mimeType)
+	}
+
+	http.ServeContent(w, r, "", reader.ModTime(), blob)
+}
+
+type searchResult struct {
+	Title   string  `json:"title"`
+	URL     string  `json:"url"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet,omitempty"`
+}
+
+type searchResponse struct {
+	Total   int            `json:"total"`
+	Results []searchResult `json:"results"`
+}
+
+type searchRequest struct {
+	Archive *archive
+	Query   string
+	Offset  int
+	Limit   int
+}
+
+// parseSearchRequest reads the "content", "q", "offset" and "limit"
+// parameters of the given request, writing an error response and returning
+// false if they are invalid.
+func (s *server) parseSearchRequest(w http.ResponseWriter, r *http.Request, defaultLimit, maxLimit int) (*searchRequest, bool) {
+	query := r.URL.Query()
+
+	archive, exists := s.library.Archive(query.Get("content"))
+	if !exists {
+		http.Error(w, "unknown content", http.StatusNotFound)
+		return nil, false
+	}
+
+	offset, err := intParam(query, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return nil, false
+	}
+
+	limit, err := intParam(query, "limit", defaultLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &searchRequest{
+		Archive: archive,
+		Query:   query.Get("q"),
+		Offset:  offset,
+		Limit:   min(limit, maxLimit),
+	}, true
+}
+
+func (s *server) search(ctx context.Context, req *searchRequest) (*searchResponse, error) {
+	reader, err := s.library.Open(req.Archive)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer reader.Close()
+
+	results, err := s.library.Search(ctx, reader, req.Query, zim.WithSearchOffset(req.Offset), zim.WithSearchLimit(req.Limit))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	response := &searchResponse{
+		Total:   results.Total,
+		Results: make([]searchResult, 0, len(results.Results)),
+	}
+
+	for _, result := range results.Results {
+		response.Results = append(response.Results, searchResult{
+			Title:   result.Entry.Title(),
+			URL:     entryPath(req.Archive.Name, result.Entry),
+			Score:   result.Score,
+			Snippet: result.Snippet,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *server) serveSearch(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.parseSearchRequest(w, r, defaultSearchLimit, maxSearchLimit)
+	if !ok {
+		return
+	}
+
+	response, err := s.search(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, zim.ErrNotFound) {
+			http.Error(w, "content is not searchable", http.StatusNotFound)
+			return
+		}
+
+		s.serveError(w, r, err)
+		return
+	}
+
+	s.renderJSON(w, r, response)
+}
+
+type suggestion struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+func (s *server) serveSuggest(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.parseSearchRequest(w, r, defaultSuggestLimit, maxSuggestLimit)
+	if !ok {
+		return
+	}
+
+	reader, err := s.library.Open(req.Archive)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+
+	defer reader.Close()
+
+	suggestions, err := reader.SuggestTitles(r.Context(), req.Query, req.Limit)
+	if err != nil {
+		if errors.Is(err, zim.ErrNotFound) {
+			http.Error(w, "content has no title index", http.StatusNotFound)
+			return
+		}
+
+		s.serveError(w, r, err)
+		return
+	}
+
+	response := make([]suggestion, 0, len(suggestions))
+
+	for _, sg := range suggestions {
+		response = append(response, suggestion{
+			Title: sg.Title,
+			URL:   entryPath(req.Archive.Name, sg.Entry),
+		})
+	}
+
+	s.renderJSON(w, r, response)
+}
+
+func (s *server) serveSearchPage(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.parseSearchRequest(w, r, defaultSearchLimit, maxSearchLimit)
+	if !ok {
+		return
+	}
+
+	data := struct {
+		Archive    *archive
+		Query      string
+		Response   *searchResponse
+		Searchable bool
+		PrevURL    string
+		NextURL    string
+	}{
+		Archive:    req.Archive,
+		Query:      req.Query,
+		Searchable: true,
+	}
+
+	response, err := s.search(r.Context(), req)
+	switch {
+	case errors.Is(err, zim.ErrNotFound):
+		data.Searchable = false
+	case err != nil:
+		s.serveError(w, r, err)
+		return
+	default:
+		data.Response = response
+
+		if req.Offset > 0 {
+			data.PrevURL = searchPagePath(req.Archive.Name, req.Query, max(req.Offset-req.Limit, 0), req.Limit)
+		}
+
+		if next := req.Offset + req.Limit; next < response.Total {
+			data.NextURL = searchPagePath(req.Archive.Name, req.Query, next, req.Limit)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+
+	s.renderTemplate(w, r, "search.html", data)
+}
+
+// cacheWriter wraps the given writer to let the successful responses be
+// cached, errors and redirections are left as is.
+func (s *server) cacheWriter(w http.ResponseWriter) http.ResponseWriter {
+	return &cacheWriter{
+		ResponseWriter: w,
+		cacheControl:   fmt.Sprintf("public, max-age=%d", int(s.cacheMaxAge.Seconds())),
+	}
+}
+
+// cacheWriter sets the Cache-Control header of a response if its status is
+// 200 or 304.
+type cacheWriter struct {
+	http.ResponseWriter
+	cacheControl string
+	wroteHeader  bool
+}
+
+func (w *cacheWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+
+		if status == http.StatusOK || status == http.StatusNotModified {
+			w.Header().Set("Cache-Control", w.cacheControl)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cacheWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+var _ http.Flusher = &cacheWriter{}
+
+func (s *server) renderTemplate(w http.ResponseWriter, r *http.Request, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		logger.Error(r.Context(), "could not render template", logger.E(errors.WithStack(err)), logger.F("template", name))
+	}
+}
+
+func (s *server) renderJSON(w http.ResponseWriter, r *http.Request, data any) {
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Cache-Control", "no-cache")
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Error(r.Context(), "could not encode response", logger.E(errors.WithStack(err)))
+	}
+}
+
+func (s *server) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The client is gone, there is nobody to answer to
+		return
+	}
+
+	logger.Error(r.Context(), "could not serve request", logger.E(errors.WithStack(err)), logger.F("path", r.URL.Path))
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+func intParam(query url.Values, name string, defaultValue int) (int, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return value, nil
+}
+
+// entryPath returns the URL path of the given entry of the named archive.
+func entryPath(name string, entry zim.Entry) string {
+	u := &url.URL{Path: contentPath(name) + "/" + entry.FullURL()}
+	return u.String()
+}
+
+func faviconPath(name string) string {
+	u := &url.URL{Path: "/favicon/" + name}
+	return u.String()
+}
+
+func searchPagePath(name string, query string, offset int, limit int) string {
+	values := url.Values{}
+	values.Set("content", name)
+	values.Set("q", query)
+	values.Set("offset", strconv.Itoa(offset))
+	values.Set("limit", strconv.Itoa(limit))
+
+	return "/search?" + values.Encode()
+}
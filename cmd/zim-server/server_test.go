@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	zimLibrary "github.com/Bornholm/go-zim/library"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+func TestServer(t *testing.T) {
+	library, err := openLibrary(context.Background(), []string{"../../testdata"}, "", "", nil)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := library.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	if e, g := 3, len(library.Archives()); e != g {
+		t.Fatalf("len(library.Archives()): expected '%d', got '%d'", e, g)
+	}
+
+	archive := library.Archives()[0]
+
+	handlers := make([]http.Handler, 0, 2)
+
+	for i := 0; i < 2; i++ {
+		reader, err := library.Open(archive)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		handlers = append(handlers, library.Handler(archive.Name, reader))
+
+		reader.Close()
+	}
+
+	if handlers[0] != handlers[1] {
+		t.Errorf("handlers of the same reader should be shared")
+	}
+
+	server := httptest.NewServer(newServer(library, time.Hour))
+	defer server.Close()
+
+	type testCase struct {
+		Path                 string
+		AcceptEncoding       string
+		ExpectedStatus       int
+		ExpectedContentType  string
+		ExpectedEncoding     string
+		ExpectedCacheControl string
+		ExpectedBody         string
+	}
+
+	testCases := []testCase{
+		{
+			Path:                 "/",
+			ExpectedStatus:       http.StatusOK,
+			ExpectedContentType:  "text/html; charset=utf-8",
+			ExpectedCacheControl: "no-cache",
+			ExpectedBody:         `href="/content/wikibooks_af_all_maxi_2023-06/"`,
+		},
+		{
+			Path:                 "/content/go-zim_test_zlib_2024-01/A/Main_Page",
+			ExpectedStatus:       http.StatusOK,
+			ExpectedContentType:  "text/html",
+			ExpectedCacheControl: "public, max-age=3600",
+		},
+		{
+			// Too small to be worth compressing
+			Path:                 "/content/go-zim_test_zlib_2024-01/A/Diacritics",
+			AcceptEncoding:       "gzip, zstd;q=0.5",
+			ExpectedStatus:       http.StatusOK,
+			ExpectedCacheControl: "public, max-age=3600",
+			ExpectedContentType:  "text/html",
+		},
+		{
+			Path:           "/content/go-zim_test_zlib_2024-01/A/Missing",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Path:           "/content/go-zim_test_zlib_2024-01/",
+			ExpectedStatus: http.StatusFound,
+		},
+		{
+			Path:                 "/content/wikibooks_af_all_maxi_2023-06/A/Kookboek",
+			AcceptEncoding:       "gzip, zstd;q=0.5",
+			ExpectedStatus:       http.StatusOK,
+			ExpectedCacheControl: "public, max-age=3600",
+			ExpectedContentType:  "text/html",
+			ExpectedEncoding:     "gzip",
+			ExpectedBody:         "Kookboek",
+		},
+		{
+			Path:                 "/content/wikibooks_af_all_maxi_2023-06/A/Kookboek",
+			AcceptEncoding:       "gzip, zstd",
+			ExpectedStatus:       http.StatusOK,
+			ExpectedCacheControl: "public, max-age=3600",
+			ExpectedContentType:  "text/html",
+			ExpectedEncoding:     "zstd",
+			ExpectedBody:         "Kookboek",
+		},
+		{
+			Path:           "/content/unknown/A/Main_Page",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Path:                 "/api/search?content=wikibooks_af_all_maxi_2023-06&q=sop&limit=3",
+			AcceptEncoding:       "gzip",
+			ExpectedStatus:       http.StatusOK,
+			ExpectedCacheControl: "no-cache",
+			ExpectedContentType:  "application/json",
+			ExpectedEncoding:     "gzip",
+			ExpectedBody:         `"url":"/content/wikibooks_af_all_maxi_2023-06/A/Kookboek"`,
+		},
+		{
+			Path:           "/api/search?content=go-zim_test_zlib_2024-01&q=test",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Path:           "/api/search?content=wikibooks_af_all_maxi_2023-06&q=sop&limit=-1",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Path:                 "/api/suggest?content=go-zim_test_zlib_2024-01&q=creme",
+			ExpectedStatus:       http.StatusOK,
+			ExpectedCacheControl: "no-cache",
+			ExpectedContentType:  "application/json",
+			ExpectedBody:         `"url":"/content/go-zim_test_zlib_2024-01/A/Diacritics"`,
+		},
+		{
+			Path:                "/catalog/v2/entries?lang=afr",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedContentType: "application/atom+xml;profile=opds-catalog;kind=acquisition",
+			ExpectedBody:        `href="/content/wikibooks_af_all_maxi_2023-06"`,
+		},
+		{
+			Path:                 "/search?content=wikibooks_af_all_maxi_2023-06&q=sop",
+			ExpectedStatus:       http.StatusOK,
+			ExpectedCacheControl: "no-cache",
+			ExpectedContentType:  "text/html; charset=utf-8",
+			ExpectedBody:         "17 results",
+		},
+	}
+
+	// Do not let the transport negotiate and decode gzip on its own
+	client := &http.Client{
+		Transport: &http.Transport{DisableCompression: true},
+		// Check the redirections themselves rather than their targets
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Path+" "+tc.AcceptEncoding, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+tc.Path, nil)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if tc.AcceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.AcceptEncoding)
+			}
+
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer res.Body.Close()
+
+			if e, g := tc.ExpectedStatus, res.StatusCode; e != g {
+				t.Fatalf("res.StatusCode: expected '%d', got '%d'", e, g)
+			}
+
+			if tc.ExpectedContentType != "" {
+				if e, g := tc.ExpectedContentType, res.Header.Get("Content-Type"); e != g {
+					t.Errorf("Content-Type: expected '%s', got '%s'", e, g)
+				}
+			}
+
+			if e, g := tc.ExpectedCacheControl, res.Header.Get("Cache-Control"); e != g {
+				t.Errorf("Cache-Control: expected '%s', got '%s'", e, g)
+			}
+
+			if e, g := tc.ExpectedEncoding, res.Header.Get("Content-Encoding"); e != g {
+				t.Errorf("Content-Encoding: expected '%s', got '%s'", e, g)
+			}
+
+			body, err := decodeBody(res)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if !strings.Contains(body, tc.ExpectedBody) {
+				t.Errorf("body: expected to contain '%s', got '%s'", tc.ExpectedBody, body)
+			}
+		})
+	}
+}
+
+func TestServerSearchJSON(t *testing.T) {
+	library, err := openLibrary(context.Background(), []string{"../../testdata/wikibooks_af_all_maxi_2023-06.zim"}, "", "", nil)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := library.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search?content=wikibooks_af_all_maxi_2023-06&q=sop&offset=1&limit=2", nil)
+	res := httptest.NewRecorder()
+
+	newServer(library, time.Hour).ServeHTTP(res, req)
+
+	if e, g := http.StatusOK, res.Code; e != g {
+		t.Fatalf("res.Code: expected '%d', got '%d'", e, g)
+	}
+
+	var response searchResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &response); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 17, response.Total; e != g {
+		t.Errorf("response.Total: expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := 2, len(response.Results); e != g {
+		t.Errorf("len(response.Results): expected '%d', got '%d'", e, g)
+	}
+}
+
+func TestServerRefresh(t *testing.T) {
+	dir := t.TempDir()
+
+	copyFile := func(name string) {
+		data, err := os.ReadFile(filepath.Join("../../testdata", name))
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	copyFile("go-zim_test_zlib_2024-01.zim")
+
+	const (
+		zlibUUID = "5f1c2e4a-9b7d-4c3e-8a21-6d0f3b9e7c12"
+		zlibURL  = "https://example.org/go-zim_test_zlib_2024-01.zim"
+	)
+
+	libraryFile := filepath.Join(t.TempDir(), "library.xml")
+	listed := []*zimLibrary.Book{{ID: zlibUUID, Path: filepath.Join(dir, "go-zim_test_zlib_2024-01.zim"), URL: zlibURL}}
+
+	library, err := openLibrary(context.Background(), []string{dir}, "", libraryFile, listed)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := library.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	server := newServer(library, time.Hour)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return res
+	}
+
+	if e, g := http.StatusNotFound, get("/content/go-zim_test_bzip2_2024-01/A/Main_Page").Code; e != g {
+		t.Fatalf("res.Code: expected '%d', got '%d'", e, g)
+	}
+
+	copyFile("go-zim_test_bzip2_2024-01.zim")
+
+	if err := library.archives.Refresh(context.Background()); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := http.StatusOK, get("/content/go-zim_test_bzip2_2024-01/A/Main_Page").Code; e != g {
+		t.Errorf("res.Code: expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := 2, len(library.Catalog().Books()); e != g {
+		t.Errorf("len(library.Catalog().Books()): expected '%d', got '%d'", e, g)
+	}
+
+	books, err := loadLibraryFile(libraryFile)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 2, len(books); e != g {
+		t.Fatalf("len(books): expected '%d', got '%d'", e, g)
+	}
+
+	for _, b := range books {
+		if b.ID != zlibUUID {
+			continue
+		}
+
+		if e, g := zlibURL, b.URL; e != g {
+			t.Errorf("b.URL: expected '%s', got '%s'", e, g)
+		}
+	}
+
+	if book, exists := library.Catalog().Book(zlibUUID); !exists || book.URL != "" {
+		t.Errorf("books of the catalog should not be modified by the library file")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "go-zim_test_zlib_2024-01.zim")); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := library.archives.Refresh(context.Background()); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := http.StatusNotFound, get("/content/go-zim_test_zlib_2024-01/A/Main_Page").Code; e != g {
+		t.Errorf("res.Code: expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := 1, len(library.Archives()); e != g {
+		t.Errorf("len(library.Archives()): expected '%d', got '%d'", e, g)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	testCases := map[string]string{
+		"":                      "",
+		"identity":              "",
+		"gzip":                  "gzip",
+		"gzip, zstd":            "zstd",
+		"gzip;q=1, zstd;q=0.5":  "gzip",
+		"zstd;q=0, gzip":        "gzip",
+		"*":                     "zstd",
+		"br, *;q=0.1, zstd;q=0": "gzip",
+	}
+
+	for header, expected := range testCases {
+		if e, g := expected, negotiateEncoding(header); e != g {
+			t.Errorf("negotiateEncoding(%q): expected '%s', got '%s'", header, e, g)
+		}
+	}
+}
+
+func decodeBody(res *http.Response) (string, error) {
+	var reader io.Reader = res.Body
+
+	switch res.Header.Get("Content-Encoding") {
+	case encodingGzip:
+		gzipReader, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		reader = gzipReader
+	case encodingZstd:
+		zstdReader, err := zstd.NewReader(res.Body)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		defer zstdReader.Close()
+
+		reader = zstdReader
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+func runCheckMetadata(args []string) int {
+	flags := flag.NewFlagSet("check-metadata", flag.ExitOnError)
+
+	strict := flags.Bool("strict", false, "fail on warnings too")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s check-metadata [flags] <archive>...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	failed := false
+
+	for _, path := range flags.Args() {
+		errs, warnings, err := checkMetadata(os.Stdout, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %+v\n", path, err)
+			failed = true
+
+			continue
+		}
+
+		if errs > 0 || (*strict && warnings > 0) {
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+
+	return 0
+}
+
+// checkMetadata prints the metadata problems of the given archive and
+// returns the number of errors and warnings found.
+func checkMetadata(w io.Writer, path string) (errs int, warnings int, err error) {
+	reader, err := zim.Open(path)
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	defer reader.Close()
+
+	problems, err := reader.CheckMetadata()
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	for _, p := range problems {
+		switch p.Severity {
+		case zim.MetadataError:
+			errs++
+		case zim.MetadataWarning:
+			warnings++
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", path, p)
+	}
+
+	fmt.Fprintf(w, "%s: %d error(s), %d warning(s)\n", path, errs, warnings)
+
+	return errs, warnings, nil
+}
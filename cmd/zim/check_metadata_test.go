@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheckMetadata(t *testing.T) {
+	var buf bytes.Buffer
+
+	errs, warnings, err := checkMetadata(&buf, "../../testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, errs; e != g {
+		t.Errorf("errs: expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := 0, warnings; e != g {
+		t.Errorf("warnings: expected '%d', got '%d'", e, g)
+	}
+
+	expected := "../../testdata/go-zim_test_zlib_2024-01.zim: error missing [Illustration_48x48@1]: mandatory metadata is missing\n" +
+		"../../testdata/go-zim_test_zlib_2024-01.zim: 1 error(s), 0 warning(s)\n"
+
+	if e, g := expected, buf.String(); e != g {
+		t.Errorf("output: expected '%s', got '%s'", e, g)
+	}
+
+	if _, _, err := checkMetadata(&buf, "../../testdata/missing.zim"); err == nil {
+		t.Errorf("expected an error on a missing archive")
+	}
+}
@@ -0,0 +1,67 @@
+// Command zim inspects ZIM archives.
+//
+// Usage:
+//
+//	zim <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	check-metadata	check the metadata of archives against the openZIM rules
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a subcommand of zim, run with the arguments following its
+// name. It returns the exit code of the program.
+type command struct {
+	Description string
+	Run         func(args []string) int
+}
+
+var commands = map[string]command{
+	"check-metadata": {
+		Description: "check the metadata of archives against the openZIM rules",
+		Run:         runCheckMetadata,
+	},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, exists := commands[flag.Arg(0)]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(cmd.Run(flag.Args()[1:]))
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintf(out, "usage: %s <command> [flags] [arguments]\n\ncommands:\n", os.Args[0])
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-16s %s\n", name, commands[name].Description)
+	}
+}
@@ -1,18 +1,23 @@
 package zim
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"io"
 	"os"
-	"sync"
 
 	"github.com/pkg/errors"
 )
 
+// CompressedBlobReader reads a blob stored in a compressed cluster. As any
+// io.ReadSeeker, it is not safe for concurrent use: each goroutine should
+// use its own reader, as returned by ContentEntry.Reader().
 type CompressedBlobReader struct {
+	ctx            context.Context
 	reader         *Reader
-	decoderFactory BlobDecoderFactory
+	decoderFactory ClusterDecoderFactory
 
 	clusterStartOffset uint64
 	clusterEndOffset   uint64
@@ -20,38 +25,119 @@ type CompressedBlobReader struct {
 	blobSize           int
 	readOffset         uint64
 
-	loadCluster    sync.Once
 	loadClusterErr error
 
 	data   *bytes.Reader
 	closed bool
+
+	// In streaming mode, the blob is decoded on the fly from the
+	// compressed cluster instead of being fully decompressed in memory.
+	streaming bool
+	stream    *blobStream
+	length    int64
+}
+
+type blobStream struct {
+	decoder  io.ReadCloser
+	blob     io.Reader
+	position uint64
 }
 
 // Seek implements BlobReader.
 func (r *CompressedBlobReader) Seek(offset int64, whence int) (int64, error) {
-	if err := r.loadClusterData(); err != nil {
+	if err := r.ctx.Err(); err != nil {
 		return 0, errors.WithStack(err)
 	}
 
-	return r.data.Seek(offset, whence)
+	if r.streaming {
+		if data, found := r.reader.cachedCluster(r.clusterStartOffset); found {
+			if err := r.switchToClusterData(data); err != nil {
+				return 0, errors.WithStack(err)
+			}
+		}
+	}
+
+	if !r.streaming {
+		if err := r.loadClusterData(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		return r.data.Seek(offset, whence)
+	}
+
+	if r.closed {
+		return 0, errors.WithStack(os.ErrClosed)
+	}
+
+	var position int64
+
+	switch whence {
+	case io.SeekStart:
+		position = offset
+	case io.SeekCurrent:
+		position = int64(r.readOffset) + offset
+	case io.SeekEnd:
+		size, err := r.Size()
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		position = size + offset
+	default:
+		return 0, errors.Errorf("invalid whence '%d'", whence)
+	}
+
+	if position < 0 {
+		return 0, errors.Errorf("negative position '%d'", position)
+	}
+
+	// The stream is only moved on the next read, the decoder being
+	// restarted if the new position is behind the current one.
+	r.readOffset = uint64(position)
+
+	return position, nil
 }
 
 // Size implements BlobReader.
 func (r *CompressedBlobReader) Size() (int64, error) {
-	if err := r.loadClusterData(); err != nil {
-		return 0, errors.WithStack(err)
+	if !r.streaming {
+		if err := r.loadClusterData(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		return r.data.Size(), nil
 	}
 
-	return r.data.Size(), nil
+	if r.stream == nil {
+		if err := r.openStream(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	return r.length, nil
 }
 
 // Close implements io.ReadCloser.
 func (r *CompressedBlobReader) Close() error {
+	r.closed = true
+
+	if err := r.closeStream(); err != nil {
+		return errors.WithStack(err)
+	}
+
 	return nil
 }
 
 // Read implements io.ReadCloser.
 func (r *CompressedBlobReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	if r.streaming {
+		return r.readStream(p)
+	}
+
 	if err := r.loadClusterData(); err != nil {
 		return 0, errors.WithStack(err)
 	}
@@ -59,89 +145,281 @@ func (r *CompressedBlobReader) Read(p []byte) (int, error) {
 	return r.data.Read(p)
 }
 
-func (r *CompressedBlobReader) loadClusterData() error {
+func (r *CompressedBlobReader) readStream(p []byte) (int, error) {
 	if r.closed {
-		return errors.WithStack(os.ErrClosed)
+		return 0, errors.WithStack(os.ErrClosed)
 	}
 
-	r.loadCluster.Do(func() {
-		compressedData := make([]byte, r.clusterEndOffset-r.clusterStartOffset)
-		if err := r.reader.readRange(int64(r.clusterStartOffset+1), compressedData); err != nil {
-			r.loadClusterErr = errors.WithStack(err)
-			return
+	if r.stream == nil || r.stream.position > r.readOffset {
+		if err := r.openStream(); err != nil {
+			return 0, errors.WithStack(err)
 		}
+	}
 
-		blobBuffer := bytes.NewBuffer(compressedData)
-
-		decoder, err := r.decoderFactory(blobBuffer)
+	if skip := r.readOffset - r.stream.position; skip > 0 {
+		discarded, err := io.CopyN(io.Discard, r.stream.blob, int64(skip))
+		r.stream.position += uint64(discarded)
 		if err != nil {
-			r.loadClusterErr = errors.WithStack(err)
-			return
+			if errors.Is(err, io.EOF) {
+				return 0, io.EOF
+			}
+
+			return 0, errors.WithStack(err)
 		}
+	}
 
-		defer decoder.Close()
+	read, err := r.stream.blob.Read(p)
 
-		uncompressedData, err := io.ReadAll(decoder)
-		if err != nil {
-			r.loadClusterErr = errors.WithStack(err)
-			return
-		}
+	r.stream.position += uint64(read)
+	r.readOffset += uint64(read)
 
-		var (
-			blobStart uint64
-			blobEnd   uint64
-		)
+	return read, err
+}
 
-		if r.blobSize == 8 {
-			blobStart64, err := readUint64(uncompressedData[r.blobIndex*uint32(r.blobSize):r.blobIndex*uint32(r.blobSize)+uint32(r.blobSize)], binary.LittleEndian)
-			if err != nil {
-				r.loadClusterErr = errors.WithStack(err)
-				return
-			}
+// openStream starts decoding the cluster and skips its content up to the
+// beginning of the blob.
+func (r *CompressedBlobReader) openStream() error {
+	if err := r.closeStream(); err != nil {
+		return errors.WithStack(err)
+	}
 
-			blobStart = blobStart64
+	compressed := io.NewSectionReader(r.reader.reader, int64(r.clusterStartOffset+1), int64(r.clusterEndOffset-r.clusterStartOffset))
 
-			blobEnd64, err := readUint64(uncompressedData[r.blobIndex*uint32(r.blobSize)+uint32(r.blobSize):r.blobIndex*uint32(r.blobSize)+uint32(r.blobSize)+uint32(r.blobSize)], binary.LittleEndian)
-			if err != nil {
-				r.loadClusterErr = errors.WithStack(err)
-				return
-			}
+	decoder, err := r.decoderFactory(bufio.NewReader(&contextReader{ctx: r.ctx, reader: compressed}))
+	if err != nil {
+		return errors.WithStack(contextErrorOr(r.ctx, err))
+	}
 
-			blobEnd = blobEnd64
-		} else {
-			blobStart32, err := readUint32(uncompressedData[r.blobIndex*uint32(r.blobSize):r.blobIndex*uint32(r.blobSize)+uint32(r.blobSize)], binary.LittleEndian)
-			if err != nil {
-				r.loadClusterErr = errors.WithStack(err)
-				return
-			}
+	blobStart, blobEnd, err := r.readStreamOffsets(decoder)
+	if err != nil {
+		decoder.Close()
+		return errors.WithStack(err)
+	}
 
-			blobStart = uint64(blobStart32)
+	// The offsets table is read up to the end offset of the blob
+	consumed := (uint64(r.blobIndex) + 2) * uint64(r.blobSize)
 
-			blobEnd32, err := readUint32(uncompressedData[r.blobIndex*uint32(r.blobSize)+uint32(r.blobSize):r.blobIndex*uint32(r.blobSize)+uint32(r.blobSize)+uint32(r.blobSize)], binary.LittleEndian)
-			if err != nil {
-				r.loadClusterErr = errors.WithStack(err)
-				return
-			}
+	if blobStart < consumed {
+		decoder.Close()
+		return errors.Errorf("invalid blob start offset '%d'", blobStart)
+	}
+
+	if _, err := io.CopyN(io.Discard, decoder, int64(blobStart-consumed)); err != nil {
+		decoder.Close()
+		return errors.WithStack(contextErrorOr(r.ctx, err))
+	}
+
+	r.length = int64(blobEnd - blobStart)
+	r.stream = &blobStream{
+		decoder: decoder,
+		blob:    io.LimitReader(decoder, r.length),
+	}
+
+	return nil
+}
+
+// readStreamOffsets reads the start and end offsets of the blob from the
+// offsets table at the beginning of the given decoded cluster. The blob
+// index, which comes from the directory entry, is checked against the
+// number of offsets given by the first one before skipping to the blob
+// offsets, so the table is never buffered.
+func (r *CompressedBlobReader) readStreamOffsets(decoder io.Reader) (uint64, uint64, error) {
+	blobSize := uint64(r.blobSize)
+	offsets := make([]byte, 2*blobSize)
+
+	if _, err := io.ReadFull(decoder, offsets[:blobSize]); err != nil {
+		return 0, 0, errors.WithStack(contextErrorOr(r.ctx, err))
+	}
+
+	first := uint64(binary.LittleEndian.Uint32(offsets))
+	if blobSize == 8 {
+		first = binary.LittleEndian.Uint64(offsets)
+	}
+
+	if offsetCount := first / blobSize; uint64(r.blobIndex)+1 >= offsetCount {
+		return 0, 0, errors.Wrapf(ErrInvalidIndex, "blob index '%d' out of bounds", r.blobIndex)
+	}
 
-			blobEnd = uint64(blobEnd32)
+	remaining := offsets[blobSize:]
+
+	if r.blobIndex > 0 {
+		if _, err := io.CopyN(io.Discard, decoder, int64((uint64(r.blobIndex)-1)*blobSize)); err != nil {
+			return 0, 0, errors.WithStack(contextErrorOr(r.ctx, err))
 		}
 
-		data := make([]byte, blobEnd-blobStart)
-		copy(data, uncompressedData[blobStart:blobEnd])
+		remaining = offsets
+	}
+
+	if _, err := io.ReadFull(decoder, remaining); err != nil {
+		return 0, 0, errors.WithStack(contextErrorOr(r.ctx, err))
+	}
+
+	blobStart, blobEnd, err := readBlobOffsets(offsets, 0, r.blobSize)
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	return blobStart, blobEnd, nil
+}
+
+func (r *CompressedBlobReader) closeStream() error {
+	if r.stream == nil {
+		return nil
+	}
+
+	decoder := r.stream.decoder
+	r.stream = nil
+
+	if err := decoder.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// switchToClusterData leaves the streaming mode and serves the blob from
+// the given decompressed cluster data, keeping the current position.
+func (r *CompressedBlobReader) switchToClusterData(data []byte) error {
+	if err := r.closeStream(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := r.setClusterData(data); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := r.data.Seek(int64(r.readOffset), io.SeekStart); err != nil {
+		return errors.WithStack(err)
+	}
+
+	r.streaming = false
+
+	return nil
+}
+
+func (r *CompressedBlobReader) setClusterData(data []byte) error {
+	blobStart, blobEnd, err := readBlobOffsets(data, r.blobIndex, r.blobSize)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if blobEnd > uint64(len(data)) {
+		return errors.Errorf("invalid blob boundaries '%d-%d' for cluster of size '%d'", blobStart, blobEnd, len(data))
+	}
+
+	// The cluster data is shared with the cache and is never modified,
+	// so the blob can be served without copying it.
+	r.data = bytes.NewReader(data[blobStart:blobEnd])
+
+	return nil
+}
+
+func (r *CompressedBlobReader) loadClusterData() error {
+	if r.closed {
+		return errors.WithStack(os.ErrClosed)
+	}
 
-		r.data = bytes.NewReader(data)
-	})
 	if r.loadClusterErr != nil {
 		return errors.WithStack(r.loadClusterErr)
 	}
 
+	if r.data != nil {
+		return nil
+	}
+
+	uncompressedData, err := r.reader.loadCluster(r.ctx, r.clusterStartOffset, r.clusterEndOffset, r.decoderFactory)
+	if err != nil {
+		r.loadClusterErr = errors.WithStack(err)
+		return errors.WithStack(err)
+	}
+
+	if err := r.setClusterData(uncompressedData); err != nil {
+		r.loadClusterErr = errors.WithStack(err)
+		return errors.WithStack(err)
+	}
+
 	return nil
 }
 
+// readBlobOffsets returns the start and end offsets of the given blob
+// from the offsets list at the beginning of the decompressed cluster data.
+func readBlobOffsets(data []byte, blobIndex uint32, blobSize int) (uint64, uint64, error) {
+	offset := uint64(blobIndex) * uint64(blobSize)
+	if offset+2*uint64(blobSize) > uint64(len(data)) {
+		return 0, 0, errors.Wrapf(ErrInvalidIndex, "blob index '%d' out of bounds", blobIndex)
+	}
+
+	var (
+		blobStart uint64
+		blobEnd   uint64
+	)
+
+	if blobSize == 8 {
+		blobStart64, err := readUint64(data[offset:offset+8], binary.LittleEndian)
+		if err != nil {
+			return 0, 0, errors.WithStack(err)
+		}
+
+		blobStart = blobStart64
+
+		blobEnd64, err := readUint64(data[offset+8:offset+16], binary.LittleEndian)
+		if err != nil {
+			return 0, 0, errors.WithStack(err)
+		}
+
+		blobEnd = blobEnd64
+	} else {
+		blobStart32, err := readUint32(data[offset:offset+4], binary.LittleEndian)
+		if err != nil {
+			return 0, 0, errors.WithStack(err)
+		}
+
+		blobStart = uint64(blobStart32)
+
+		blobEnd32, err := readUint32(data[offset+4:offset+8], binary.LittleEndian)
+		if err != nil {
+			return 0, 0, errors.WithStack(err)
+		}
+
+		blobEnd = uint64(blobEnd32)
+	}
+
+	if blobStart > blobEnd {
+		return 0, 0, errors.Errorf("invalid blob boundaries '%d-%d'", blobStart, blobEnd)
+	}
+
+	return blobStart, blobEnd, nil
+}
+
+// ClusterDecoderFactory returns a reader decoding the given compressed cluster
+// stream. The decoder should not buffer the whole decompressed data, so that
+// blobs can be streamed.
+type ClusterDecoderFactory func(io.Reader) (io.ReadCloser, error)
+
+// BlobDecoderFactory returns a seekable reader on the decompressed data of
+// the given compressed cluster. Prefer ClusterDecoderFactory, which allows
+// blobs to be streamed.
 type BlobDecoderFactory func(io.Reader) (io.ReadSeekCloser, error)
 
+// Stream returns the ClusterDecoderFactory equivalent to the factory.
+func (f BlobDecoderFactory) Stream() ClusterDecoderFactory {
+	return func(r io.Reader) (io.ReadCloser, error) {
+		decoder, err := f(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return decoder, nil
+	}
+}
+
 func NewCompressedBlobReader(reader *Reader, decoderFactory BlobDecoderFactory, clusterStartOffset, clusterEndOffset uint64, blobIndex uint32, blobSize int) *CompressedBlobReader {
+	return newCompressedBlobReader(reader, decoderFactory.Stream(), clusterStartOffset, clusterEndOffset, blobIndex, blobSize)
+}
+
+func newCompressedBlobReader(reader *Reader, decoderFactory ClusterDecoderFactory, clusterStartOffset, clusterEndOffset uint64, blobIndex uint32, blobSize int) *CompressedBlobReader {
 	return &CompressedBlobReader{
+		ctx:                context.Background(),
 		reader:             reader,
 		decoderFactory:     decoderFactory,
 		clusterStartOffset: clusterStartOffset,
@@ -149,6 +427,7 @@ func NewCompressedBlobReader(reader *Reader, decoderFactory BlobDecoderFactory,
 		blobIndex:          blobIndex,
 		blobSize:           blobSize,
 		readOffset:         0,
+		streaming:          reader.shouldStreamCluster(clusterStartOffset, clusterEndOffset-clusterStartOffset),
 	}
 }
 
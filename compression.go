@@ -0,0 +1,66 @@
+package zim
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Compression is the algorithm identifier stored in the first byte of
+// a cluster.
+type Compression uint8
+
+const (
+	CompressionNoneZeno  Compression = 0
+	CompressionNone      Compression = 1
+	CompressionZLib      Compression = 2
+	CompressionBZip2     Compression = 3
+	CompressionXZ        Compression = 4
+	CompressionZStandard Compression = 5
+)
+
+var (
+	decodersMutex sync.RWMutex
+	decoders      = map[Compression]ClusterDecoderFactory{}
+)
+
+// RegisterDecoder registers the decoder factory used by all readers to
+// decompress clusters with the given compression identifier, replacing any
+// previously registered factory. The built-in decoders are registered on
+// package initialization and can be overridden this way.
+//
+// Uncompressed clusters are always read directly from the archive, so
+// registering a decoder for CompressionNone or CompressionNoneZeno has no
+// effect.
+func RegisterDecoder(compression Compression, factory ClusterDecoderFactory) {
+	decodersMutex.Lock()
+	defer decodersMutex.Unlock()
+
+	decoders[compression] = factory
+}
+
+// RegisteredDecoder returns the decoder factory registered for the given
+// compression identifier.
+func RegisteredDecoder(compression Compression) (ClusterDecoderFactory, bool) {
+	decodersMutex.RLock()
+	defer decodersMutex.RUnlock()
+
+	factory, exists := decoders[compression]
+
+	return factory, exists
+}
+
+// decoder returns the decoder factory for the given compression identifier,
+// the ones provided in the reader options taking precedence over the
+// registered ones.
+func (r *Reader) decoder(compression Compression) (ClusterDecoderFactory, error) {
+	if factory, exists := r.decoders[compression]; exists {
+		return factory, nil
+	}
+
+	if factory, exists := RegisteredDecoder(compression); exists {
+		return factory, nil
+	}
+
+	return nil, errors.Wrapf(ErrCompressionAlgorithmNotSupported, "unexpected compression algorithm '%d'", compression)
+}
@@ -0,0 +1,319 @@
+package zim
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Run with -race to detect data races between concurrent readers.
+
+const (
+	stressGoroutines = 8
+	// stressEntries is the number of entries visited by each goroutine
+	stressEntries = 48
+)
+
+type stressExpectation struct {
+	fullURL  string
+	title    string
+	redirect bool
+	checksum [md5.Size]byte
+}
+
+func TestReaderConcurrency(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	configs := map[string][]OptionFunc{
+		"Default":   {},
+		"Streaming": {WithStreamingThreshold(0), WithClusterCacheSize(1)},
+		"NoCache":   {WithClusterCacheSize(0), WithCacheSize(1)},
+		"Preload":   {WithPreload(true)},
+	}
+
+	for _, zf := range files {
+		for configName, funcs := range configs {
+			t.Run(fmt.Sprintf("%s/%s", filepath.Base(zf), configName), func(t *testing.T) {
+				reader, err := Open(zf, funcs...)
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				defer func() {
+					if err := reader.Close(); err != nil {
+						t.Errorf("%+v", errors.WithStack(err))
+					}
+				}()
+
+				expectations, err := collectStressExpectations(reader)
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				var wg sync.WaitGroup
+
+				for g := 0; g < stressGoroutines; g++ {
+					wg.Add(1)
+
+					go func(g int) {
+						defer wg.Done()
+
+						for i := 0; i < stressEntries && i < len(expectations); i++ {
+							// Each goroutine visits the entries from a different offset
+							expected := expectations[(i+g*len(expectations)/stressGoroutines)%len(expectations)]
+
+							if err := checkStressEntry(reader, expected, g%2 == 0); err != nil {
+								t.Errorf("entry '%s': %+v", expected.fullURL, err)
+								return
+							}
+						}
+
+						if err := checkStressIterator(reader, expectations); err != nil {
+							t.Errorf("%+v", err)
+						}
+
+						if _, err := reader.Metadata(); err != nil {
+							t.Errorf("%+v", errors.WithStack(err))
+						}
+
+						if _, err := reader.MainPage(); err != nil && !errors.Is(err, ErrNotFound) {
+							t.Errorf("%+v", errors.WithStack(err))
+						}
+
+						if _, err := reader.SuggestTitles(context.Background(), "a", 5); err != nil && !errors.Is(err, ErrNotFound) {
+							t.Errorf("%+v", errors.WithStack(err))
+						}
+
+						if _, err := reader.Search(context.Background(), "sop", WithSearchLimit(3)); err != nil && !errors.Is(err, ErrNotFound) {
+							t.Errorf("%+v", errors.WithStack(err))
+						}
+					}(g)
+				}
+
+				wg.Wait()
+			})
+		}
+	}
+}
+
+func TestContentEntryConcurrentReaders(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, zf := range files {
+		t.Run(filepath.Base(zf), func(t *testing.T) {
+			reader, err := Open(zf, WithClusterCacheSize(0))
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := reader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			iterator := reader.Entries()
+			stride := int(reader.EntryCount())/stressEntries + 1
+
+			for iterator.Next() {
+				if iterator.Index()%stride != 0 {
+					continue
+				}
+
+				content, ok := iterator.Entry().(*ContentEntry)
+				if !ok {
+					continue
+				}
+
+				expected, err := readEntryContent(content)
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				// Shared entry, one blob reader per goroutine
+				var wg sync.WaitGroup
+
+				for g := 0; g < stressGoroutines/2; g++ {
+					wg.Add(1)
+
+					go func() {
+						defer wg.Done()
+
+						data, err := readEntryContent(content)
+						if err != nil {
+							t.Errorf("%+v", errors.WithStack(err))
+							return
+						}
+
+						if !bytes.Equal(expected, data) {
+							t.Errorf("entry '%s': content mismatch", content.FullURL())
+						}
+					}()
+				}
+
+				wg.Wait()
+
+				// Shared uncompressed blob reader, concurrent ReadAt calls
+				blob, err := content.Reader()
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				if readerAt, ok := blob.(io.ReaderAt); ok && len(expected) > 0 {
+					for g := 0; g < stressGoroutines/2; g++ {
+						wg.Add(1)
+
+						go func(g int) {
+							defer wg.Done()
+
+							offset := g * len(expected) / stressGoroutines
+							data := make([]byte, len(expected)-offset)
+
+							if _, err := readerAt.ReadAt(data, int64(offset)); err != nil && !errors.Is(err, io.EOF) {
+								t.Errorf("%+v", errors.WithStack(err))
+								return
+							}
+
+							if !bytes.Equal(expected[offset:], data) {
+								t.Errorf("entry '%s': content mismatch at offset '%d'", content.FullURL(), offset)
+							}
+						}(g)
+					}
+
+					wg.Wait()
+				}
+
+				if err := blob.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}
+
+			if err := iterator.Err(); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+		})
+	}
+}
+
+func collectStressExpectations(reader *Reader) ([]stressExpectation, error) {
+	expectations := make([]stressExpectation, 0, reader.EntryCount())
+
+	iterator := reader.Entries()
+
+	for iterator.Next() {
+		entry := iterator.Entry()
+
+		expected := stressExpectation{
+			fullURL: entry.FullURL(),
+			title:   entry.Title(),
+		}
+
+		content, err := entry.Redirect()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		_, expected.redirect = entry.(*RedirectEntry)
+
+		data, err := readEntryContent(content)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		expected.checksum = md5.Sum(data)
+		expectations = append(expectations, expected)
+	}
+
+	if err := iterator.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return expectations, nil
+}
+
+func checkStressEntry(reader *Reader, expected stressExpectation, seek bool) error {
+	entry, err := reader.EntryWithFullURL(expected.fullURL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if entry.Title() != expected.title {
+		return errors.Errorf("expected title '%s', got '%s'", expected.title, entry.Title())
+	}
+
+	if _, redirect := entry.(*RedirectEntry); redirect != expected.redirect {
+		return errors.Errorf("expected redirect '%v', got '%v'", expected.redirect, redirect)
+	}
+
+	if _, err := reader.EntryWithTitle(entry.Namespace(), entry.Title()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	content, err := entry.Redirect()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	blob, err := content.Reader()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer blob.Close()
+
+	if seek {
+		// Move around before reading the whole blob
+		size, err := blob.Size()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if _, err := blob.Seek(size/2, io.SeekStart); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if _, err := io.CopyN(io.Discard, blob, size/4); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if _, err := blob.Seek(0, io.SeekStart); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if md5.Sum(data) != expected.checksum {
+		return errors.New("content mismatch")
+	}
+
+	return nil
+}
+
+func checkStressIterator(reader *Reader, expectations []stressExpectation) error {
+	iterator := reader.Entries()
+
+	for iterator.Next() {
+		if e, g := expectations[iterator.Index()].fullURL, iterator.Entry().FullURL(); e != g {
+			return errors.Errorf("iterator: expected entry '%s', got '%s'", e, g)
+		}
+	}
+
+	return errors.WithStack(iterator.Err())
+}
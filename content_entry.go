@@ -1,22 +1,12 @@
 package zim
 
 import (
+	"context"
 	"encoding/binary"
 
 	"github.com/pkg/errors"
 )
 
-type zimCompression int
-
-const (
-	zimCompressionNoneZeno      zimCompression = 0
-	zimCompressionNone          zimCompression = 1
-	zimCompressionNoneZLib      zimCompression = 2
-	zimCompressionNoneBZip2     zimCompression = 3
-	zimCompressionNoneXZ        zimCompression = 4
-	zimCompressionNoneZStandard zimCompression = 5
-)
-
 type ContentEntry struct {
 	*BaseEntry
 	mimeType     string
@@ -38,12 +28,23 @@ func (e *ContentEntry) MimeType() string {
 }
 
 func (e *ContentEntry) Reader() (BlobReader, error) {
+	return e.ReaderContext(context.Background())
+}
+
+// ReaderContext is like Reader but the returned BlobReader fails with the
+// error of the given context once it is done, interrupting any decompression
+// in progress.
+func (e *ContentEntry) ReaderContext(ctx context.Context) (BlobReader, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	clusterHeader, clusterStartOffset, clusterEndOffset, err := e.readClusterInfo()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	compression := (clusterHeader << 4) >> 4
+	compression := Compression((clusterHeader << 4) >> 4)
 	extended := (clusterHeader<<3)>>7 == 1
 
 	blobSize := 4
@@ -54,9 +55,9 @@ func (e *ContentEntry) Reader() (BlobReader, error) {
 	switch compression {
 
 	// Uncompressed blobs
-	case uint8(zimCompressionNoneZeno):
+	case CompressionNoneZeno:
 		fallthrough
-	case uint8(zimCompressionNone):
+	case CompressionNone:
 		startPos := clusterStartOffset + 1
 		blobOffset := uint64(e.blobIndex * uint32(blobSize))
 
@@ -100,22 +101,22 @@ func (e *ContentEntry) Reader() (BlobReader, error) {
 			blobEnd = uint64(blobEnd32)
 		}
 
-		return NewUncompressedBlobReader(e.reader, startPos+blobStart, startPos+blobEnd, blobSize), nil
+		blobReader := NewUncompressedBlobReader(e.reader, startPos+blobStart, startPos+blobEnd, blobSize)
+		blobReader.ctx = ctx
 
-	// Supported compression algorithms
-	case uint8(zimCompressionNoneXZ):
-		return NewXZBlobReader(e.reader, clusterStartOffset, clusterEndOffset, e.blobIndex, blobSize), nil
+		return blobReader, nil
 
-	case uint8(zimCompressionNoneZStandard):
-		return NewZStdBlobReader(e.reader, clusterStartOffset, clusterEndOffset, e.blobIndex, blobSize), nil
-
-	// Unsupported compression algorithms
-	case uint8(zimCompressionNoneZLib):
-		fallthrough
-	case uint8(zimCompressionNoneBZip2):
-		fallthrough
+	// Compressed blobs
 	default:
-		return nil, errors.Wrapf(ErrCompressionAlgorithmNotSupported, "unexpected compression algorithm '%d'", compression)
+		decoderFactory, err := e.reader.decoder(compression)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		blobReader := newCompressedBlobReader(e.reader, decoderFactory, clusterStartOffset, clusterEndOffset, e.blobIndex, blobSize)
+		blobReader.ctx = ctx
+
+		return blobReader, nil
 	}
 }
 
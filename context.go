@@ -0,0 +1,40 @@
+package zim
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// contextReader fails with the error of its context once it is done.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// Read implements io.Reader.
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return r.reader.Read(p)
+}
+
+// contextErrorOr returns the error of the given context if it is done,
+// otherwise err. Decoders may not preserve the errors of their source, so
+// the cancellation would be hidden behind a decoding error.
+func contextErrorOr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+var _ io.Reader = &contextReader{}
@@ -0,0 +1,171 @@
+package zim
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestReaderContext(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := map[string]func(ctx context.Context) error{
+		"MainPageContext": func(ctx context.Context) error {
+			_, err := reader.MainPageContext(ctx)
+			return err
+		},
+		"EntryAtContext": func(ctx context.Context) error {
+			_, err := reader.EntryAtContext(ctx, 0)
+			return err
+		},
+		"EntryWithFullURLContext": func(ctx context.Context) error {
+			_, err := reader.EntryWithFullURLContext(ctx, "M/Title")
+			return err
+		},
+		"EntryWithURLContext": func(ctx context.Context) error {
+			_, err := reader.EntryWithURLContext(ctx, V5NamespaceMetadata, "Title")
+			return err
+		},
+		"EntryWithTitleContext": func(ctx context.Context) error {
+			_, err := reader.EntryWithTitleContext(ctx, V5NamespaceMetadata, "Title")
+			return err
+		},
+		"MetadataContext": func(ctx context.Context) error {
+			_, err := reader.MetadataContext(ctx)
+			return err
+		},
+		"EntriesContext": func(ctx context.Context) error {
+			iterator := reader.EntriesContext(ctx)
+			for iterator.Next() {
+			}
+			return iterator.Err()
+		},
+		"EntriesByTitleContext": func(ctx context.Context) error {
+			iterator := reader.EntriesByTitleContext(ctx)
+			for iterator.Next() {
+			}
+			return iterator.Err()
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			if err := call(context.Background()); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if err := call(canceled); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected error '%v', got '%v'", context.Canceled, err)
+			}
+		})
+	}
+}
+
+func TestContentEntryReaderContext(t *testing.T) {
+	configs := map[string][]OptionFunc{
+		"Default":   {},
+		"Streaming": {WithStreamingThreshold(0), WithClusterCacheSize(0)},
+	}
+
+	for configName, funcs := range configs {
+		t.Run(configName, func(t *testing.T) {
+			reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim", funcs...)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := reader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			entry, err := reader.MainPage()
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			content, err := entry.Redirect()
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			blob, err := content.ReaderContext(ctx)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer blob.Close()
+
+			if _, err := io.CopyN(io.Discard, blob, 1); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			cancel()
+
+			if _, err := io.ReadAll(blob); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected error '%v', got '%v'", context.Canceled, err)
+			}
+
+			if _, err := content.ReaderContext(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected error '%v', got '%v'", context.Canceled, err)
+			}
+		})
+	}
+}
+
+func TestReaderLoadClusterCanceled(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	decoderFactory, err := reader.decoder(CompressionZStandard)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	start, end, err := reader.getClusterOffsets(0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := reader.loadCluster(canceled, start, end, decoderFactory); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error '%v', got '%v'", context.Canceled, err)
+	}
+
+	// An interrupted decompression must not be cached
+	if _, found := reader.cachedCluster(start); found {
+		t.Fatal("expected cluster not to be cached")
+	}
+
+	if _, err := reader.loadCluster(context.Background(), start, end, decoderFactory); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+}
@@ -0,0 +1,33 @@
+// Package zim reads and writes ZIM archives.
+//
+// # Concurrency
+//
+// A Reader is safe for concurrent use by multiple goroutines: entry
+// lookups, iterations, metadata, blob reads, searches and suggestions can
+// run in parallel on the same Reader. Close must only be called once all the
+// other calls have returned.
+//
+// Entries are immutable and can be shared between goroutines. Each call to
+// ContentEntry.Reader() returns a new BlobReader with its own position, so
+// concurrent calls on the same entry are safe. A BlobReader must not be used
+// by multiple goroutines at once, except for the ReadAt method of
+// UncompressedBlobReader.
+//
+// An EntryIterator must not be shared between goroutines, each goroutine
+// should get its own iterator from Reader.Entries() or
+// Reader.EntriesByTitle().
+//
+// A Library is safe for concurrent use. The readers it returns are shared
+// between the callers asking for the same archive, and Close releases them
+// instead of closing the archive.
+//
+// A Writer is not safe for concurrent use.
+//
+// # Cancellation
+//
+// The lookup, iteration, metadata and blob reading methods of the Reader
+// have a "Context" variant, such as EntryWithURLContext() or
+// ContentEntry.ReaderContext(), which fails with the error of the given
+// context once it is cancelled or its deadline is exceeded. The variants
+// without context use context.Background().
+package zim
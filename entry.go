@@ -3,6 +3,7 @@ package zim
 import (
 	"encoding/binary"
 	"fmt"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -16,6 +17,7 @@ type Entry interface {
 }
 
 type BaseEntry struct {
+	index         int
 	mimeTypeIndex uint16
 	namespace     Namespace
 	url           string
@@ -23,6 +25,12 @@ type BaseEntry struct {
 	reader        *Reader
 }
 
+// Index returns the position of the entry in the URL pointer list, as
+// accepted by Reader.EntryAt().
+func (e *BaseEntry) Index() int {
+	return e.index
+}
+
 func (e *BaseEntry) Namespace() Namespace {
 	return e.namespace
 }
@@ -48,7 +56,7 @@ func (r *Reader) parseBaseEntry(offset int64) (*BaseEntry, error) {
 		reader: r,
 	}
 
-	data := make([]byte, 3)
+	data := make([]byte, 4)
 	if err := r.readRange(offset, data); err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -59,7 +67,7 @@ func (r *Reader) parseBaseEntry(offset int64) (*BaseEntry, error) {
 	}
 
 	entry.mimeTypeIndex = mimeTypeIndex
-	entry.namespace = Namespace(data[2])
+	entry.namespace = Namespace(data[3])
 
 	return entry, nil
 }
@@ -70,27 +78,30 @@ type RedirectEntry struct {
 }
 
 func (e *RedirectEntry) Redirect() (*ContentEntry, error) {
-	if e.redirectIndex >= uint32(len(e.reader.urlIndex)) {
-		return nil, errors.Wrapf(ErrInvalidIndex, "entry index '%d' out of bounds", e.redirectIndex)
+	current := e
+
+	for depth := 0; depth < maxRedirectDepth; depth++ {
+		if current.redirectIndex >= uint32(len(e.reader.urlIndex)) {
+			return nil, errors.Wrapf(ErrInvalidIndex, "entry index '%d' out of bounds", current.redirectIndex)
+		}
+
+		entryPtr := e.reader.urlIndex[current.redirectIndex]
+		entry, err := e.reader.parseEntryAt(int(current.redirectIndex), int64(entryPtr))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		switch typed := entry.(type) {
+		case *ContentEntry:
+			return typed, nil
+		case *RedirectEntry:
+			current = typed
+		default:
+			return nil, errors.WithStack(ErrInvalidRedirect)
+		}
 	}
 
-	entryPtr := e.reader.urlIndex[e.redirectIndex]
-	entry, err := e.reader.parseEntryAt(int64(entryPtr))
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-
-	entry, err = entry.Redirect()
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-
-	contentEntry, ok := entry.(*ContentEntry)
-	if !ok {
-		return nil, errors.WithStack(ErrInvalidRedirect)
-	}
-
-	return contentEntry, nil
+	return nil, errors.Wrapf(ErrInvalidRedirect, "more than '%d' redirects from entry '%s'", maxRedirectDepth, e.FullURL())
 }
 
 func (r *Reader) parseRedirectEntry(offset int64, base *BaseEntry) (*RedirectEntry, error) {
@@ -133,3 +144,13 @@ func toFullURL(ns Namespace, url string) string {
 
 	return fmt.Sprintf("%s/%s", ns, url)
 }
+
+// compareURL compares two (namespace, url) pairs following the ordering
+// of the ZIM URL pointer list.
+func compareURL(ns1 Namespace, url1 string, ns2 Namespace, url2 string) int {
+	if c := strings.Compare(string(ns1), string(ns2)); c != 0 {
+		return c
+	}
+
+	return strings.Compare(url1, url2)
+}
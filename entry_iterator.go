@@ -1,12 +1,18 @@
 package zim
 
-import "github.com/pkg/errors"
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
 
 type EntryIterator struct {
-	index  int
-	entry  Entry
-	err    error
-	reader *Reader
+	ctx     context.Context
+	index   int
+	count   int
+	entry   Entry
+	err     error
+	entryAt func(idx int) (Entry, error)
 }
 
 func (it *EntryIterator) Next() bool {
@@ -14,13 +20,19 @@ func (it *EntryIterator) Next() bool {
 		return false
 	}
 
-	entryCount := it.reader.EntryCount()
-
-	if it.index >= int(entryCount-1) {
+	if it.index >= it.count {
 		return false
 	}
 
-	entry, err := it.reader.EntryAt(it.index)
+	if it.ctx != nil {
+		if err := it.ctx.Err(); err != nil {
+			it.err = errors.WithStack(err)
+
+			return false
+		}
+	}
+
+	entry, err := it.entryAt(it.index)
 	if err != nil {
 		it.err = errors.WithStack(err)
 
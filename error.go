@@ -7,4 +7,5 @@ var (
 	ErrNotFound                         = errors.New("not found")
 	ErrInvalidRedirect                  = errors.New("invalid redirect")
 	ErrCompressionAlgorithmNotSupported = errors.New("compression algorithm not supported")
+	ErrChecksumMismatch                 = errors.New("checksum mismatch")
 )
@@ -32,10 +32,9 @@ func main() {
 		}
 	}()
 
-	fs := zimFS.New(reader)
-	fileServer := http.FileServer(http.FS(fs))
+	handler := zimFS.NewHandler(zimFS.New(reader))
 
-	if err := http.ListenAndServe(httpAddr, fileServer); err != nil {
+	if err := http.ListenAndServe(httpAddr, handler); err != nil {
 		panic(err)
 	}
 }
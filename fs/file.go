@@ -4,6 +4,8 @@ import (
 	"io"
 	"io/fs"
 	"time"
+
+	"github.com/Bornholm/go-zim"
 )
 
 type File struct {
@@ -42,8 +44,14 @@ type FileInfo struct {
 	mode    fs.FileMode
 	name    string
 	size    int64
+	sys     *zim.ContentEntry
 }
 
+const (
+	fileMode      fs.FileMode = 0444
+	directoryMode fs.FileMode = fs.ModeDir | 0555
+)
+
 // IsDir implements fs.FileInfo.
 func (i *FileInfo) IsDir() bool {
 	return i.isDir
@@ -69,9 +77,14 @@ func (i *FileInfo) Size() int64 {
 	return i.size
 }
 
-// Sys implements fs.FileInfo.
-func (*FileInfo) Sys() any {
-	return nil
+// Sys implements fs.FileInfo. It returns the *zim.ContentEntry of files,
+// redirects being resolved, and nil for directories.
+func (i *FileInfo) Sys() any {
+	if i.sys == nil {
+		return nil
+	}
+
+	return i.sys
 }
 
 var _ fs.FileInfo = &FileInfo{}
@@ -79,11 +92,83 @@ var _ fs.FileInfo = &FileInfo{}
 type Directory struct {
 	File
 	entries []fs.DirEntry
+	// offset is the position of the next entry returned by ReadDir.
+	offset int
 }
 
 // ReadDir implements fs.ReadDirFile.
 func (d *Directory) ReadDir(n int) ([]fs.DirEntry, error) {
-	return d.entries, nil
+	remaining := d.entries[d.offset:]
+
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+
+	d.offset += n
+
+	return remaining[:n], nil
 }
 
 var _ fs.ReadDirFile = &Directory{}
+
+// DirEntry is an entry of a Directory, either a synthesized directory or a
+// file backed by a ZIM entry.
+type DirEntry struct {
+	// info is set for directories, the info of files being computed on
+	// demand as it requires to read the entry content.
+	info *FileInfo
+
+	fs    *FS
+	entry zim.Entry
+	name  string
+}
+
+// Info implements fs.DirEntry.
+func (e *DirEntry) Info() (fs.FileInfo, error) {
+	if e.info != nil {
+		return e.info, nil
+	}
+
+	file, err := e.fs.serveZimEntry(e.name, e.entry)
+	if err != nil {
+		return nil, toPathError("stat", e.name, err)
+	}
+
+	defer file.Close()
+
+	return file.Stat()
+}
+
+// IsDir implements fs.DirEntry.
+func (e *DirEntry) IsDir() bool {
+	return e.info != nil && e.info.isDir
+}
+
+// Name implements fs.DirEntry.
+func (e *DirEntry) Name() string {
+	if e.info != nil {
+		return e.info.name
+	}
+
+	return e.name
+}
+
+// Type implements fs.DirEntry.
+func (e *DirEntry) Type() fs.FileMode {
+	if e.IsDir() {
+		return directoryMode.Type()
+	}
+
+	return fileMode.Type()
+}
+
+var _ fs.DirEntry = &DirEntry{}
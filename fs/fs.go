@@ -2,95 +2,372 @@ package fs
 
 import (
 	"bytes"
+	"context"
 	"io/fs"
 	iofs "io/fs"
-	"os"
-	"path/filepath"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/Bornholm/go-zim"
+	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/pkg/errors"
 )
 
+// indexName is the name of the alias of the main page of the archive.
+const indexName = "index.html"
+
+// FS exposes the entries of a ZIM archive as a file system. The root
+// directory contains a directory per namespace, in which entries are
+// organized following the segments of their URL. If an entry URL is also
+// the parent of other entries, as for the subpages of a wiki article, the
+// entry takes precedence over the directory: the other entries can still
+// be opened but are not listed.
 type FS struct {
+	ctx    context.Context
 	reader *zim.Reader
+	// root is the directory of the archive exposed by the file system,
+	// empty for the whole archive.
+	root    string
+	modTime time.Time
+
+	// namespaces is the search order of the namespaces when resolving
+	// URLs without namespace.
+	namespaces []zim.Namespace
+	// misses caches the names which could not be resolved, nil if
+	// disabled.
+	misses *lru.Cache[string, struct{}]
+}
+
+// WithContext returns a copy of the file system whose lookups and files
+// stop on the cancellation of the given context, typically the context of
+// an HTTP request.
+func (fs *FS) WithContext(ctx context.Context) *FS {
+	clone := *fs
+	clone.ctx = ctx
+
+	return &clone
 }
 
 // Open implements fs.FS.
 func (fs *FS) Open(name string) (iofs.File, error) {
-	switch name {
-	case ".":
-		return fs.serveDirectory(name)
-	case "index.html":
-		return fs.serveIndex()
-	default:
-		return fs.serveZimEntry(name)
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrInvalid}
+	}
+
+	file, err := fs.open(name)
+	if err != nil {
+		return nil, toPathError("open", name, err)
 	}
+
+	return file, nil
 }
 
-func (fs *FS) serveIndex() (iofs.File, error) {
-	main, err := fs.reader.MainPage()
+func (fs *FS) open(name string) (iofs.File, error) {
+	fullName := fs.fullName(name)
+
+	if fullName == "." {
+		return fs.serveDirectory(name, "")
+	}
+
+	entry, isDir, err := fs.resolve(fullName)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	return fs.serveZimEntry(main.FullURL())
+	if isDir {
+		return fs.serveDirectory(name, fullName)
+	}
+
+	return fs.serveZimEntry(name, entry)
 }
 
-func (fs *FS) serveDirectory(name string) (iofs.File, error) {
-	zimFile := &Directory{
-		File: File{
-			fileInfo: &FileInfo{
-				isDir:   true,
-				modTime: time.Time{},
-				mode:    0,
-				name:    name,
-				size:    0,
-			},
-			reader: &zim.NoopReadSeekCloser{
-				ReadSeeker: bytes.NewReader(nil),
-			},
-		},
-		entries: make([]iofs.DirEntry, 0),
+// resolve returns the entry designated by the given full name, or true if
+// the name designates a directory.
+func (fs *FS) resolve(fullName string) (zim.Entry, bool, error) {
+	// Misses are only cached from the root of the archive, where the
+	// whole resolution depends on the name only
+	if fs.root == "" && fs.misses != nil && fs.misses.Contains(fullName) {
+		return nil, false, errors.WithStack(zim.ErrNotFound)
 	}
 
-	return zimFile, nil
+	entry, err := fs.reader.EntryWithFullURLContext(fs.ctx, fullName)
+	if err != nil && !errors.Is(err, zim.ErrNotFound) {
+		return nil, false, errors.WithStack(err)
+	}
+
+	if entry != nil {
+		return entry, false, nil
+	}
+
+	isDir, err := fs.isDirectory(fullName)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	if isDir {
+		return nil, true, nil
+	}
+
+	// Aliases are only resolved from the root of the archive
+	if fs.root != "" {
+		return nil, false, errors.WithStack(zim.ErrNotFound)
+	}
+
+	if fullName == indexName {
+		entry, err := fs.reader.MainPageContext(fs.ctx)
+		if err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+
+		return entry, false, nil
+	}
+
+	entry, err = fs.searchEntryFromURL(fullName)
+	if err != nil {
+		if errors.Is(err, zim.ErrNotFound) && fs.misses != nil {
+			fs.misses.Add(fullName, struct{}{})
+		}
+
+		return nil, false, errors.WithStack(err)
+	}
+
+	return entry, false, nil
+}
+
+// Stat implements fs.StatFS.
+func (fs *FS) Stat(name string) (iofs.FileInfo, error) {
+	file, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, toPathError("stat", name, err)
+	}
+
+	return info, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (fs *FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	file, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	dir, ok := file.(*Directory)
+	if !ok {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, toPathError("readdir", name, err)
+	}
+
+	return entries, nil
+}
+
+// Sub implements fs.SubFS.
+func (fs *FS) Sub(dir string) (iofs.FS, error) {
+	if !iofs.ValidPath(dir) {
+		return nil, &iofs.PathError{Op: "sub", Path: dir, Err: iofs.ErrInvalid}
+	}
+
+	if dir == "." {
+		return fs, nil
+	}
+
+	clone := *fs
+	clone.root = fs.fullName(dir)
+
+	return &clone, nil
+}
+
+func (fs *FS) fullName(name string) string {
+	if fs.root == "" {
+		return name
+	}
+
+	return path.Join(fs.root, name)
+}
+
+// isDirectory returns true if the given name is a namespace or the parent
+// of entry URLs.
+func (fs *FS) isDirectory(fullName string) (bool, error) {
+	ns, url, _ := strings.Cut(fullName, "/")
+	if len(ns) != 1 {
+		return false, nil
+	}
+
+	prefix := ""
+	if url != "" {
+		prefix = url + "/"
+	}
+
+	iterator := fs.reader.EntriesWithURLPrefixContext(fs.ctx, zim.Namespace(ns), prefix)
+	found := iterator.Next()
+
+	if err := iterator.Err(); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return found, nil
+}
+
+func (fs *FS) serveDirectory(name string, fullName string) (iofs.File, error) {
+	var (
+		entries []iofs.DirEntry
+		err     error
+	)
+
+	if fullName == "" {
+		entries, err = fs.readNamespaces()
+	} else {
+		entries, err = fs.readChildren(fullName)
+	}
+
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return fs.newDirectory(path.Base(name), entries), nil
 }
 
-func (fs *FS) serveZimEntry(name string) (iofs.File, error) {
-	entry, err := fs.searchEntryFromURL(name)
+// readNamespaces returns the namespaces of the archive as directory
+// entries.
+func (fs *FS) readNamespaces() ([]iofs.DirEntry, error) {
+	namespaces, err := fs.reader.NamespacesContext(fs.ctx)
 	if err != nil {
-		if errors.Is(err, zim.ErrNotFound) {
-			return nil, os.ErrNotExist
+		return nil, errors.WithStack(err)
+	}
+
+	entries := make([]iofs.DirEntry, 0, len(namespaces))
+
+	for _, ns := range namespaces {
+		if !iofs.ValidPath(string(ns)) {
+			continue
 		}
 
+		entries = append(entries, &DirEntry{
+			info: fs.newDirectoryInfo(string(ns)),
+		})
+	}
+
+	return entries, nil
+}
+
+// readChildren returns the files and directories directly under the given
+// namespace or URL prefix.
+func (fs *FS) readChildren(fullName string) ([]iofs.DirEntry, error) {
+	ns, url, _ := strings.Cut(fullName, "/")
+
+	prefix := ""
+	if url != "" {
+		prefix = url + "/"
+	}
+
+	children := make(map[string]iofs.DirEntry)
+
+	iterator := fs.reader.EntriesWithURLPrefixContext(fs.ctx, zim.Namespace(ns), prefix)
+	for iterator.Next() {
+		entry := iterator.Entry()
+
+		rest := strings.TrimPrefix(entry.URL(), prefix)
+
+		// Entries which can not be opened are not listed
+		if !iofs.ValidPath(rest) || rest == "." {
+			continue
+		}
+
+		segment, _, isParent := strings.Cut(rest, "/")
+
+		if !isParent {
+			children[segment] = &DirEntry{
+				fs:    fs,
+				entry: entry,
+				name:  segment,
+			}
+
+			continue
+		}
+
+		if _, exists := children[segment]; !exists {
+			children[segment] = &DirEntry{
+				info: fs.newDirectoryInfo(segment),
+			}
+		}
+	}
+
+	if err := iterator.Err(); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	entries := make([]iofs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, child)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (fs *FS) newDirectory(name string, entries []iofs.DirEntry) *Directory {
+	return &Directory{
+		File: File{
+			fileInfo: fs.newDirectoryInfo(name),
+			reader: &zim.NoopReadSeekCloser{
+				ReadSeeker: bytes.NewReader(nil),
+			},
+		},
+		entries: entries,
+	}
+}
+
+func (fs *FS) newDirectoryInfo(name string) *FileInfo {
+	return &FileInfo{
+		isDir:   true,
+		modTime: fs.modTime,
+		mode:    directoryMode,
+		name:    name,
+	}
+}
+
+func (fs *FS) serveZimEntry(name string, entry zim.Entry) (iofs.File, error) {
 	content, err := entry.Redirect()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	contentReader, err := content.Reader()
+	contentReader, err := content.ReaderContext(fs.ctx)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	size, err := contentReader.Size()
 	if err != nil {
+		contentReader.Close()
 		return nil, errors.WithStack(err)
 	}
 
-	filename := filepath.Base(name)
-
 	zimFile := &File{
 		fileInfo: &FileInfo{
 			isDir:   false,
-			modTime: time.Time{},
-			mode:    0,
-			name:    filename,
+			modTime: fs.modTime,
+			mode:    fileMode,
+			name:    path.Base(name),
 			size:    size,
+			sys:     content,
 		},
 		reader: contentReader,
 	}
@@ -98,60 +375,106 @@ func (fs *FS) serveZimEntry(name string) (iofs.File, error) {
 	return zimFile, nil
 }
 
+// searchEntryFromURL looks for an entry with the given URL in each of the
+// namespaces of the search order, with a binary search over the URL pointer
+// list.
 func (fs *FS) searchEntryFromURL(url string) (zim.Entry, error) {
-	entry, err := fs.reader.EntryWithFullURL(url)
-	if err != nil && !errors.Is(err, zim.ErrNotFound) {
-		return nil, errors.WithStack(err)
-	}
+	for _, ns := range fs.namespaces {
+		entry, err := fs.reader.EntryWithURLContext(fs.ctx, ns, url)
+		if err != nil {
+			if errors.Is(err, zim.ErrNotFound) {
+				continue
+			}
+
+			return nil, errors.WithStack(err)
+		}
 
-	if entry != nil {
 		return entry, nil
 	}
 
-	contentNamespaces := []zim.Namespace{
-		zim.V6NamespaceContent,
-		zim.V6NamespaceMetadata,
-		zim.V5NamespaceLayout,
-		zim.V5NamespaceArticle,
-		zim.V5NamespaceImageFile,
-		zim.V5NamespaceMetadata,
+	return nil, errors.WithStack(zim.ErrNotFound)
+}
+
+// toPathError converts the given error to a *fs.PathError, mapping
+// zim.ErrNotFound to fs.ErrNotExist.
+func toPathError(op string, name string, err error) error {
+	if errors.Is(err, zim.ErrNotFound) {
+		err = iofs.ErrNotExist
 	}
 
-	for _, ns := range contentNamespaces {
-		entry, err := fs.reader.EntryWithURL(ns, url)
-		if err != nil && !errors.Is(err, zim.ErrNotFound) {
-			return nil, errors.WithStack(err)
-		}
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
 
-		if entry != nil {
-			return entry, nil
-		}
+// New returns a file system exposing the entries of the given archive.
+func New(reader *zim.Reader, funcs ...OptionFunc) *FS {
+	opts := NewOptions(funcs...)
+
+	modTime := opts.ModTime
+	if modTime.IsZero() {
+		modTime = archiveModTime(reader)
 	}
 
-	iterator := fs.reader.Entries()
-	for iterator.Next() {
-		current := iterator.Entry()
+	namespaces := opts.Namespaces
+	if namespaces == nil {
+		namespaces = defaultNamespaces(reader)
+	}
 
-		if current.FullURL() != url && current.URL() != url {
-			continue
-		}
+	fs := &FS{
+		ctx:        context.Background(),
+		reader:     reader,
+		modTime:    modTime,
+		namespaces: namespaces,
+	}
 
-		entry = current
-		break
+	if opts.NegativeCacheSize > 0 {
+		// The size is positive, so the cache can not fail to be created
+		misses, _ := lru.New[string, struct{}](opts.NegativeCacheSize)
+		fs.misses = misses
 	}
-	if err := iterator.Err(); err != nil {
-		return nil, errors.WithStack(err)
+
+	return fs
+}
+
+// defaultNamespaces returns the namespaces holding the content of the
+// archive, following the v6 layout if the archive has a "C" namespace and
+// the v5 layout otherwise.
+func defaultNamespaces(reader *zim.Reader) []zim.Namespace {
+	v6Namespaces := []zim.Namespace{
+		zim.V6NamespaceContent,
+		zim.V6NamespaceMetadata,
 	}
 
-	if entry == nil {
-		return nil, errors.WithStack(zim.ErrNotFound)
+	v5Namespaces := []zim.Namespace{
+		zim.V5NamespaceArticle,
+		zim.V5NamespaceImageFile,
+		zim.V5NamespaceLayout,
+		zim.V5NamespaceMetadata,
 	}
 
-	return entry, nil
+	iterator := reader.EntriesWithURLPrefix(zim.V6NamespaceContent, "")
+	if iterator.Next() {
+		return v6Namespaces
+	}
+
+	return v5Namespaces
 }
 
-func New(reader *zim.Reader) *FS {
-	return &FS{reader}
+// archiveModTime returns the date of the archive from its "Date" metadata,
+// falling back to the modification time of the archive file.
+func archiveModTime(reader *zim.Reader) time.Time {
+	metadata, err := reader.Metadata(zim.MetadataDate)
+	if err == nil {
+		if date, err := time.Parse(time.DateOnly, strings.TrimSpace(metadata[zim.MetadataDate])); err == nil {
+			return date
+		}
+	}
+
+	return reader.ModTime()
 }
 
-var _ fs.FS = &FS{}
+var (
+	_ fs.FS        = &FS{}
+	_ fs.StatFS    = &FS{}
+	_ fs.ReadDirFS = &FS{}
+	_ fs.SubFS     = &FS{}
+)
@@ -0,0 +1,301 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+func TestFS(t *testing.T) {
+	files, err := filepath.Glob("../testdata/*.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, zf := range files {
+		t.Run(filepath.Base(zf), func(t *testing.T) {
+			reader, err := zim.Open(zf)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := reader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			urls := make(map[string]struct{})
+
+			iterator := reader.Entries()
+			for iterator.Next() {
+				urls[iterator.Entry().FullURL()] = struct{}{}
+			}
+			if err := iterator.Err(); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			expected := make([]string, 0, len(urls))
+
+			for url := range urls {
+				if !fs.ValidPath(url) || isShadowed(url, urls) {
+					continue
+				}
+
+				expected = append(expected, url)
+			}
+
+			if err := fstest.TestFS(New(reader), expected...); err != nil {
+				t.Errorf("%+v", errors.WithStack(err))
+			}
+		})
+	}
+}
+
+func TestFSShadowedEntry(t *testing.T) {
+	reader, err := zim.Open("../testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	fsys := New(reader)
+
+	// "A/Duits" is both an entry and the parent of other entries
+	info, err := fs.Stat(fsys, "A/Duits")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if info.IsDir() {
+		t.Errorf("expected 'A/Duits' to be a file")
+	}
+
+	if _, err := fs.ReadFile(fsys, "A/Duits/Inhoud"); err != nil {
+		t.Errorf("%+v", errors.WithStack(err))
+	}
+}
+
+func TestDirectoryReadDir(t *testing.T) {
+	reader, err := zim.Open("../testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	entries, err := fs.ReadDir(New(reader), "A")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	if e, g := "Compression,Diacritics,Index,Main_Page", strings.Join(names, ","); e != g {
+		t.Errorf("expected entries '%s', got '%s'", e, g)
+	}
+
+	file, err := New(reader).Open("A")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer file.Close()
+
+	dir, ok := file.(fs.ReadDirFile)
+	if !ok {
+		t.Fatalf("expected a fs.ReadDirFile, got '%T'", file)
+	}
+
+	for i := 0; i < len(entries); i += 3 {
+		page, err := dir.ReadDir(3)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if e, g := min(3, len(entries)-i), len(page); e != g {
+			t.Errorf("expected '%d' entries, got '%d'", e, g)
+		}
+	}
+
+	if _, err := dir.ReadDir(3); !errors.Is(err, io.EOF) {
+		t.Errorf("expected error '%v', got '%v'", io.EOF, err)
+	}
+
+	if page, err := dir.ReadDir(-1); err != nil || len(page) != 0 {
+		t.Errorf("expected no entries and no error, got '%d' entries and '%v'", len(page), err)
+	}
+}
+
+// isShadowed returns true if one of the parents of the given URL is also an
+// entry, in which case the URL is not listed.
+func isShadowed(url string, urls map[string]struct{}) bool {
+	for i := len(url) - 1; i > 0; i-- {
+		if url[i] != '/' {
+			continue
+		}
+
+		if _, exists := urls[url[:i]]; exists {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestFileInfo(t *testing.T) {
+	reader, err := zim.Open("../testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	fsys := New(reader)
+	date := time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC)
+
+	info, err := fs.Stat(fsys, "A/Index")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := fs.FileMode(0444), info.Mode(); e != g {
+		t.Errorf("info.Mode(): expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := date, info.ModTime(); !e.Equal(g) {
+		t.Errorf("info.ModTime(): expected '%v', got '%v'", e, g)
+	}
+
+	// Redirects are resolved to their target
+	entry, ok := info.Sys().(*zim.ContentEntry)
+	if !ok {
+		t.Fatalf("info.Sys(): expected a *zim.ContentEntry, got '%T'", info.Sys())
+	}
+
+	if e, g := "A/Main_Page", entry.FullURL(); e != g {
+		t.Errorf("info.Sys(): expected entry '%s', got '%s'", e, g)
+	}
+
+	if e, g := "text/html", entry.MimeType(); e != g {
+		t.Errorf("info.Sys(): expected mime type '%s', got '%s'", e, g)
+	}
+
+	info, err = fs.Stat(fsys, "A")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := fs.ModeDir|0555, info.Mode(); e != g {
+		t.Errorf("info.Mode(): expected '%v', got '%v'", e, g)
+	}
+
+	if info.Sys() != nil {
+		t.Errorf("info.Sys(): expected nil, got '%v'", info.Sys())
+	}
+
+	modTime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	info, err = fs.Stat(New(reader, WithModTime(modTime)), "A/Main_Page")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := modTime, info.ModTime(); !e.Equal(g) {
+		t.Errorf("info.ModTime(): expected '%v', got '%v'", e, g)
+	}
+}
+
+func TestFSResolution(t *testing.T) {
+	file, err := os.Open("../testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	counter := &countingReaderAt{ReadAtCloser: file}
+
+	reader, err := zim.NewReader(counter)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	fsys := New(reader)
+
+	// Names without namespace are resolved with the v5 layout
+	if _, err := fs.Stat(fsys, "Tuisblad"); err != nil {
+		t.Errorf("%+v", errors.WithStack(err))
+	}
+
+	counter.reads.Store(0)
+
+	if _, err := fsys.Open("__does_not_exist__"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error '%v', got '%v'", fs.ErrNotExist, err)
+	}
+
+	// A miss only costs a few binary searches, not a scan of the entries
+	if reads := counter.reads.Load(); reads == 0 || reads >= int64(reader.EntryCount()) {
+		t.Errorf("expected a number of reads in ]0, %d[, got '%d'", reader.EntryCount(), reads)
+	}
+
+	counter.reads.Store(0)
+
+	if _, err := fsys.WithContext(context.Background()).Open("__does_not_exist__"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error '%v', got '%v'", fs.ErrNotExist, err)
+	}
+
+	if reads := counter.reads.Load(); reads != 0 {
+		t.Errorf("expected the miss to be cached, got '%d' reads", reads)
+	}
+
+	fsys = New(reader, WithNamespaces(zim.V5NamespaceMetadata))
+
+	if _, err := fs.Stat(fsys, "Title"); err != nil {
+		t.Errorf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := fs.Stat(fsys, "Tuisblad"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected error '%v', got '%v'", fs.ErrNotExist, err)
+	}
+}
+
+type countingReaderAt struct {
+	zim.ReadAtCloser
+	reads atomic.Int64
+}
+
+func (r *countingReaderAt) ReadAt(data []byte, offset int64) (int, error) {
+	r.reads.Add(1)
+	return r.ReadAtCloser.ReadAt(data, offset)
+}
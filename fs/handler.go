@@ -0,0 +1,201 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	iofs "io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+	"gitlab.com/wpetit/goweb/logger"
+)
+
+type HandlerOptions struct {
+	// BasePath is the path under which the archive is served, without
+	// trailing slash.
+	BasePath string
+
+	// RedirectStatus is the HTTP status code of the redirections to the
+	// canonical URL of an entry.
+	RedirectStatus int
+}
+
+type HandlerOptionFunc func(opts *HandlerOptions)
+
+func NewHandlerOptions(funcs ...HandlerOptionFunc) *HandlerOptions {
+	funcs = append([]HandlerOptionFunc{
+		WithRedirectStatus(http.StatusFound),
+	}, funcs...)
+
+	opts := &HandlerOptions{}
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+// WithBasePath sets the path under which the archive is served, such as
+// "/content/wikipedia".
+func WithBasePath(basePath string) HandlerOptionFunc {
+	return func(opts *HandlerOptions) {
+		opts.BasePath = strings.TrimSuffix(basePath, "/")
+	}
+}
+
+// WithRedirectStatus sets the HTTP status code of the redirections,
+// http.StatusFound by default.
+func WithRedirectStatus(status int) HandlerOptionFunc {
+	return func(opts *HandlerOptions) {
+		opts.RedirectStatus = status
+	}
+}
+
+// Handler serves the entries of an archive over HTTP. Redirect entries and
+// aliases, such as names without namespace, are answered with an HTTP
+// redirect to the canonical URL of their target, so that relative links
+// keep working. Content entries are served with their mime type and an
+// ETag derived from the archive UUID and the entry index. Directories are
+// listed as with http.FileServer.
+//
+// The file system must expose the whole archive, not a sub directory.
+type Handler struct {
+	fs   *FS
+	opts *HandlerOptions
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, ok := h.name(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	fs := h.fs.WithContext(r.Context())
+
+	if name == "" {
+		name = indexName
+	}
+
+	entry, isDir, err := fs.resolve(strings.TrimSuffix(name, "/"))
+	if err != nil {
+		if errors.Is(err, zim.ErrNotFound) {
+			if name == indexName {
+				// Archives without main page are listed instead
+				h.serveDirectory(w, r, fs)
+				return
+			}
+
+			http.NotFound(w, r)
+			return
+		}
+
+		h.serveError(w, r, err)
+		return
+	}
+
+	if isDir {
+		h.serveDirectory(w, r, fs)
+		return
+	}
+
+	content, err := entry.Redirect()
+	if err != nil {
+		h.serveError(w, r, err)
+		return
+	}
+
+	// Aliases and names with a trailing slash are redirected, as relative
+	// links are resolved from the request URL
+	if content.FullURL() != name {
+		h.serveRedirect(w, r, content)
+		return
+	}
+
+	h.serveContent(w, r, fs, content)
+}
+
+// name returns the name designated by the given request path, relative to
+// the base path.
+func (h *Handler) name(requestPath string) (string, bool) {
+	rest, ok := strings.CutPrefix(requestPath, h.opts.BasePath)
+	if !ok {
+		return "", false
+	}
+
+	if rest == "" || rest == "/" {
+		return "", true
+	}
+
+	name, ok := strings.CutPrefix(rest, "/")
+	if !ok || !iofs.ValidPath(strings.TrimSuffix(name, "/")) {
+		return "", false
+	}
+
+	return name, true
+}
+
+func (h *Handler) serveRedirect(w http.ResponseWriter, r *http.Request, content *zim.ContentEntry) {
+	target := &url.URL{Path: h.opts.BasePath + "/" + content.FullURL()}
+
+	http.Redirect(w, r, target.String(), h.opts.RedirectStatus)
+}
+
+func (h *Handler) serveContent(w http.ResponseWriter, r *http.Request, fs *FS, content *zim.ContentEntry) {
+	blob, err := content.ReaderContext(r.Context())
+	if err != nil {
+		h.serveError(w, r, err)
+		return
+	}
+
+	defer blob.Close()
+
+	header := w.Header()
+	header.Set("Content-Type", content.MimeType())
+	header.Set("ETag", ETag(fs.reader, content))
+
+	// The Content-Type header being set, the content is not sniffed
+	http.ServeContent(w, r, content.URL(), fs.modTime, blob)
+}
+
+func (h *Handler) serveDirectory(w http.ResponseWriter, r *http.Request, fs *FS) {
+	fileServer := http.StripPrefix(h.opts.BasePath, http.FileServer(http.FS(fs)))
+	fileServer.ServeHTTP(w, r)
+}
+
+func (h *Handler) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The client is gone, there is nobody to answer to
+		return
+	}
+
+	logger.Error(r.Context(), "could not serve entry", logger.E(errors.WithStack(err)), logger.F("path", r.URL.Path))
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// ETag returns the strong entity tag of the given content entry, derived
+// from the archive UUID and the entry index.
+func ETag(reader *zim.Reader, content *zim.ContentEntry) string {
+	return fmt.Sprintf(`"%s-%d"`, reader.UUID(), content.Index())
+}
+
+// NewHandler returns a Handler serving the entries of the given file
+// system.
+func NewHandler(fs *FS, funcs ...HandlerOptionFunc) *Handler {
+	return &Handler{
+		fs:   fs,
+		opts: NewHandlerOptions(funcs...),
+	}
+}
+
+var _ http.Handler = &Handler{}
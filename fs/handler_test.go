@@ -0,0 +1,107 @@
+package fs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+func TestHandler(t *testing.T) {
+	reader, err := zim.Open("../testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	mainPage, err := reader.EntryWithFullURL("A/Main_Page")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	content, err := mainPage.Redirect()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	etag := ETag(reader, content)
+
+	handler := NewHandler(New(reader), WithBasePath("/content/test/"))
+
+	type testCase struct {
+		Method           string
+		Path             string
+		Header           http.Header
+		ExpectedStatus   int
+		ExpectedLocation string
+		ExpectedType     string
+		ExpectedETag     string
+		ExpectedBody     string
+	}
+
+	testCases := []testCase{
+		{Path: "/content/test/A/Main_Page", ExpectedStatus: http.StatusOK, ExpectedType: "text/html", ExpectedETag: etag, ExpectedBody: "<html"},
+		{Path: "/content/test/I/logo.svg", ExpectedStatus: http.StatusOK, ExpectedType: "image/svg+xml"},
+		{Path: "/content/test/A/Index", ExpectedStatus: http.StatusFound, ExpectedLocation: "/content/test/A/Main_Page"},
+		{Path: "/content/test/Main_Page", ExpectedStatus: http.StatusFound, ExpectedLocation: "/content/test/A/Main_Page"},
+		{Path: "/content/test/A/Main_Page/", ExpectedStatus: http.StatusFound, ExpectedLocation: "/content/test/A/Main_Page"},
+		{Path: "/content/test/", ExpectedStatus: http.StatusFound, ExpectedLocation: "/content/test/A/Main_Page"},
+		{Path: "/content/test", ExpectedStatus: http.StatusFound, ExpectedLocation: "/content/test/A/Main_Page"},
+		{Path: "/content/test/A/", ExpectedStatus: http.StatusOK, ExpectedBody: "Main_Page"},
+		{Path: "/content/test/A/Main_Page", Header: http.Header{"If-None-Match": {etag}}, ExpectedStatus: http.StatusNotModified},
+		{Path: "/content/test/A/Does_Not_Exist", ExpectedStatus: http.StatusNotFound},
+		{Path: "/content/other/A/Main_Page", ExpectedStatus: http.StatusNotFound},
+		{Method: http.MethodPost, Path: "/content/test/A/Main_Page", ExpectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		method := tc.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+
+		req := httptest.NewRequest(method, tc.Path, nil)
+		for key, values := range tc.Header {
+			req.Header[key] = values
+		}
+
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if e, g := tc.ExpectedStatus, res.Code; e != g {
+			t.Errorf("%s %s: expected status '%d', got '%d'", method, tc.Path, e, g)
+			continue
+		}
+
+		if e, g := tc.ExpectedLocation, res.Header().Get("Location"); e != g {
+			t.Errorf("%s %s: expected location '%s', got '%s'", method, tc.Path, e, g)
+		}
+
+		if e, g := tc.ExpectedType, res.Header().Get("Content-Type"); e != "" && e != g {
+			t.Errorf("%s %s: expected content type '%s', got '%s'", method, tc.Path, e, g)
+		}
+
+		if e, g := tc.ExpectedETag, res.Header().Get("ETag"); e != "" && e != g {
+			t.Errorf("%s %s: expected etag '%s', got '%s'", method, tc.Path, e, g)
+		}
+
+		if e := tc.ExpectedBody; !strings.Contains(string(body), e) {
+			t.Errorf("%s %s: expected body to contain '%s'", method, tc.Path, e)
+		}
+	}
+}
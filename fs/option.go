@@ -0,0 +1,61 @@
+package fs
+
+import (
+	"time"
+
+	"github.com/Bornholm/go-zim"
+)
+
+type Options struct {
+	// ModTime is the modification time of the files and directories. If
+	// zero, it is derived from the "Date" metadata of the archive, or from
+	// the modification time of the archive file.
+	ModTime time.Time
+
+	// Namespaces is the search order of the namespaces when opening a name
+	// which is not prefixed by its namespace, such as "Main_Page". If nil,
+	// the content namespaces of the v6 or v5 layout are used, depending on
+	// the archive.
+	Namespaces []zim.Namespace
+
+	// NegativeCacheSize is the maximum number of names which could not be
+	// resolved kept in memory, so that repeated misses do not hit the
+	// archive. A value lower or equal to zero disables the cache.
+	NegativeCacheSize int
+}
+
+type OptionFunc func(opts *Options)
+
+func NewOptions(funcs ...OptionFunc) *Options {
+	funcs = append([]OptionFunc{
+		WithNegativeCacheSize(1024),
+	}, funcs...)
+
+	opts := &Options{}
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+// WithModTime sets the modification time of the files and directories.
+func WithModTime(modTime time.Time) OptionFunc {
+	return func(opts *Options) {
+		opts.ModTime = modTime
+	}
+}
+
+// WithNamespaces sets the search order of the namespaces when opening a
+// name which is not prefixed by its namespace.
+func WithNamespaces(namespaces ...zim.Namespace) OptionFunc {
+	return func(opts *Options) {
+		opts.Namespaces = namespaces
+	}
+}
+
+func WithNegativeCacheSize(size int) OptionFunc {
+	return func(opts *Options) {
+		opts.NegativeCacheSize = size
+	}
+}
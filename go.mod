@@ -9,6 +9,7 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/ulikunitz/xz v0.5.11
 	gitlab.com/wpetit/goweb v0.0.0-20231215190137-4a8add1d3d07
+	golang.org/x/text v0.11.0
 )
 
 require (
@@ -0,0 +1,238 @@
+package index
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+// BuildProgressFunc is called while the index is being built with the
+// number of entries already visited and the total number of entries.
+type BuildProgressFunc func(visited int, total int)
+
+type BuildOptions struct {
+	// MaxTermLength is the maximum length in bytes of the indexed terms,
+	// longer terms are ignored.
+	MaxTermLength int
+	OnProgress    BuildProgressFunc
+}
+
+type BuildOptionFunc func(opts *BuildOptions)
+
+func NewBuildOptions(funcs ...BuildOptionFunc) *BuildOptions {
+	funcs = append([]BuildOptionFunc{
+		WithMaxTermLength(64),
+	}, funcs...)
+
+	opts := &BuildOptions{}
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+func WithMaxTermLength(length int) BuildOptionFunc {
+	return func(opts *BuildOptions) {
+		opts.MaxTermLength = length
+	}
+}
+
+func WithBuildProgress(fn BuildProgressFunc) BuildOptionFunc {
+	return func(opts *BuildOptions) {
+		opts.OnProgress = fn
+	}
+}
+
+type posting struct {
+	doc  uint32
+	freq uint32
+}
+
+// Build indexes the text/html content entries of the archive and writes
+// the index to the given writer.
+func Build(ctx context.Context, reader *zim.Reader, w io.Writer, funcs ...BuildOptionFunc) error {
+	opts := NewBuildOptions(funcs...)
+
+	docs := make([]document, 0)
+	postings := make(map[string][]posting)
+	total := int(reader.EntryCount())
+
+	it := reader.Entries()
+
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(it.Index()+1, total)
+		}
+
+		content, ok := it.Entry().(*zim.ContentEntry)
+		if !ok || !strings.HasPrefix(content.MimeType(), "text/html") {
+			continue
+		}
+
+		text, err := entryText(content)
+		if err != nil {
+			return errors.Wrapf(err, "could not extract text of entry '%s'", content.FullURL())
+		}
+
+		freqs := make(map[string]uint32)
+		length := uint32(0)
+
+		for _, term := range zim.Tokenize(content.Title() + " " + text) {
+			if len(term) > opts.MaxTermLength {
+				continue
+			}
+
+			freqs[term]++
+			length++
+		}
+
+		if length == 0 {
+			continue
+		}
+
+		doc := uint32(len(docs))
+		docs = append(docs, document{entryIndex: uint32(it.Index()), length: length})
+
+		for term, freq := range freqs {
+			postings[term] = append(postings[term], posting{doc: doc, freq: freq})
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := encode(w, reader.UUID(), docs, postings); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// BuildFile builds the index of the archive in the given directory and
+// returns the path of the index file.
+func BuildFile(ctx context.Context, reader *zim.Reader, dir string, funcs ...BuildOptionFunc) (string, error) {
+	path := filepath.Join(dir, Filename(reader.UUID()))
+
+	file, err := os.CreateTemp(dir, Filename(reader.UUID())+".*.tmp")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	defer os.Remove(file.Name())
+
+	if err := Build(ctx, reader, file, funcs...); err != nil {
+		file.Close()
+		return "", errors.WithStack(err)
+	}
+
+	if err := file.Close(); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return path, nil
+}
+
+func entryText(entry *zim.ContentEntry) (string, error) {
+	blob, err := entry.Reader()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	defer blob.Close()
+
+	text, err := zim.ExtractText(blob)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return text, nil
+}
+
+// encode writes the index: a header with the archive UUID, the document
+// table and the term dictionary, followed by the delta encoded posting
+// lists in dictionary order.
+func encode(w io.Writer, uuid string, docs []document, postings map[string][]posting) error {
+	buffered := bufio.NewWriter(w)
+
+	terms := make([]string, 0, len(postings))
+	for term := range postings {
+		terms = append(terms, term)
+	}
+
+	sort.Strings(terms)
+
+	encoded := make([][]byte, len(terms))
+	for i, term := range terms {
+		encoded[i] = encodePostings(postings[term])
+	}
+
+	buffered.WriteString(magic)
+	buffered.WriteByte(formatVersion)
+	writeString(buffered, uuid)
+	writeUvarint(buffered, uint64(len(docs)))
+
+	for _, d := range docs {
+		writeUvarint(buffered, uint64(d.entryIndex))
+		writeUvarint(buffered, uint64(d.length))
+	}
+
+	writeUvarint(buffered, uint64(len(terms)))
+
+	for i, term := range terms {
+		writeString(buffered, term)
+		writeUvarint(buffered, uint64(len(postings[term])))
+		writeUvarint(buffered, uint64(len(encoded[i])))
+	}
+
+	for _, data := range encoded {
+		buffered.Write(data)
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func encodePostings(postings []posting) []byte {
+	data := make([]byte, 0, len(postings)*2)
+	previous := uint32(0)
+
+	for _, p := range postings {
+		data = binary.AppendUvarint(data, uint64(p.doc-previous))
+		data = binary.AppendUvarint(data, uint64(p.freq))
+		previous = p.doc
+	}
+
+	return data
+}
+
+func writeUvarint(w *bufio.Writer, value uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, value)
+	w.Write(buf[:n])
+}
+
+func writeString(w *bufio.Writer, s string) {
+	writeUvarint(w, uint64(len(s)))
+	w.WriteString(s)
+}
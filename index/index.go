@@ -0,0 +1,328 @@
+// Package index builds and queries a side-car full-text index for ZIM
+// archives which do not embed a Xapian database.
+//
+// The index is a compact inverted index stored in a single file, named
+// after the UUID of the archive. Its dictionary and document table are
+// loaded in memory, posting lists are read from the file on demand.
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	magic         = "ZIMIDX"
+	formatVersion = 1
+	fileExtension = ".zimidx"
+
+	// maxPreallocated caps the number of documents and terms allocated
+	// upfront when decoding the header, the larger tables growing as they
+	// are read.
+	maxPreallocated = 1 << 16
+)
+
+var ErrInvalidIndex = errors.New("invalid index")
+
+// Filename returns the name of the index file of the archive with the
+// given UUID.
+func Filename(uuid string) string {
+	return uuid + fileExtension
+}
+
+type document struct {
+	// entryIndex is the index of the entry in the URL pointer list of the
+	// archive.
+	entryIndex uint32
+	length     uint32
+}
+
+type termInfo struct {
+	docFreq uint32
+	offset  uint64
+	size    uint64
+}
+
+type ReadAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+type Index struct {
+	uuid        string
+	docs        []document
+	totalLength uint64
+	terms       map[string]termInfo
+
+	postings       io.ReaderAt
+	postingsOffset int64
+	// postingsSize is the total size of the posting lists, as given by the
+	// term table.
+	postingsSize uint64
+	closer       io.Closer
+}
+
+// UUID returns the UUID of the archive the index was built from.
+func (i *Index) UUID() string {
+	return i.uuid
+}
+
+// DocumentCount returns the number of indexed entries.
+func (i *Index) DocumentCount() int {
+	return len(i.docs)
+}
+
+func (i *Index) Close() error {
+	if i.closer == nil {
+		return nil
+	}
+
+	if err := i.closer.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (i *Index) averageLength() float64 {
+	if len(i.docs) == 0 {
+		return 0
+	}
+
+	return float64(i.totalLength) / float64(len(i.docs))
+}
+
+// readPostings returns the documents containing the given term, with the
+// term frequency in each of them.
+func (i *Index) readPostings(term string) ([]posting, error) {
+	info, exists := i.terms[term]
+	if !exists {
+		return nil, nil
+	}
+
+	data := make([]byte, info.size)
+	if _, err := i.postings.ReadAt(data, i.postingsOffset+int64(info.offset)); err != nil {
+		return nil, errors.Wrapf(err, "could not read postings of term '%s'", term)
+	}
+
+	// A term can not appear in more documents than the index holds
+	postings := make([]posting, 0, min(uint64(info.docFreq), uint64(len(i.docs))))
+	doc := uint64(0)
+
+	for len(data) > 0 {
+		delta, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.Wrapf(ErrInvalidIndex, "invalid postings of term '%s'", term)
+		}
+
+		data = data[n:]
+
+		freq, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.Wrapf(ErrInvalidIndex, "invalid postings of term '%s'", term)
+		}
+
+		data = data[n:]
+		doc += delta
+
+		if doc >= uint64(len(i.docs)) {
+			return nil, errors.Wrapf(ErrInvalidIndex, "document '%d' out of bounds in postings of term '%s'", doc, term)
+		}
+
+		postings = append(postings, posting{doc: uint32(doc), freq: uint32(freq)})
+	}
+
+	return postings, nil
+}
+
+// Load reads an index from the given reader. The reader must stay
+// readable as long as the index is used. The sizes of the posting lists are
+// only checked against the size of the file by Open.
+func Load(r ReadAtCloser) (*Index, error) {
+	counter := &countingReader{reader: bufio.NewReader(io.NewSectionReader(r, 0, 1<<62))}
+
+	index, err := decodeHeader(counter)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	index.postings = r
+	index.postingsOffset = counter.count
+	index.closer = r
+
+	return index, nil
+}
+
+// Open opens the index file at the given path.
+func Open(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	index, err := Load(file)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "could not load index '%s'", path)
+	}
+
+	// The posting lists are read on demand, their sizes are checked upfront
+	// as they size the buffers they are read in
+	if available := uint64(info.Size() - index.postingsOffset); index.postingsOffset > info.Size() || index.postingsSize > available {
+		index.Close()
+		return nil, errors.Wrapf(ErrInvalidIndex, "could not load index '%s': posting lists of '%d' bytes exceed the file", path, index.postingsSize)
+	}
+
+	return index, nil
+}
+
+// OpenFor opens the index of the archive with the given UUID in the given
+// directory.
+func OpenFor(dir string, uuid string) (*Index, error) {
+	index, err := Open(filepath.Join(dir, Filename(uuid)))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if index.UUID() != uuid {
+		index.Close()
+		return nil, errors.Wrapf(ErrInvalidIndex, "index was built for archive '%s', expected '%s'", index.UUID(), uuid)
+	}
+
+	return index, nil
+}
+
+func decodeHeader(r *countingReader) (*Index, error) {
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if string(header[:len(magic)]) != magic {
+		return nil, errors.Wrap(ErrInvalidIndex, "invalid magic")
+	}
+
+	if version := header[len(magic)]; version != formatVersion {
+		return nil, errors.Wrapf(ErrInvalidIndex, "unsupported format version '%d'", version)
+	}
+
+	uuid, err := readString(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	docCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The counts come from the file, they are not trusted to preallocate
+	// the documents and terms
+	index := &Index{
+		uuid: uuid,
+		docs: make([]document, 0, min(docCount, maxPreallocated)),
+	}
+
+	for d := uint64(0); d < docCount; d++ {
+		entryIndex, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		index.docs = append(index.docs, document{entryIndex: uint32(entryIndex), length: uint32(length)})
+		index.totalLength += length
+	}
+
+	termCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	index.terms = make(map[string]termInfo, min(termCount, maxPreallocated))
+	offset := uint64(0)
+
+	for t := uint64(0); t < termCount; t++ {
+		term, err := readString(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		docFreq, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if offset+size < offset {
+			return nil, errors.Wrapf(ErrInvalidIndex, "size '%d' of the postings of term '%s' overflows", size, term)
+		}
+
+		index.terms[term] = termInfo{docFreq: uint32(docFreq), offset: offset, size: size}
+		offset += size
+	}
+
+	index.postingsSize = offset
+
+	return index, nil
+}
+
+func readString(r io.ByteReader) (string, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if size > 1<<16 {
+		return "", errors.Wrapf(ErrInvalidIndex, "string size '%d' too large", size)
+	}
+
+	data := make([]byte, size)
+	for i := range data {
+		if data[i], err = r.ReadByte(); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+
+	return string(data), nil
+}
+
+type countingReader struct {
+	reader *bufio.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.count++
+	}
+
+	return b, err
+}
@@ -0,0 +1,151 @@
+package index
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+func TestIndex(t *testing.T) {
+	reader, err := zim.Open("../testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	visited := 0
+
+	if _, err := BuildFile(ctx, reader, dir, WithBuildProgress(func(v, total int) { visited = v })); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := int(reader.EntryCount()), visited; e != g {
+		t.Errorf("visited entries: expected '%d', got '%d'", e, g)
+	}
+
+	index, err := OpenFor(dir, reader.UUID())
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := index.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	if e, g := 3, index.DocumentCount(); e != g {
+		t.Errorf("index.DocumentCount(): expected '%d', got '%d'", e, g)
+	}
+
+	type testCase struct {
+		Query    string
+		Expected []string
+	}
+
+	testCases := []testCase{
+		{Query: "lorem", Expected: []string{"A/Main_Page"}},
+		{Query: "Clusters compressed", Expected: []string{"A/Compression"}},
+		{Query: "compression", Expected: []string{"A/Compression", "A/Main_Page"}},
+		{Query: "CRÈME", Expected: []string{"A/Diacritics"}},
+		{Query: "lorem compressed", Expected: []string{}},
+		{Query: "", Expected: []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Query, func(t *testing.T) {
+			results, err := index.Search(ctx, reader, tc.Query)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := len(tc.Expected), results.Total; e != g {
+				t.Fatalf("results.Total: expected '%d', got '%d'", e, g)
+			}
+
+			for i, url := range tc.Expected {
+				if e, g := url, results.Results[i].Entry.FullURL(); e != g {
+					t.Errorf("results.Results[%d].Entry.FullURL(): expected '%s', got '%s'", i, e, g)
+				}
+
+				if results.Results[i].Snippet == "" {
+					t.Errorf("results.Results[%d].Snippet should not be empty", i)
+				}
+			}
+		})
+	}
+
+	other, err := zim.Open("../testdata/go-zim_test_bzip2_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer other.Close()
+
+	if _, err := index.Search(ctx, other, "lorem"); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("expected ErrInvalidIndex error, got '%v'", err)
+	}
+
+	if _, err := OpenFor(dir, other.UUID()); err == nil {
+		t.Errorf("expected an error opening a missing index")
+	}
+}
+
+func TestOpenCorrupted(t *testing.T) {
+	header := func() []byte {
+		data := append([]byte(magic), formatVersion)
+		data = binary.AppendUvarint(data, uint64(len("corrupted")))
+		return append(data, "corrupted"...)
+	}
+
+	term := func(data []byte, docFreq uint64, size uint64) []byte {
+		data = binary.AppendUvarint(data, uint64(len("term")))
+		data = append(data, "term"...)
+		data = binary.AppendUvarint(data, docFreq)
+		return binary.AppendUvarint(data, size)
+	}
+
+	// A single document of entry 0 and length 1
+	document := func(data []byte) []byte {
+		data = binary.AppendUvarint(data, 1)
+		data = binary.AppendUvarint(data, 0)
+		return binary.AppendUvarint(data, 1)
+	}
+
+	testCases := map[string][]byte{
+		// Header announcing far more documents than the file holds
+		"DocumentCount": binary.AppendUvarint(header(), 1<<62),
+		// Posting list larger than the file
+		"PostingsSize": append(term(binary.AppendUvarint(document(header()), 1), 1, 1<<40), 0, 1),
+		// Posting list sizes overflowing once summed
+		"PostingsOverflow": term(term(binary.AppendUvarint(document(header()), 2), 1, math.MaxUint64), 1, 2),
+	}
+
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), Filename("corrupted"))
+
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if _, err := Open(path); err == nil {
+				t.Errorf("expected an error on a corrupted index")
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package index
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+// Search returns the entries of the given archive containing all the words
+// of the query, ranked with BM25.
+func (i *Index) Search(ctx context.Context, reader *zim.Reader, query string, funcs ...zim.SearchOptionFunc) (*zim.SearchResults, error) {
+	opts := zim.NewSearchOptions(funcs...)
+
+	if reader.UUID() != i.uuid {
+		return nil, errors.Wrapf(ErrInvalidIndex, "index was built for archive '%s', not '%s'", i.uuid, reader.UUID())
+	}
+
+	terms := uniqueTerms(zim.Tokenize(query))
+	if len(terms) == 0 {
+		return &zim.SearchResults{Results: make([]zim.SearchResult, 0)}, nil
+	}
+
+	scores := make(map[uint32]float64)
+	bm25 := zim.BM25{DocCount: uint64(len(i.docs)), AvgDocLength: i.averageLength()}
+
+	for idx, term := range terms {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		postings, err := i.readPostings(term)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		matched := make(map[uint32]float64, len(postings))
+
+		for _, p := range postings {
+			score, exists := scores[p.doc]
+			if idx > 0 && !exists {
+				continue
+			}
+
+			matched[p.doc] = score + bm25.Weight(uint64(len(postings)), p.freq, i.docs[p.doc].length)
+		}
+
+		scores = matched
+		if len(scores) == 0 {
+			break
+		}
+	}
+
+	ranked := make([]uint32, 0, len(scores))
+	for doc := range scores {
+		ranked = append(ranked, doc)
+	}
+
+	sort.Slice(ranked, func(a, b int) bool {
+		if scores[ranked[a]] != scores[ranked[b]] {
+			return scores[ranked[a]] > scores[ranked[b]]
+		}
+
+		return ranked[a] < ranked[b]
+	})
+
+	results := &zim.SearchResults{
+		Total:   len(ranked),
+		Results: make([]zim.SearchResult, 0),
+	}
+
+	if opts.Offset >= len(ranked) {
+		return results, nil
+	}
+
+	ranked = ranked[opts.Offset:]
+	if opts.Limit > 0 && len(ranked) > opts.Limit {
+		ranked = ranked[:opts.Limit]
+	}
+
+	for _, doc := range ranked {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		entry, err := reader.EntryAt(int(i.docs[doc].entryIndex))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		result := zim.SearchResult{
+			Entry: entry,
+			Score: scores[doc],
+		}
+
+		if opts.SnippetSize > 0 {
+			snippet, err := snippet(entry, terms, opts.SnippetSize)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			result.Snippet = snippet
+		}
+
+		results.Results = append(results.Results, result)
+	}
+
+	return results, nil
+}
+
+func uniqueTerms(terms []string) []string {
+	unique := make([]string, 0, len(terms))
+	seen := make(map[string]struct{}, len(terms))
+
+	for _, t := range terms {
+		if _, exists := seen[t]; exists {
+			continue
+		}
+
+		seen[t] = struct{}{}
+		unique = append(unique, t)
+	}
+
+	return unique
+}
+
+func snippet(entry zim.Entry, terms []string, size int) (string, error) {
+	content, err := entry.Redirect()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if !strings.HasPrefix(content.MimeType(), "text/html") {
+		return "", nil
+	}
+
+	text, err := entryText(content)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return zim.Snippet(text, terms, size), nil
+}
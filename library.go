@@ -0,0 +1,585 @@
+package zim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/pkg/errors"
+	"gitlab.com/wpetit/goweb/logger"
+)
+
+type LibraryOptions struct {
+	// MaxOpenReaders is the maximum number of idle readers kept open. The
+	// least recently used ones are closed first, readers in use being closed
+	// once released.
+	MaxOpenReaders int
+
+	// ReaderOptions are the options of the readers opened by the library.
+	ReaderOptions []OptionFunc
+}
+
+type LibraryOptionFunc func(opts *LibraryOptions)
+
+func NewLibraryOptions(funcs ...LibraryOptionFunc) *LibraryOptions {
+	funcs = append([]LibraryOptionFunc{
+		WithLibraryMaxOpenReaders(16),
+	}, funcs...)
+
+	opts := &LibraryOptions{}
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+func WithLibraryMaxOpenReaders(max int) LibraryOptionFunc {
+	return func(opts *LibraryOptions) {
+		opts.MaxOpenReaders = max
+	}
+}
+
+func WithLibraryReaderOptions(funcs ...OptionFunc) LibraryOptionFunc {
+	return func(opts *LibraryOptions) {
+		opts.ReaderOptions = funcs
+	}
+}
+
+// LibraryArchive describes an archive of a Library.
+type LibraryArchive struct {
+	Path    string
+	UUID    string
+	Name    string
+	Flavour string
+	// Date is the "Date" metadata of the archive, the zero time if it is
+	// missing or invalid.
+	Date time.Time
+	// ModTime and Size are the modification time and size of the archive
+	// file, or of its parts for split archives.
+	ModTime time.Time
+	Size    int64
+}
+
+// newerThan returns true if the archive should be preferred to the given
+// one when both have the same name.
+func (a *LibraryArchive) newerThan(other *LibraryArchive) bool {
+	if !a.Date.Equal(other.Date) {
+		return a.Date.After(other.Date)
+	}
+
+	if !a.ModTime.Equal(other.ModTime) {
+		return a.ModTime.After(other.ModTime)
+	}
+
+	return a.Path < other.Path
+}
+
+// libraryFile is an archive file found by the library.
+type libraryFile struct {
+	archive LibraryArchive
+	// err is the error met when reading the archive, which is not retried
+	// until the file changes.
+	err error
+}
+
+// sharedReader is an open reader of the library, closed once evicted and
+// released by all its users.
+type sharedReader struct {
+	reader  *Reader
+	refs    int
+	evicted bool
+
+	// valuesMutex is held while a value is built, not to build it twice.
+	valuesMutex sync.Mutex
+	values      map[any]any
+}
+
+// Library manages the archives of a set of directories and archive files.
+// Readers are opened on demand, shared between callers and closed when idle
+// for too long, following an LRU policy. The archives added, removed or
+// replaced in the directories are taken into account by Refresh(), which
+// can be called periodically with Watch().
+//
+// A Library is safe for concurrent use.
+type Library struct {
+	paths []string
+	opts  *LibraryOptions
+
+	// refreshMutex serializes the refreshes, which read the archives
+	// without holding mutex.
+	refreshMutex sync.Mutex
+
+	mutex   sync.Mutex
+	files   map[string]*libraryFile
+	byUUID  map[string]*libraryFile
+	byName  map[string][]*libraryFile
+	readers *lru.Cache[string, *sharedReader]
+	closed  bool
+}
+
+// LibraryReader is a reader acquired from a Library. Close releases it
+// instead of closing the underlying archive, which may be shared.
+type LibraryReader struct {
+	*Reader
+	archive LibraryArchive
+	shared  *sharedReader
+	release func()
+	once    sync.Once
+}
+
+// Archive returns the description of the archive of the reader.
+func (r *LibraryReader) Archive() LibraryArchive {
+	return r.archive
+}
+
+// Value returns the value stored with the shared reader for the given key,
+// built with the given function on first use. Values are dropped with the
+// shared reader, once it is evicted or its archive replaced, and must not
+// be used after Close.
+func (r *LibraryReader) Value(key any, build func(reader *Reader) any) any {
+	r.shared.valuesMutex.Lock()
+	defer r.shared.valuesMutex.Unlock()
+
+	if value, exists := r.shared.values[key]; exists {
+		return value
+	}
+
+	if r.shared.values == nil {
+		r.shared.values = make(map[any]any)
+	}
+
+	value := build(r.Reader)
+	r.shared.values[key] = value
+
+	return value
+}
+
+// Close releases the reader. It must not be used afterwards.
+func (r *LibraryReader) Close() error {
+	r.once.Do(r.release)
+	return nil
+}
+
+// Archives returns the archives of the library which could be read, ordered
+// by name, newest first.
+func (l *Library) Archives() []LibraryArchive {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	archives := make([]LibraryArchive, 0, len(l.byUUID))
+
+	for _, files := range l.byName {
+		for _, f := range files {
+			archives = append(archives, f.archive)
+		}
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		if archives[i].Name != archives[j].Name {
+			return archives[i].Name < archives[j].Name
+		}
+
+		return archives[i].newerThan(&archives[j])
+	})
+
+	return archives
+}
+
+// OpenByUUID returns a reader of the archive with the given UUID.
+func (l *Library) OpenByUUID(uuid string) (*LibraryReader, error) {
+	l.mutex.Lock()
+	file, exists := l.byUUID[uuid]
+	l.mutex.Unlock()
+
+	if !exists {
+		return nil, errors.Wrapf(ErrNotFound, "could not find archive '%s'", uuid)
+	}
+
+	return l.acquire(file)
+}
+
+// OpenByName returns a reader of the newest archive with the given "Name"
+// metadata, whatever its flavour.
+func (l *Library) OpenByName(name string) (*LibraryReader, error) {
+	return l.openNewest(name, func(f *libraryFile) bool {
+		return true
+	})
+}
+
+// OpenByNameFlavour returns a reader of the newest archive with the given
+// "Name" and "Flavour" metadata. An empty flavour designates the archives
+// without flavour.
+func (l *Library) OpenByNameFlavour(name string, flavour string) (*LibraryReader, error) {
+	return l.openNewest(name, func(f *libraryFile) bool {
+		return f.archive.Flavour == flavour
+	})
+}
+
+func (l *Library) openNewest(name string, match func(f *libraryFile) bool) (*LibraryReader, error) {
+	var newest *libraryFile
+
+	l.mutex.Lock()
+
+	// Files are ordered newest first
+	for _, f := range l.byName[name] {
+		if match(f) {
+			newest = f
+			break
+		}
+	}
+
+	l.mutex.Unlock()
+
+	if newest == nil {
+		return nil, errors.Wrapf(ErrNotFound, "could not find archive named '%s'", name)
+	}
+
+	return l.acquire(newest)
+}
+
+func (l *Library) acquire(file *libraryFile) (*LibraryReader, error) {
+	archive := file.archive
+
+	l.mutex.Lock()
+
+	if l.closed {
+		l.mutex.Unlock()
+		return nil, errors.New("library is closed")
+	}
+
+	shared, exists := l.readers.Get(archive.Path)
+	if exists {
+		shared.refs++
+		l.mutex.Unlock()
+
+		return l.newLibraryReader(archive, shared), nil
+	}
+
+	l.mutex.Unlock()
+
+	// Archives are opened without holding the lock, as parsing their
+	// indexes takes time
+	reader, err := Open(archive.Path, l.opts.ReaderOptions...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if reader.UUID() != archive.UUID {
+		reader.Close()
+		return nil, errors.Wrapf(ErrNotFound, "archive '%s' was replaced", archive.Path)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		reader.Close()
+		return nil, errors.New("library is closed")
+	}
+
+	// The archive may have been opened concurrently
+	if shared, exists := l.readers.Get(archive.Path); exists {
+		reader.Close()
+		shared.refs++
+
+		return l.newLibraryReader(archive, shared), nil
+	}
+
+	shared = &sharedReader{reader: reader, refs: 1}
+	l.readers.Add(archive.Path, shared)
+
+	return l.newLibraryReader(archive, shared), nil
+}
+
+func (l *Library) newLibraryReader(archive LibraryArchive, shared *sharedReader) *LibraryReader {
+	return &LibraryReader{
+		Reader:  shared.reader,
+		archive: archive,
+		shared:  shared,
+		release: func() {
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+
+			shared.refs--
+
+			if shared.refs == 0 && shared.evicted {
+				closeSharedReader(archive.Path, shared)
+			}
+		},
+	}
+}
+
+// onEvict is called with the library mutex held, when a reader leaves the
+// LRU cache.
+func (l *Library) onEvict(path string, shared *sharedReader) {
+	shared.evicted = true
+
+	if shared.refs == 0 {
+		closeSharedReader(path, shared)
+	}
+}
+
+func closeSharedReader(path string, shared *sharedReader) {
+	if err := shared.reader.Close(); err != nil {
+		logger.Warn(context.Background(), "could not close archive", logger.F("path", path), logger.E(errors.WithStack(err)))
+	}
+}
+
+// Refresh scans the directories of the library again. New archives are
+// read, readers of removed or replaced archives are closed once released.
+// Archives which can not be read are skipped until they change.
+func (l *Library) Refresh(ctx context.Context) error {
+	l.refreshMutex.Lock()
+	defer l.refreshMutex.Unlock()
+
+	paths, err := l.scan()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	l.mutex.Lock()
+	previous := l.files
+	l.mutex.Unlock()
+
+	files := make(map[string]*libraryFile, len(paths))
+
+	for _, path := range paths {
+		modTime, size, err := archiveFileStat(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Removed during the scan
+				continue
+			}
+
+			return errors.WithStack(err)
+		}
+
+		if file, exists := previous[path]; exists && file.archive.ModTime.Equal(modTime) && file.archive.Size == size {
+			files[path] = file
+			continue
+		}
+
+		file := &libraryFile{}
+
+		file.archive, file.err = readLibraryArchive(ctx, path, l.opts.ReaderOptions)
+		if file.err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return errors.WithStack(ctxErr)
+			}
+
+			logger.Warn(ctx, "could not read archive", logger.F("path", path), logger.E(file.err))
+		}
+
+		file.archive.Path = path
+		file.archive.ModTime = modTime
+		file.archive.Size = size
+
+		files[path] = file
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for path, file := range l.files {
+		if files[path] != file {
+			// Removed or replaced, the reader is closed once released
+			l.readers.Remove(path)
+		}
+	}
+
+	l.files = files
+	l.index()
+
+	return nil
+}
+
+// index rebuilds the lookup maps of the library. The mutex must be held.
+func (l *Library) index() {
+	l.byUUID = make(map[string]*libraryFile, len(l.files))
+	l.byName = make(map[string][]*libraryFile)
+
+	for _, file := range l.files {
+		if file.err != nil {
+			continue
+		}
+
+		if existing, exists := l.byUUID[file.archive.UUID]; !exists || file.archive.newerThan(&existing.archive) {
+			l.byUUID[file.archive.UUID] = file
+		}
+
+		l.byName[file.archive.Name] = append(l.byName[file.archive.Name], file)
+	}
+
+	for _, files := range l.byName {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].archive.newerThan(&files[j].archive)
+		})
+	}
+}
+
+// scan returns the paths of the archives of the library, the archive files
+// it was given and the archives found in its directories. Missing paths are
+// skipped, as they may appear later.
+func (l *Library) scan() ([]string, error) {
+	paths := make([]string, 0)
+	seen := make(map[string]struct{})
+
+	add := func(path string) {
+		path = filepath.Clean(path)
+
+		if _, exists := seen[path]; !exists {
+			seen[path] = struct{}{}
+			paths = append(paths, path)
+		}
+	}
+
+	for _, path := range l.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, errors.WithStack(err)
+		}
+
+		if !info.IsDir() {
+			add(path)
+			continue
+		}
+
+		for _, pattern := range []string{"*" + splitExtension, "*" + firstSplitExtension} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			for _, m := range matches {
+				add(m)
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// Watch refreshes the library at the given interval, until the given
+// context is done. Refresh errors are logged.
+func (l *Library) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Refresh(ctx); err != nil && ctx.Err() == nil {
+				logger.Error(ctx, "could not refresh library", logger.E(errors.WithStack(err)))
+			}
+		}
+	}
+}
+
+// Close closes the idle readers of the library. Readers in use are closed
+// once released.
+func (l *Library) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.closed = true
+	l.readers.Purge()
+
+	return nil
+}
+
+// archiveFileStat returns the modification time and size of the archive at
+// the given path, the most recent modification time and the total size of
+// its parts if it is split.
+func archiveFileStat(path string) (time.Time, int64, error) {
+	partPaths, err := splitPartPaths(path)
+	if err != nil {
+		return time.Time{}, 0, errors.WithStack(err)
+	}
+
+	if partPaths == nil {
+		partPaths = []string{path}
+	}
+
+	var (
+		modTime time.Time
+		size    int64
+	)
+
+	for _, p := range partPaths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}, 0, errors.WithStack(err)
+		}
+
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+
+		size += info.Size()
+	}
+
+	return modTime, size, nil
+}
+
+func readLibraryArchive(ctx context.Context, path string, funcs []OptionFunc) (LibraryArchive, error) {
+	reader, err := Open(path, funcs...)
+	if err != nil {
+		return LibraryArchive{}, errors.WithStack(err)
+	}
+
+	defer reader.Close()
+
+	metadata, err := reader.MetadataContext(ctx, MetadataName, MetadataFlavour, MetadataDate)
+	if err != nil {
+		return LibraryArchive{}, errors.WithStack(err)
+	}
+
+	archive := LibraryArchive{
+		UUID:    reader.UUID(),
+		Name:    metadata[MetadataName],
+		Flavour: metadata[MetadataFlavour],
+	}
+
+	if date, err := time.Parse(time.DateOnly, metadata[MetadataDate]); err == nil {
+		archive.Date = date
+	}
+
+	return archive, nil
+}
+
+// NewLibrary returns a library of the given archive files and of the
+// archives of the given directories, scanned a first time.
+func NewLibrary(paths []string, funcs ...LibraryOptionFunc) (*Library, error) {
+	opts := NewLibraryOptions(funcs...)
+
+	library := &Library{
+		paths: paths,
+		opts:  opts,
+		files: make(map[string]*libraryFile),
+	}
+
+	readers, err := lru.NewWithEvict[string, *sharedReader](max(opts.MaxOpenReaders, 1), library.onEvict)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	library.readers = readers
+	library.index()
+
+	if err := library.Refresh(context.Background()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return library, nil
+}
@@ -0,0 +1,175 @@
+package library
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+// Book describes an archive of the library.
+type Book struct {
+	// ID is the UUID of the archive.
+	ID string
+	// Path is the path of the archive file, if known.
+	Path string
+
+	Name        string
+	Title       string
+	Description string
+	Creator     string
+	Publisher   string
+	Flavour     string
+	// Date is the publication date of the archive, formatted as
+	// YYYY-MM-DD.
+	Date string
+	// Languages are the ISO 639-3 codes of the languages of the archive.
+	Languages []string
+	Tags      zim.Tags
+
+	// ArticleCount is the number of HTML entries of the archive, or its
+	// number of entries if it does not provide the "Counter" metadata.
+	ArticleCount uint64
+	// MediaCount is the number of image, audio and video entries of the
+	// archive.
+	MediaCount uint64
+	// Size is the size of the archive in bytes.
+	Size int64
+
+	// URL is the URL from which the archive can be downloaded, if known.
+	URL string
+	// IndexPath is the path of a full-text index of the archive, if any,
+	// and IndexType its type.
+	IndexPath string
+	IndexType string
+
+	// Favicon is the content of the illustration of the archive, nil if it
+	// has none.
+	Favicon         []byte
+	FaviconMimeType string
+}
+
+// NewBook returns the Book describing the archive read by the given reader.
+func NewBook(ctx context.Context, reader *zim.Reader) (*Book, error) {
+	metadata, err := reader.ArchiveMetadataContext(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	book := &Book{
+		ID:           reader.UUID(),
+		Name:         metadata.Name,
+		Title:        metadata.Title,
+		Description:  metadata.Description,
+		Creator:      metadata.Creator,
+		Publisher:    metadata.Publisher,
+		Flavour:      metadata.Flavour,
+		Languages:    metadata.Languages,
+		Tags:         metadata.Tags,
+		ArticleCount: uint64(reader.EntryCount()),
+		Size:         reader.Size(),
+	}
+
+	if !metadata.Date.IsZero() {
+		book.Date = metadata.Date.Format(time.DateOnly)
+	}
+
+	if len(metadata.Counter) > 0 {
+		book.ArticleCount, book.MediaCount = metadata.Counter.ArticleCount(), metadata.Counter.MediaCount()
+	}
+
+	favicon, err := reader.Favicon()
+	if err != nil && !errors.Is(err, zim.ErrNotFound) {
+		return nil, errors.WithStack(err)
+	}
+
+	if favicon != nil {
+		if err := book.readFavicon(ctx, favicon); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return book, nil
+}
+
+func (b *Book) readFavicon(ctx context.Context, favicon *zim.ContentEntry) error {
+	reader, err := favicon.ReaderContext(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	b.Favicon = data
+
+	// Illustrations of the metadata namespace are not always given an image
+	// mime type
+	b.FaviconMimeType = favicon.MimeType()
+	if !strings.HasPrefix(b.FaviconMimeType, "image/") {
+		b.FaviconMimeType = http.DetectContentType(data)
+	}
+
+	return nil
+}
+
+// HasTag returns true if the book has the given tag, ignoring case.
+func (b *Book) HasTag(tag string) bool {
+	for _, t := range b.Tags.List() {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasLanguage returns true if the book is in the given language.
+func (b *Book) HasLanguage(lang string) bool {
+	for _, l := range b.Languages {
+		if strings.EqualFold(l, lang) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContentName returns the name under which the content of the book is
+// served, the filename of the archive without extension, or the name of
+// the book if its path is unknown.
+func (b *Book) ContentName() string {
+	if b.Path == "" {
+		return b.Name
+	}
+
+	name := filepath.Base(b.Path)
+
+	for _, ext := range []string{".zimaa", ".zim"} {
+		if trimmed, found := strings.CutSuffix(name, ext); found {
+			return trimmed
+		}
+	}
+
+	return name
+}
+
+// Updated returns the publication date of the book, the zero time if it is
+// unknown.
+func (b *Book) Updated() time.Time {
+	date, err := time.Parse(time.DateOnly, b.Date)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return date
+}
@@ -0,0 +1,299 @@
+// Package library describes collections of ZIM archives and publishes them
+// as an OPDS catalog compatible with the Kiwix clients.
+package library
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+// Catalog is a collection of books. It is safe for concurrent use.
+type Catalog struct {
+	mutex sync.RWMutex
+	books []*Book
+	byID  map[string]*Book
+}
+
+// Books returns the books of the catalog, ordered by title.
+func (c *Catalog) Books() []*Book {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	books := make([]*Book, len(c.books))
+	copy(books, c.books)
+
+	return books
+}
+
+// Book returns the book with the given ID.
+func (c *Catalog) Book(id string) (*Book, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	book, exists := c.byID[id]
+
+	return book, exists
+}
+
+// Set replaces the books of the catalog. Books with the same ID as a
+// previous one replace it.
+func (c *Catalog) Set(books ...*Book) {
+	byID := make(map[string]*Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+
+	sorted := make([]*Book, 0, len(byID))
+	for _, b := range byID {
+		sorted = append(sorted, b)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Title != sorted[j].Title {
+			return sorted[i].Title < sorted[j].Title
+		}
+
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.books = sorted
+	c.byID = byID
+}
+
+// Filter selects books of a catalog. Empty fields do not filter anything.
+type Filter struct {
+	// Languages selects the books in any of the given languages.
+	Languages []string
+	// Tags selects the books having all the given tags.
+	Tags []string
+	// Category selects the books of the given category.
+	Category string
+	// Name selects the books with the given name.
+	Name string
+	// Query selects the books whose title or description contains all the
+	// words of the query, ignoring case.
+	Query string
+}
+
+// Match returns true if the given book is selected by the filter.
+func (f *Filter) Match(book *Book) bool {
+	if len(f.Languages) > 0 {
+		matches := false
+
+		for _, lang := range f.Languages {
+			if book.HasLanguage(lang) {
+				matches = true
+				break
+			}
+		}
+
+		if !matches {
+			return false
+		}
+	}
+
+	for _, tag := range f.Tags {
+		if !book.HasTag(tag) {
+			return false
+		}
+	}
+
+	if f.Category != "" && !strings.EqualFold(book.Tags.Category(), f.Category) {
+		return false
+	}
+
+	if f.Name != "" && book.Name != f.Name {
+		return false
+	}
+
+	if f.Query != "" {
+		text := strings.ToLower(book.Title + " " + book.Description)
+
+		for _, word := range strings.Fields(strings.ToLower(f.Query)) {
+			if !strings.Contains(text, word) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Search returns the books of the catalog selected by the given filter,
+// ordered by title.
+func (c *Catalog) Search(filter *Filter) []*Book {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	books := make([]*Book, 0)
+
+	for _, b := range c.books {
+		if filter.Match(b) {
+			books = append(books, b)
+		}
+	}
+
+	return books
+}
+
+// Languages returns the languages of the books of the catalog with their
+// number of books.
+func (c *Catalog) Languages() map[string]int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	languages := make(map[string]int)
+
+	for _, b := range c.books {
+		for _, lang := range b.Languages {
+			languages[lang]++
+		}
+	}
+
+	return languages
+}
+
+// Categories returns the categories of the books of the catalog with their
+// number of books.
+func (c *Catalog) Categories() map[string]int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	categories := make(map[string]int)
+
+	for _, b := range c.books {
+		if category := b.Tags.Category(); category != "" {
+			categories[category]++
+		}
+	}
+
+	return categories
+}
+
+// NewCatalog returns a catalog of the given books.
+func NewCatalog(books ...*Book) *Catalog {
+	catalog := &Catalog{}
+	catalog.Set(books...)
+
+	return catalog
+}
+
+// Scan returns the catalog of the archives of the given directory.
+// Archives which can not be read are skipped.
+func Scan(ctx context.Context, dir string) (*Catalog, error) {
+	catalog := NewCatalog()
+
+	if err := catalog.Rescan(ctx, dir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return catalog, nil
+}
+
+// Rescan replaces the books of the catalog with the archives of the given
+// directory.
+func (c *Catalog) Rescan(ctx context.Context, dir string) error {
+	library, err := zim.NewLibrary([]string{dir}, zim.WithLibraryMaxOpenReaders(1))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer library.Close()
+
+	if err := c.Sync(ctx, library); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Sync replaces the books of the catalog with the archives of the given
+// library. The books of the archives already in the catalog, with the same
+// path and UUID, are kept as is, the other archives are opened to build
+// their book.
+func (c *Catalog) Sync(ctx context.Context, library *zim.Library) error {
+	previous := make(map[string]*Book)
+	for _, b := range c.Books() {
+		previous[b.Path] = b
+	}
+
+	archives := library.Archives()
+	books := make([]*Book, 0, len(archives))
+	seen := make(map[string]struct{}, len(archives))
+
+	for _, archive := range archives {
+		// Archives are ordered newest first, only the newest copy of an
+		// archive is opened by its UUID
+		if _, exists := seen[archive.UUID]; exists {
+			continue
+		}
+
+		seen[archive.UUID] = struct{}{}
+
+		if book, exists := previous[archive.Path]; exists && book.ID == archive.UUID {
+			books = append(books, book)
+			continue
+		}
+
+		book, err := libraryBook(ctx, library, archive)
+		if err != nil {
+			if errors.Is(err, zim.ErrNotFound) {
+				// Replaced since listed, the next sync will read it
+				continue
+			}
+
+			return errors.Wrapf(err, "could not read archive '%s'", archive.Path)
+		}
+
+		books = append(books, book)
+	}
+
+	c.Set(books...)
+
+	return nil
+}
+
+func libraryBook(ctx context.Context, library *zim.Library, archive zim.LibraryArchive) (*Book, error) {
+	reader, err := library.OpenByUUID(archive.UUID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer reader.Close()
+
+	book, err := NewBook(ctx, reader.Reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	book.Path = reader.Archive().Path
+
+	return book, nil
+}
+
+// OpenBook returns the Book describing the archive at the given path.
+func OpenBook(ctx context.Context, path string) (*Book, error) {
+	reader, err := zim.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer reader.Close()
+
+	book, err := NewBook(ctx, reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	book.Path = path
+
+	return book, nil
+}
@@ -0,0 +1,167 @@
+package library
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+func TestScan(t *testing.T) {
+	catalog, err := Scan(context.Background(), "../testdata")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	books := catalog.Books()
+
+	if e, g := 3, len(books); e != g {
+		t.Fatalf("len(books): expected '%d', got '%d'", e, g)
+	}
+
+	book, exists := catalog.Book("5f1c2e4a-9b7d-4c3e-8a21-6d0f3b9e7c12")
+	if !exists {
+		t.Fatalf("book should exist")
+	}
+
+	if e, g := "go-zim_test_zlib", book.Name; e != g {
+		t.Errorf("book.Name: expected '%s', got '%s'", e, g)
+	}
+
+	if e, g := "go-zim_test_zlib_2024-01", book.ContentName(); e != g {
+		t.Errorf("book.ContentName(): expected '%s', got '%s'", e, g)
+	}
+
+	if e, g := []string{"eng"}, book.Languages; !reflect.DeepEqual(e, g) {
+		t.Errorf("book.Languages: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "test", book.Tags.Category(); e != g {
+		t.Errorf("book.Tags.Category(): expected '%s', got '%s'", e, g)
+	}
+
+	if book.Tags.HasPictures() {
+		t.Errorf("book.Tags.HasPictures(): expected 'false'")
+	}
+
+	if e, g := uint64(13), book.ArticleCount; e != g {
+		t.Errorf("book.ArticleCount: expected '%d', got '%d'", e, g)
+	}
+
+	if book.Favicon != nil {
+		t.Errorf("book.Favicon: expected nil")
+	}
+
+	for _, b := range books {
+		if b.Name != "wikibooks_af_all" {
+			continue
+		}
+
+		if e, g := "image/png", b.FaviconMimeType; e != g {
+			t.Errorf("b.FaviconMimeType: expected '%s', got '%s'", e, g)
+		}
+
+		if e, g := 5365, len(b.Favicon); e != g {
+			t.Errorf("len(b.Favicon): expected '%d', got '%d'", e, g)
+		}
+	}
+}
+
+func TestCatalogSearch(t *testing.T) {
+	catalog, err := Scan(context.Background(), "../testdata")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	type testCase struct {
+		Name     string
+		Filter   *Filter
+		Expected []string
+	}
+
+	testCases := []testCase{
+		{
+			Name:     "All",
+			Filter:   &Filter{},
+			Expected: []string{"go-zim_test_bzip2", "go-zim_test_zlib", "wikibooks_af_all"},
+		},
+		{
+			Name:     "Language",
+			Filter:   &Filter{Languages: []string{"fra", "afr"}},
+			Expected: []string{"wikibooks_af_all"},
+		},
+		{
+			Name:     "Tags",
+			Filter:   &Filter{Tags: []string{"_pictures:no", "_videos:no"}},
+			Expected: []string{"go-zim_test_bzip2", "go-zim_test_zlib"},
+		},
+		{
+			Name:     "Category",
+			Filter:   &Filter{Category: "wikibooks"},
+			Expected: []string{"wikibooks_af_all"},
+		},
+		{
+			Name:     "Query",
+			Filter:   &Filter{Query: "ZLIB archive"},
+			Expected: []string{"go-zim_test_zlib"},
+		},
+		{
+			Name:     "NoMatch",
+			Filter:   &Filter{Languages: []string{"eng"}, Category: "wikibooks"},
+			Expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			names := make([]string, 0)
+			for _, b := range catalog.Search(tc.Filter) {
+				names = append(names, b.Name)
+			}
+
+			if e, g := tc.Expected, names; !reflect.DeepEqual(e, g) {
+				t.Errorf("names: expected '%v', got '%v'", e, g)
+			}
+		})
+	}
+}
+
+func TestCatalogSync(t *testing.T) {
+	library, err := zim.NewLibrary([]string{"../testdata/go-zim_test_zlib_2024-01.zim"})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer library.Close()
+
+	catalog := NewCatalog()
+
+	if err := catalog.Sync(context.Background(), library); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	book, exists := catalog.Book("5f1c2e4a-9b7d-4c3e-8a21-6d0f3b9e7c12")
+	if !exists {
+		t.Fatalf("book should exist")
+	}
+
+	if e, g := "../testdata/go-zim_test_zlib_2024-01.zim", book.Path; e != g {
+		t.Errorf("book.Path: expected '%s', got '%s'", e, g)
+	}
+
+	// Books of unchanged archives are kept, with the information added to
+	// them
+	book.URL = "https://example.org/go-zim_test_zlib_2024-01.zim"
+
+	if err := catalog.Sync(context.Background(), library); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	synced, _ := catalog.Book(book.ID)
+
+	if e, g := book, synced; e != g {
+		t.Errorf("catalog.Book(): expected '%p', got '%p'", e, g)
+	}
+}
@@ -0,0 +1,450 @@
+package library
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+	"gitlab.com/wpetit/goweb/logger"
+)
+
+// defaultPageSize is the number of entries of the acquisition feeds when
+// the request does not give any.
+const defaultPageSize = 10
+
+type HandlerOptions struct {
+	// BasePath is the path under which the catalog and the contents are
+	// served, without trailing slash. The catalog itself is served under
+	// BasePath + "/catalog/".
+	BasePath string
+
+	// ContentURL returns the URL of the content of the given book, an
+	// empty string if it is not served.
+	ContentURL func(book *Book) string
+
+	// DownloadURL returns the URL from which the archive of the given book
+	// can be downloaded, an empty string if it can not.
+	DownloadURL func(book *Book) string
+}
+
+type HandlerOptionFunc func(opts *HandlerOptions)
+
+func NewHandlerOptions(funcs ...HandlerOptionFunc) *HandlerOptions {
+	opts := &HandlerOptions{}
+
+	funcs = append([]HandlerOptionFunc{
+		WithContentURL(func(book *Book) string {
+			return opts.BasePath + "/content/" + url.PathEscape(book.ContentName())
+		}),
+		WithDownloadURL(func(book *Book) string {
+			return book.URL
+		}),
+	}, funcs...)
+
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+// WithBasePath sets the path under which the catalog and the contents are
+// served, such as "/kiwix".
+func WithBasePath(basePath string) HandlerOptionFunc {
+	return func(opts *HandlerOptions) {
+		opts.BasePath = strings.TrimSuffix(basePath, "/")
+	}
+}
+
+// WithContentURL sets the function returning the URL of the content of a
+// book, BasePath + "/content/" + book.ContentName() by default.
+func WithContentURL(fn func(book *Book) string) HandlerOptionFunc {
+	return func(opts *HandlerOptions) {
+		opts.ContentURL = fn
+	}
+}
+
+// WithDownloadURL sets the function returning the download URL of the
+// archive of a book, book.URL by default.
+func WithDownloadURL(fn func(book *Book) string) HandlerOptionFunc {
+	return func(opts *HandlerOptions) {
+		opts.DownloadURL = fn
+	}
+}
+
+// Handler serves a catalog as an OPDS feed, following the endpoints of the
+// Kiwix servers:
+//
+//   - /catalog/v2/root.xml, the navigation feed of the catalog;
+//   - /catalog/v2/entries, the acquisition feed of the books, filtered with
+//     the "lang", "tag", "category", "name" and "q" parameters and paged
+//     with the "start" and "count" parameters;
+//   - /catalog/v2/entry/<id>, the entry of a book;
+//   - /catalog/v2/languages and /catalog/v2/categories, the navigation
+//     feeds of the languages and categories of the books;
+//   - /catalog/v2/illustration/<id>, the illustration of a book;
+//   - /catalog/v2/searchdescription.xml, the OpenSearch description of the
+//     entries feed.
+//
+// The v1 /catalog/root.xml and /catalog/search endpoints are served as
+// acquisition feeds too.
+type Handler struct {
+	catalog *Catalog
+	opts    *HandlerOptions
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, h.opts.BasePath+"/catalog/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	path = strings.TrimSuffix(path, "/")
+
+	switch {
+	case path == "v2/root.xml":
+		h.serveRoot(w, r)
+	case path == "v2/entries" || path == "search" || path == "root.xml":
+		h.serveEntries(w, r)
+	case path == "v2/languages":
+		h.serveLanguages(w, r)
+	case path == "v2/categories":
+		h.serveCategories(w, r)
+	case path == "v2/searchdescription.xml" || path == "searchdescription.xml":
+		h.serveSearchDescription(w, r)
+	case strings.HasPrefix(path, "v2/entry/"):
+		h.serveEntry(w, r, strings.TrimPrefix(path, "v2/entry/"))
+	case strings.HasPrefix(path, "v2/illustration/"):
+		h.serveIllustration(w, r, strings.TrimPrefix(path, "v2/illustration/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) serveRoot(w http.ResponseWriter, r *http.Request) {
+	books := h.catalog.Books()
+
+	feed := newFeed(feedID(h.catalogPath("v2/root.xml")), "OPDS Catalog Root", lastUpdated(books))
+	feed.Links = append(feed.Links, h.feedLinks(h.catalogPath("v2/root.xml"), navigationFeedType)...)
+
+	sections := []struct {
+		Path  string
+		Title string
+		Text  string
+	}{
+		{"v2/entries", "All entries", "All entries from this catalog."},
+		{"v2/categories", "List of categories", "List of all categories in this catalog."},
+		{"v2/languages", "List of languages", "List of all languages in this catalog."},
+	}
+
+	for _, s := range sections {
+		href := h.catalogPath(s.Path)
+		feedType := navigationFeedType
+		if s.Path == "v2/entries" {
+			feedType = acquisitionFeedType
+		}
+
+		feed.Entries = append(feed.Entries, entry{
+			ID:      feedID(href),
+			Title:   s.Title,
+			Updated: feed.Updated,
+			Content: &text{Type: "text", Value: s.Text},
+			Links:   []link{{Rel: relSubsection, Href: href, Type: feedType}},
+		})
+	}
+
+	h.writeXML(w, r, navigationFeedType, feed)
+}
+
+func (h *Handler) serveEntries(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r.URL.RawQuery)
+	if err != nil {
+		http.Error(w, "invalid query", http.StatusBadRequest)
+		return
+	}
+
+	start, err := intParam(query, "start", 0)
+	if err != nil || start < 0 {
+		http.Error(w, "invalid start", http.StatusBadRequest)
+		return
+	}
+
+	count, err := intParam(query, "count", defaultPageSize)
+	if err != nil {
+		http.Error(w, "invalid count", http.StatusBadRequest)
+		return
+	}
+
+	books := h.catalog.Search(filterFromQuery(query))
+
+	total := len(books)
+
+	// A negative count returns all the books, as with Kiwix
+	page := books[min(start, total):]
+	if count >= 0 {
+		page = page[:min(count, len(page))]
+	}
+
+	self := h.catalogPath("v2/entries")
+	if encoded := query.Encode(); encoded != "" {
+		self += "?" + encoded
+	}
+
+	title := "All Entries"
+	if len(query) > 0 {
+		title = "Filtered Entries"
+	}
+
+	feed := newFeed(feedID(self), title, lastUpdated(books))
+	feed.Links = append(feed.Links, h.feedLinks(self, acquisitionFeedType)...)
+	feed.TotalResults = &total
+	feed.StartIndex = &start
+	itemsPerPage := len(page)
+	feed.ItemsPerPage = &itemsPerPage
+
+	for _, b := range page {
+		feed.Entries = append(feed.Entries, h.bookEntry(b))
+	}
+
+	h.writeXML(w, r, acquisitionFeedType, feed)
+}
+
+func (h *Handler) serveEntry(w http.ResponseWriter, r *http.Request, id string) {
+	book, exists := h.catalog.Book(id)
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	entry := h.bookEntry(book)
+	entry.Xmlns = atomNamespace
+	entry.XmlnsDC = dcNamespace
+
+	h.writeXML(w, r, entryType, entry)
+}
+
+func (h *Handler) serveLanguages(w http.ResponseWriter, r *http.Request) {
+	books := h.catalog.Books()
+	languages := h.catalog.Languages()
+
+	self := h.catalogPath("v2/languages")
+
+	feed := newFeed(feedID(self), "List of languages", lastUpdated(books))
+	feed.Links = append(feed.Links, h.feedLinks(self, navigationFeedType)...)
+
+	for _, lang := range sortedKeys(languages) {
+		href := h.catalogPath("v2/entries") + "?" + url.Values{"lang": {lang}}.Encode()
+
+		feed.Entries = append(feed.Entries, entry{
+			ID:         feedID(href),
+			Title:      languageName(lang),
+			Updated:    feed.Updated,
+			DCLanguage: lang,
+			Count:      languages[lang],
+			Links:      []link{{Rel: relSubsection, Href: href, Type: acquisitionFeedType}},
+		})
+	}
+
+	h.writeXML(w, r, navigationFeedType, feed)
+}
+
+func (h *Handler) serveCategories(w http.ResponseWriter, r *http.Request) {
+	books := h.catalog.Books()
+	categories := h.catalog.Categories()
+
+	self := h.catalogPath("v2/categories")
+
+	feed := newFeed(feedID(self), "List of categories", lastUpdated(books))
+	feed.Links = append(feed.Links, h.feedLinks(self, navigationFeedType)...)
+
+	for _, category := range sortedKeys(categories) {
+		href := h.catalogPath("v2/entries") + "?" + url.Values{"category": {category}}.Encode()
+
+		feed.Entries = append(feed.Entries, entry{
+			ID:      feedID(href),
+			Title:   category,
+			Updated: feed.Updated,
+			Content: &text{Type: "text", Value: "All entries with category of '" + category + "'."},
+			Count:   categories[category],
+			Links:   []link{{Rel: relSubsection, Href: href, Type: acquisitionFeedType}},
+		})
+	}
+
+	h.writeXML(w, r, navigationFeedType, feed)
+}
+
+func (h *Handler) serveIllustration(w http.ResponseWriter, r *http.Request, id string) {
+	book, exists := h.catalog.Book(id)
+	if !exists || book.Favicon == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", book.FaviconMimeType)
+
+	http.ServeContent(w, r, "", book.Updated(), bytes.NewReader(book.Favicon))
+}
+
+func (h *Handler) serveSearchDescription(w http.ResponseWriter, r *http.Request) {
+	description := &openSearchDescription{
+		Xmlns:         openSearchNamespace,
+		ShortName:     "Search",
+		Description:   "Search for entries",
+		InputEncoding: "UTF-8",
+		URL: openSearchURL{
+			Type:     acquisitionFeedType,
+			Template: h.catalogPath("v2/entries") + "?q={searchTerms?}&lang={language?}&name={k:name?}&tag={k:tag?}&category={k:category?}&start={startIndex?}&count={count?}",
+		},
+	}
+
+	h.writeXML(w, r, openSearchType, description)
+}
+
+func (h *Handler) bookEntry(book *Book) entry {
+	updated := formatTime(book.Updated())
+
+	entry := entry{
+		ID:           "urn:uuid:" + book.ID,
+		Title:        book.Title,
+		Updated:      updated,
+		Summary:      book.Description,
+		Language:     strings.Join(book.Languages, ","),
+		Name:         book.Name,
+		Flavour:      book.Flavour,
+		Category:     book.Tags.Category(),
+		Tags:         strings.Join(book.Tags.List(), ";"),
+		ArticleCount: book.ArticleCount,
+		MediaCount:   book.MediaCount,
+		Issued:       updated,
+		Links:        make([]link, 0),
+	}
+
+	if book.Creator != "" {
+		entry.Author = &person{Name: book.Creator}
+	}
+
+	if book.Publisher != "" {
+		entry.Publisher = &person{Name: book.Publisher}
+	}
+
+	if book.Favicon != nil {
+		entry.Links = append(entry.Links, link{
+			Rel:  relThumbnail,
+			Href: h.catalogPath("v2/illustration/"+url.PathEscape(book.ID)) + "?size=48",
+			Type: book.FaviconMimeType + ";width=48;height=48;scale=1",
+		})
+	}
+
+	if href := h.opts.ContentURL(book); href != "" {
+		entry.Links = append(entry.Links, link{Type: "text/html", Href: href})
+	}
+
+	if href := h.opts.DownloadURL(book); href != "" {
+		entry.Links = append(entry.Links, link{Rel: relAcquisition, Type: zimType, Href: href, Length: book.Size})
+	}
+
+	return entry
+}
+
+func (h *Handler) feedLinks(self string, feedType string) []link {
+	return []link{
+		{Rel: relSelf, Href: self, Type: feedType},
+		{Rel: relStart, Href: h.catalogPath("v2/root.xml"), Type: navigationFeedType},
+		{Rel: relSearch, Href: h.catalogPath("v2/searchdescription.xml"), Type: openSearchType},
+	}
+}
+
+func (h *Handler) catalogPath(path string) string {
+	return h.opts.BasePath + "/catalog/" + path
+}
+
+func (h *Handler) writeXML(w http.ResponseWriter, r *http.Request, contentType string, data any) {
+	var buf bytes.Buffer
+
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(data); err != nil {
+		logger.Error(r.Context(), "could not encode feed", logger.E(errors.WithStack(err)), logger.F("path", r.URL.Path))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// filterFromQuery returns the filter given by the "lang", "tag",
+// "category", "name" and "q" parameters of a request. Languages are comma
+// separated and tags semicolon separated, as in the archive metadata.
+func filterFromQuery(query url.Values) *Filter {
+	filter := &Filter{
+		Languages: make([]string, 0),
+		Tags:      make([]string, 0),
+		Category:  query.Get("category"),
+		Name:      query.Get("name"),
+		Query:     query.Get("q"),
+	}
+
+	for _, value := range query["lang"] {
+		filter.Languages = append(filter.Languages, zim.ParseLanguages(value)...)
+	}
+
+	for _, value := range query["tag"] {
+		filter.Tags = append(filter.Tags, zim.ParseTags(value).List()...)
+	}
+
+	return filter
+}
+
+// parseQuery parses the given query string, semicolons separating tags and
+// not parameters.
+func parseQuery(rawQuery string) (url.Values, error) {
+	query, err := url.ParseQuery(strings.ReplaceAll(rawQuery, ";", "%3B"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return query, nil
+}
+
+func intParam(query url.Values, name string, defaultValue int) (int, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return value, nil
+}
+
+// NewHandler returns a Handler serving the given catalog.
+func NewHandler(catalog *Catalog, funcs ...HandlerOptionFunc) *Handler {
+	return &Handler{
+		catalog: catalog,
+		opts:    NewHandlerOptions(funcs...),
+	}
+}
+
+var _ http.Handler = &Handler{}
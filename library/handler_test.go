@@ -0,0 +1,226 @@
+package library
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestHandler(t *testing.T) {
+	catalog, err := Scan(context.Background(), "../testdata")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	handler := NewHandler(
+		catalog,
+		WithBasePath("/kiwix"),
+		WithDownloadURL(func(book *Book) string {
+			return "https://download.example.org/" + book.ContentName() + ".zim"
+		}),
+	)
+
+	type testCase struct {
+		Path                string
+		ExpectedStatus      int
+		ExpectedContentType string
+		ExpectedEntries     []string
+		ExpectedTotal       int
+	}
+
+	testCases := []testCase{
+		{
+			Path:                "/kiwix/catalog/v2/root.xml",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedContentType: navigationFeedType,
+			ExpectedEntries:     []string{"All entries", "List of categories", "List of languages"},
+		},
+		{
+			Path:                "/kiwix/catalog/v2/entries",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedContentType: acquisitionFeedType,
+			ExpectedEntries:     []string{"Test bzip2 archive", "Test zlib archive", "Wikibooks"},
+			ExpectedTotal:       3,
+		},
+		{
+			Path:                "/kiwix/catalog/v2/entries?lang=eng&start=1&count=5",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedContentType: acquisitionFeedType,
+			ExpectedEntries:     []string{"Test zlib archive"},
+			ExpectedTotal:       2,
+		},
+		{
+			Path:                "/kiwix/catalog/v2/entries?tag=_category:wikibooks;_pictures:yes",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedContentType: acquisitionFeedType,
+			ExpectedEntries:     []string{"Wikibooks"},
+			ExpectedTotal:       1,
+		},
+		{
+			Path:                "/kiwix/catalog/search?q=bzip2",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedContentType: acquisitionFeedType,
+			ExpectedEntries:     []string{"Test bzip2 archive"},
+			ExpectedTotal:       1,
+		},
+		{
+			Path:                "/kiwix/catalog/v2/languages",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedContentType: navigationFeedType,
+			ExpectedEntries:     []string{"Afrikaans", "English"},
+		},
+		{
+			Path:                "/kiwix/catalog/v2/categories",
+			ExpectedStatus:      http.StatusOK,
+			ExpectedContentType: navigationFeedType,
+			ExpectedEntries:     []string{"test", "wikibooks"},
+		},
+		{
+			Path:           "/kiwix/catalog/v2/entries?count=foo",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Path:           "/kiwix/catalog/v2/entry/unknown",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Path:           "/catalog/v2/root.xml",
+			ExpectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			if e, g := tc.ExpectedStatus, res.Code; e != g {
+				t.Fatalf("res.Code: expected '%d', got '%d'", e, g)
+			}
+
+			if tc.ExpectedStatus != http.StatusOK {
+				return
+			}
+
+			if e, g := tc.ExpectedContentType, res.Header().Get("Content-Type"); e != g {
+				t.Errorf("Content-Type: expected '%s', got '%s'", e, g)
+			}
+
+			var feed struct {
+				TotalResults int `xml:"totalResults"`
+				Entries      []struct {
+					Title string `xml:"title"`
+				} `xml:"entry"`
+			}
+
+			if err := xml.Unmarshal(res.Body.Bytes(), &feed); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			titles := make([]string, 0, len(feed.Entries))
+			for _, e := range feed.Entries {
+				titles = append(titles, e.Title)
+			}
+
+			if e, g := len(tc.ExpectedEntries), len(titles); e != g {
+				t.Fatalf("len(titles): expected '%d', got '%d' (%v)", e, g, titles)
+			}
+
+			for i := range titles {
+				if e, g := tc.ExpectedEntries[i], titles[i]; e != g {
+					t.Errorf("titles[%d]: expected '%s', got '%s'", i, e, g)
+				}
+			}
+
+			if e, g := tc.ExpectedTotal, feed.TotalResults; e != g {
+				t.Errorf("feed.TotalResults: expected '%d', got '%d'", e, g)
+			}
+		})
+	}
+}
+
+func TestHandlerEntry(t *testing.T) {
+	catalog, err := Scan(context.Background(), "../testdata")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	var wikibooks *Book
+	for _, b := range catalog.Books() {
+		if b.Name == "wikibooks_af_all" {
+			wikibooks = b
+		}
+	}
+
+	handler := NewHandler(catalog)
+
+	req := httptest.NewRequest(http.MethodGet, "/catalog/v2/entry/"+wikibooks.ID, nil)
+	res := httptest.NewRecorder()
+
+	handler.ServeHTTP(res, req)
+
+	if e, g := http.StatusOK, res.Code; e != g {
+		t.Fatalf("res.Code: expected '%d', got '%d'", e, g)
+	}
+
+	var entry struct {
+		XMLName  xml.Name `xml:"http://www.w3.org/2005/Atom entry"`
+		ID       string   `xml:"id"`
+		Name     string   `xml:"name"`
+		Flavour  string   `xml:"flavour"`
+		Language string   `xml:"language"`
+		Issued   string   `xml:"http://purl.org/dc/terms/ issued"`
+		Links    []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+	}
+
+	if err := xml.Unmarshal(res.Body.Bytes(), &entry); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "urn:uuid:"+wikibooks.ID, entry.ID; e != g {
+		t.Errorf("entry.ID: expected '%s', got '%s'", e, g)
+	}
+
+	if e, g := "maxi", entry.Flavour; e != g {
+		t.Errorf("entry.Flavour: expected '%s', got '%s'", e, g)
+	}
+
+	if e, g := "afr", entry.Language; e != g {
+		t.Errorf("entry.Language: expected '%s', got '%s'", e, g)
+	}
+
+	if e, g := "2023-06-02T00:00:00Z", entry.Issued; e != g {
+		t.Errorf("entry.Issued: expected '%s', got '%s'", e, g)
+	}
+
+	if e, g := 2, len(entry.Links); e != g {
+		t.Fatalf("len(entry.Links): expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := "/content/wikibooks_af_all_maxi_2023-06", entry.Links[1].Href; e != g {
+		t.Errorf("entry.Links[1].Href: expected '%s', got '%s'", e, g)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, entry.Links[0].Href, nil)
+	res = httptest.NewRecorder()
+
+	handler.ServeHTTP(res, req)
+
+	if e, g := http.StatusOK, res.Code; e != g {
+		t.Fatalf("res.Code: expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := "image/png", res.Header().Get("Content-Type"); e != g {
+		t.Errorf("Content-Type: expected '%s', got '%s'", e, g)
+	}
+}
@@ -0,0 +1,188 @@
+package library
+
+import (
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// See https://specs.opds.io/opds-1.2 and the Kiwix catalog at
+// https://wiki.kiwix.org/wiki/OPDS
+const (
+	atomNamespace       = "http://www.w3.org/2005/Atom"
+	dcNamespace         = "http://purl.org/dc/terms/"
+	openSearchNamespace = "http://a9.com/-/spec/opensearch/1.1/"
+	opdsNamespace       = "https://specs.opds.io/opds-1.2"
+	threadNamespace     = "http://purl.org/syndication/thread/1.0"
+)
+
+const (
+	acquisitionFeedType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	navigationFeedType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	entryType           = "application/atom+xml;type=entry;profile=opds-catalog"
+	openSearchType      = "application/opensearchdescription+xml"
+	zimType             = "application/x-zim"
+)
+
+const (
+	relSelf        = "self"
+	relStart       = "start"
+	relSearch      = "search"
+	relSubsection  = "subsection"
+	relThumbnail   = "http://opds-spec.org/image/thumbnail"
+	relAcquisition = "http://opds-spec.org/acquisition/open-access"
+)
+
+// Prefixed names are written as is by encoding/xml, the prefixes being
+// declared on the feed element.
+type feed struct {
+	XMLName         xml.Name `xml:"feed"`
+	Xmlns           string   `xml:"xmlns,attr"`
+	XmlnsDC         string   `xml:"xmlns:dc,attr"`
+	XmlnsOpenSearch string   `xml:"xmlns:opensearch,attr"`
+	XmlnsOPDS       string   `xml:"xmlns:opds,attr"`
+	XmlnsThread     string   `xml:"xmlns:thr,attr"`
+
+	ID           string  `xml:"id"`
+	Links        []link  `xml:"link"`
+	Title        string  `xml:"title"`
+	Updated      string  `xml:"updated"`
+	TotalResults *int    `xml:"opensearch:totalResults,omitempty"`
+	StartIndex   *int    `xml:"opensearch:startIndex,omitempty"`
+	ItemsPerPage *int    `xml:"opensearch:itemsPerPage,omitempty"`
+	Entries      []entry `xml:"entry"`
+}
+
+type entry struct {
+	// The namespaces are only declared by standalone entries
+	XMLName xml.Name `xml:"entry"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	XmlnsDC string   `xml:"xmlns:dc,attr,omitempty"`
+
+	ID           string  `xml:"id"`
+	Title        string  `xml:"title"`
+	Updated      string  `xml:"updated"`
+	Summary      string  `xml:"summary,omitempty"`
+	Content      *text   `xml:"content,omitempty"`
+	Language     string  `xml:"language,omitempty"`
+	Name         string  `xml:"name,omitempty"`
+	Flavour      string  `xml:"flavour,omitempty"`
+	Category     string  `xml:"category,omitempty"`
+	Tags         string  `xml:"tags,omitempty"`
+	ArticleCount uint64  `xml:"articleCount,omitempty"`
+	MediaCount   uint64  `xml:"mediaCount,omitempty"`
+	Author       *person `xml:"author,omitempty"`
+	Publisher    *person `xml:"publisher,omitempty"`
+	Issued       string  `xml:"dc:issued,omitempty"`
+	DCLanguage   string  `xml:"dc:language,omitempty"`
+	Count        int     `xml:"thr:count,omitempty"`
+	Links        []link  `xml:"link"`
+}
+
+type link struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type person struct {
+	Name string `xml:"name"`
+}
+
+type text struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// openSearchDescription describes the search endpoint of the catalog, see
+// https://github.com/dewitt/opensearch.
+type openSearchDescription struct {
+	XMLName       xml.Name      `xml:"OpenSearchDescription"`
+	Xmlns         string        `xml:"xmlns,attr"`
+	ShortName     string        `xml:"ShortName"`
+	Description   string        `xml:"Description"`
+	InputEncoding string        `xml:"InputEncoding"`
+	URL           openSearchURL `xml:"Url"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+func newFeed(id string, title string, updated time.Time) *feed {
+	return &feed{
+		Xmlns:           atomNamespace,
+		XmlnsDC:         dcNamespace,
+		XmlnsOpenSearch: openSearchNamespace,
+		XmlnsOPDS:       opdsNamespace,
+		XmlnsThread:     threadNamespace,
+		ID:              id,
+		Title:           title,
+		Updated:         formatTime(updated),
+		Links:           make([]link, 0),
+		Entries:         make([]entry, 0),
+	}
+}
+
+// languageName returns the name of the language with the given ISO 639-3
+// code, in that language, or the code itself if it is unknown.
+func languageName(code string) string {
+	tag, err := language.Parse(code)
+	if err != nil {
+		return code
+	}
+
+	if name := display.Self.Name(tag); name != "" {
+		return name
+	}
+
+	return code
+}
+
+// feedID returns a stable URN identifying the feed of the given path,
+// derived as a name based UUID.
+func feedID(path string) string {
+	sum := sha1.Sum([]byte(path))
+
+	// Version 5 and RFC 4122 variant
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// lastUpdated returns the most recent publication date of the given books.
+func lastUpdated(books []*Book) time.Time {
+	updated := time.Time{}
+
+	for _, b := range books {
+		if date := b.Updated(); date.After(updated) {
+			updated = date
+		}
+	}
+
+	return updated
+}
+
+// sortedKeys returns the keys of the given counts, ordered.
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
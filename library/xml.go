@@ -0,0 +1,289 @@
+package library
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+// libraryXMLVersion is the version of the library.xml files written by
+// kiwix-manage.
+const libraryXMLVersion = "20110515"
+
+// See https://wiki.kiwix.org/wiki/XML_library
+type xmlLibrary struct {
+	XMLName xml.Name  `xml:"library"`
+	Version string    `xml:"version,attr"`
+	Books   []xmlBook `xml:"book"`
+}
+
+type xmlBook struct {
+	ID              string `xml:"id,attr"`
+	Path            string `xml:"path,attr,omitempty"`
+	IndexPath       string `xml:"indexPath,attr,omitempty"`
+	IndexType       string `xml:"indexType,attr,omitempty"`
+	URL             string `xml:"url,attr,omitempty"`
+	Title           string `xml:"title,attr"`
+	Description     string `xml:"description,attr"`
+	Language        string `xml:"language,attr"`
+	Creator         string `xml:"creator,attr"`
+	Publisher       string `xml:"publisher,attr"`
+	Name            string `xml:"name,attr"`
+	Flavour         string `xml:"flavour,attr,omitempty"`
+	Tags            string `xml:"tags,attr"`
+	Date            string `xml:"date,attr"`
+	ArticleCount    string `xml:"articleCount,attr"`
+	MediaCount      string `xml:"mediaCount,attr"`
+	Size            string `xml:"size,attr"`
+	Favicon         string `xml:"favicon,attr,omitempty"`
+	FaviconMimeType string `xml:"faviconMimeType,attr,omitempty"`
+}
+
+// ReadXML reads the books of a Kiwix library.xml file. Paths are returned
+// as written in the file. Sizes being given in kilobytes, they are rounded.
+func ReadXML(r io.Reader) ([]*Book, error) {
+	var library xmlLibrary
+
+	if err := xml.NewDecoder(r).Decode(&library); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	books := make([]*Book, 0, len(library.Books))
+
+	for _, b := range library.Books {
+		book, err := b.book()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid book '%s'", b.ID)
+		}
+
+		books = append(books, book)
+	}
+
+	return books, nil
+}
+
+func (b *xmlBook) book() (*Book, error) {
+	if b.ID == "" {
+		return nil, errors.New("missing book id")
+	}
+
+	book := &Book{
+		ID:              b.ID,
+		Path:            b.Path,
+		IndexPath:       b.IndexPath,
+		IndexType:       b.IndexType,
+		URL:             b.URL,
+		Name:            b.Name,
+		Title:           b.Title,
+		Description:     b.Description,
+		Creator:         b.Creator,
+		Publisher:       b.Publisher,
+		Flavour:         b.Flavour,
+		Date:            b.Date,
+		Languages:       zim.ParseLanguages(b.Language),
+		Tags:            zim.ParseTags(b.Tags),
+		FaviconMimeType: b.FaviconMimeType,
+	}
+
+	var err error
+
+	if book.ArticleCount, err = parseUintAttr(b.ArticleCount); err != nil {
+		return nil, errors.Wrap(err, "invalid articleCount")
+	}
+
+	if book.MediaCount, err = parseUintAttr(b.MediaCount); err != nil {
+		return nil, errors.Wrap(err, "invalid mediaCount")
+	}
+
+	size, err := parseUintAttr(b.Size)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid size")
+	}
+
+	book.Size = int64(size) * 1024
+
+	if b.Favicon != "" {
+		favicon, err := base64.StdEncoding.DecodeString(b.Favicon)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid favicon")
+		}
+
+		book.Favicon = favicon
+	}
+
+	return book, nil
+}
+
+// WriteXML writes the given books as a Kiwix library.xml file.
+func WriteXML(w io.Writer, books []*Book) error {
+	library := xmlLibrary{
+		Version: libraryXMLVersion,
+		Books:   make([]xmlBook, 0, len(books)),
+	}
+
+	for _, b := range books {
+		book := xmlBook{
+			ID:              b.ID,
+			Path:            b.Path,
+			IndexPath:       b.IndexPath,
+			IndexType:       b.IndexType,
+			URL:             b.URL,
+			Title:           b.Title,
+			Description:     b.Description,
+			Language:        strings.Join(b.Languages, ","),
+			Creator:         b.Creator,
+			Publisher:       b.Publisher,
+			Name:            b.Name,
+			Flavour:         b.Flavour,
+			Tags:            strings.Join(b.Tags.List(), ";"),
+			Date:            b.Date,
+			ArticleCount:    strconv.FormatUint(b.ArticleCount, 10),
+			MediaCount:      strconv.FormatUint(b.MediaCount, 10),
+			Size:            strconv.FormatInt(b.Size/1024, 10),
+			FaviconMimeType: b.FaviconMimeType,
+		}
+
+		if b.Favicon != nil {
+			book.Favicon = base64.StdEncoding.EncodeToString(b.Favicon)
+		}
+
+		library.Books = append(library.Books, book)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.WithStack(err)
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(library); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Load returns the catalog of the books of the library.xml file at the
+// given path. Relative paths of archives and indexes are resolved from the
+// directory of the file.
+func Load(path string) (*Catalog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer file.Close()
+
+	books, err := ReadXML(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read library '%s'", path)
+	}
+
+	dir := filepath.Dir(path)
+
+	for _, b := range books {
+		b.Path = resolvePath(dir, b.Path)
+		b.IndexPath = resolvePath(dir, b.IndexPath)
+	}
+
+	return NewCatalog(books...), nil
+}
+
+// Save writes the books of the catalog to the library.xml file at the given
+// path, replacing it atomically. Paths of archives and indexes located
+// under the directory of the file are written relative to it.
+func (c *Catalog) Save(path string) error {
+	dir := filepath.Dir(path)
+
+	books := c.Books()
+	for i, b := range books {
+		relative := *b
+		relative.Path = relativePath(dir, b.Path)
+		relative.IndexPath = relativePath(dir, b.IndexPath)
+		books[i] = &relative
+	}
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer os.Remove(file.Name())
+
+	// Temporary files are only readable by their owner
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return errors.WithStack(err)
+	}
+
+	if err := WriteXML(file, books); err != nil {
+		file.Close()
+		return errors.WithStack(err)
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func parseUintAttr(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return parsed, nil
+}
+
+func resolvePath(dir string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
+
+func relativePath(dir string, path string) string {
+	if path == "" {
+		return path
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return path
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	relative, err := filepath.Rel(absDir, absPath)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return absPath
+	}
+
+	return relative
+}
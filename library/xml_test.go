@@ -0,0 +1,160 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Bornholm/go-zim"
+	"github.com/pkg/errors"
+)
+
+func TestReadXML(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8" ?>
+<library version="20110515">
+  <book id="a3b4d2a0-1f0e-4c11-9f63-2f6e1c7e2d10"
+        path="wikipedia_en_all_maxi_2024-01.zim"
+        url="https://download.kiwix.org/zim/wikipedia/wikipedia_en_all_maxi_2024-01.zim.meta4"
+        title="Wikipedia" description="The free encyclopedia" language="eng,fra"
+        creator="Wikipedia" publisher="Kiwix" name="wikipedia_en_all" flavour="maxi"
+        tags="wikipedia;_category:wikipedia;_pictures:yes" date="2024-01-15"
+        articleCount="6795088" mediaCount="5974385" size="112064584"
+        favicon="iVBORw0KGgo=" faviconMimeType="image/png" origId="ignored"></book>
+</library>`
+
+	books, err := ReadXML(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	expected := &Book{
+		ID:              "a3b4d2a0-1f0e-4c11-9f63-2f6e1c7e2d10",
+		Path:            "wikipedia_en_all_maxi_2024-01.zim",
+		URL:             "https://download.kiwix.org/zim/wikipedia/wikipedia_en_all_maxi_2024-01.zim.meta4",
+		Name:            "wikipedia_en_all",
+		Title:           "Wikipedia",
+		Description:     "The free encyclopedia",
+		Creator:         "Wikipedia",
+		Publisher:       "Kiwix",
+		Flavour:         "maxi",
+		Date:            "2024-01-15",
+		Languages:       []string{"eng", "fra"},
+		Tags:            zim.ParseTags("wikipedia;_category:wikipedia;_pictures:yes"),
+		ArticleCount:    6795088,
+		MediaCount:      5974385,
+		Size:            112064584 * 1024,
+		Favicon:         []byte("\x89PNG\r\n\x1a\n"),
+		FaviconMimeType: "image/png",
+	}
+
+	if e, g := 1, len(books); e != g {
+		t.Fatalf("len(books): expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := expected, books[0]; !reflect.DeepEqual(e, g) {
+		t.Errorf("books[0]: expected '%+v', got '%+v'", e, g)
+	}
+
+	if _, err := ReadXML(strings.NewReader(`<library><book id="foo" size="-1"/></library>`)); err == nil {
+		t.Errorf("expected an error on invalid size")
+	}
+}
+
+func TestWriteXML(t *testing.T) {
+	catalog, err := Scan(context.Background(), "../testdata")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	var buf bytes.Buffer
+
+	if err := WriteXML(&buf, catalog.Books()); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	books, err := ReadXML(&buf)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for i, b := range catalog.Books() {
+		// Sizes are written in kilobytes
+		b.Size = b.Size / 1024 * 1024
+
+		if e, g := b, books[i]; !reflect.DeepEqual(e, g) {
+			t.Errorf("books[%d]: expected '%+v', got '%+v'", i, e, g)
+		}
+	}
+
+	wikibooks := books[2]
+
+	if e, g := uint64(143), wikibooks.ArticleCount; e != g {
+		t.Errorf("wikibooks.ArticleCount: expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := uint64(99), wikibooks.MediaCount; e != g {
+		t.Errorf("wikibooks.MediaCount: expected '%d', got '%d'", e, g)
+	}
+}
+
+func TestCatalogSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	data, err := os.ReadFile("../testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	archive := filepath.Join(dir, "zim", "go-zim_test_zlib_2024-01.zim")
+
+	if err := os.MkdirAll(filepath.Dir(archive), 0o755); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := os.WriteFile(archive, data, 0o644); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	catalog, err := Scan(context.Background(), filepath.Dir(archive))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	libraryFile := filepath.Join(dir, "library.xml")
+
+	if err := catalog.Save(libraryFile); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	raw, err := os.ReadFile(libraryFile)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if !bytes.Contains(raw, []byte(`path="zim/go-zim_test_zlib_2024-01.zim"`)) {
+		t.Errorf("library file should contain the path of the archive relative to it, got '%s'", raw)
+	}
+
+	loaded, err := Load(libraryFile)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	books := loaded.Books()
+
+	if e, g := 1, len(books); e != g {
+		t.Fatalf("len(books): expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := archive, books[0].Path; e != g {
+		t.Errorf("books[0].Path: expected '%s', got '%s'", e, g)
+	}
+
+	if e, g := "Test zlib archive", books[0].Title; e != g {
+		t.Errorf("books[0].Title: expected '%s', got '%s'", e, g)
+	}
+}
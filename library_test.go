@@ -0,0 +1,327 @@
+package zim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func createLibraryTestArchive(t *testing.T, path string, uuid string, name string, flavour string, date string) {
+	t.Helper()
+
+	writer, err := Create(path, WithWriterUUID(uuid))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	metadata := map[MetadataKey]string{
+		MetadataName:    name,
+		MetadataFlavour: flavour,
+		MetadataDate:    date,
+	}
+
+	for key, value := range metadata {
+		if value == "" {
+			continue
+		}
+
+		if err := writer.AddMetadata(key, value); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	if err := writer.AddContent(V5NamespaceArticle, "Main_Page", "Main Page", "text/html", strings.NewReader("<html></html>")); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	dir := t.TempDir()
+
+	createLibraryTestArchive(t, filepath.Join(dir, "books_maxi_2024-01.zim"), "00000000-0000-4000-8000-000000000001", "books", "maxi", "2024-01-01")
+	createLibraryTestArchive(t, filepath.Join(dir, "books_maxi_2024-02.zim"), "00000000-0000-4000-8000-000000000002", "books", "maxi", "2024-02-01")
+	createLibraryTestArchive(t, filepath.Join(dir, "books_nopic_2024-03.zim"), "00000000-0000-4000-8000-000000000003", "books", "nopic", "2024-03-01")
+	createLibraryTestArchive(t, filepath.Join(dir, "other.zim"), "00000000-0000-4000-8000-000000000004", "other", "", "")
+
+	// Invalid archives are skipped
+	if err := os.WriteFile(filepath.Join(dir, "invalid.zim"), []byte("not an archive"), 0o644); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	library, err := NewLibrary([]string{dir}, WithLibraryMaxOpenReaders(2))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := library.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	if e, g := 4, len(library.Archives()); e != g {
+		t.Fatalf("len(library.Archives()): expected '%d', got '%d'", e, g)
+	}
+
+	type testCase struct {
+		Name         string
+		Open         func() (*LibraryReader, error)
+		ExpectedUUID string
+	}
+
+	testCases := []testCase{
+		{
+			Name:         "ByUUID",
+			Open:         func() (*LibraryReader, error) { return library.OpenByUUID("00000000-0000-4000-8000-000000000001") },
+			ExpectedUUID: "00000000-0000-4000-8000-000000000001",
+		},
+		{
+			Name:         "ByName",
+			Open:         func() (*LibraryReader, error) { return library.OpenByName("books") },
+			ExpectedUUID: "00000000-0000-4000-8000-000000000003",
+		},
+		{
+			Name:         "ByNameFlavour",
+			Open:         func() (*LibraryReader, error) { return library.OpenByNameFlavour("books", "maxi") },
+			ExpectedUUID: "00000000-0000-4000-8000-000000000002",
+		},
+		{
+			Name:         "ByNameWithoutFlavour",
+			Open:         func() (*LibraryReader, error) { return library.OpenByNameFlavour("other", "") },
+			ExpectedUUID: "00000000-0000-4000-8000-000000000004",
+		},
+		{
+			Name: "UnknownUUID",
+			Open: func() (*LibraryReader, error) { return library.OpenByUUID("00000000-0000-4000-8000-000000000099") },
+		},
+		{
+			Name: "UnknownFlavour",
+			Open: func() (*LibraryReader, error) { return library.OpenByNameFlavour("books", "mini") },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			reader, err := tc.Open()
+
+			if tc.ExpectedUUID == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected ErrNotFound, got '%v'", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer reader.Close()
+
+			if e, g := tc.ExpectedUUID, reader.UUID(); e != g {
+				t.Errorf("reader.UUID(): expected '%s', got '%s'", e, g)
+			}
+
+			if _, err := reader.EntryWithURL(V5NamespaceArticle, "Main_Page"); err != nil {
+				t.Errorf("%+v", errors.WithStack(err))
+			}
+		})
+	}
+}
+
+func TestLibrarySharedReaders(t *testing.T) {
+	dir := t.TempDir()
+
+	for i, name := range []string{"first", "second", "third"} {
+		uuid := "00000000-0000-4000-8000-00000000000" + string(rune('1'+i))
+		createLibraryTestArchive(t, filepath.Join(dir, name+".zim"), uuid, name, "", "")
+	}
+
+	library, err := NewLibrary([]string{dir}, WithLibraryMaxOpenReaders(1))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	first, err := library.OpenByName("first")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	again, err := library.OpenByName("first")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if first.Reader != again.Reader {
+		t.Errorf("readers of the same archive should be shared")
+	}
+
+	newValue := func(reader *Reader) any { return new(int) }
+
+	value := first.Value("key", newValue)
+
+	if again.Value("key", newValue) != value {
+		t.Errorf("values of the same archive should be shared")
+	}
+
+	// Evicts the reader of the first archive, which is still in use
+	second, err := library.OpenByName("second")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	second.Close()
+	again.Close()
+
+	if _, err := first.EntryWithURL(V5NamespaceArticle, "Main_Page"); err != nil {
+		t.Errorf("reader in use should not be closed: %+v", errors.WithStack(err))
+	}
+
+	first.Close()
+
+	first, err = library.OpenByName("first")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if first.Value("key", newValue) == value {
+		t.Errorf("values should be dropped with the evicted reader")
+	}
+
+	first.Close()
+
+	if err := library.Close(); err != nil {
+		t.Errorf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := library.OpenByName("third"); err == nil {
+		t.Errorf("expected an error once the library is closed")
+	}
+}
+
+func TestLibraryRefresh(t *testing.T) {
+	dir := t.TempDir()
+
+	createLibraryTestArchive(t, filepath.Join(dir, "books.zim"), "00000000-0000-4000-8000-000000000001", "books", "", "2024-01-01")
+
+	library, err := NewLibrary([]string{dir})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer library.Close()
+
+	reader, err := library.OpenByName("books")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Replace the archive and add another one
+	replacement := filepath.Join(t.TempDir(), "books.zim")
+	createLibraryTestArchive(t, replacement, "00000000-0000-4000-8000-000000000002", "books", "", "2024-02-01")
+
+	if err := os.Rename(replacement, filepath.Join(dir, "books.zim")); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Ensure the modification time differs on coarse file systems
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "books.zim"), future, future); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	createLibraryTestArchive(t, filepath.Join(dir, "other.zim"), "00000000-0000-4000-8000-000000000003", "other", "", "")
+
+	if err := library.Refresh(context.Background()); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// The previous reader stays usable until released
+	if _, err := reader.EntryWithURL(V5NamespaceArticle, "Main_Page"); err != nil {
+		t.Errorf("%+v", errors.WithStack(err))
+	}
+
+	reader.Close()
+
+	if _, err := library.OpenByUUID("00000000-0000-4000-8000-000000000001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for the replaced archive, got '%v'", err)
+	}
+
+	reader, err = library.OpenByName("books")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "00000000-0000-4000-8000-000000000002", reader.UUID(); e != g {
+		t.Errorf("reader.UUID(): expected '%s', got '%s'", e, g)
+	}
+
+	reader.Close()
+
+	if err := os.Remove(filepath.Join(dir, "other.zim")); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := library.Refresh(context.Background()); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := library.OpenByName("other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for the removed archive, got '%v'", err)
+	}
+
+	if e, g := 1, len(library.Archives()); e != g {
+		t.Errorf("len(library.Archives()): expected '%d', got '%d'", e, g)
+	}
+}
+
+func TestLibraryFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	createLibraryTestArchive(t, filepath.Join(dir, "books.zim"), "00000000-0000-4000-8000-000000000001", "books", "", "2024-01-01")
+	createLibraryTestArchive(t, filepath.Join(dir, "other.zim"), "00000000-0000-4000-8000-000000000002", "other", "", "")
+
+	// The archive given both on its own and through its directory is only
+	// listed once, the missing one may appear later
+	paths := []string{
+		filepath.Join(dir, "books.zim"),
+		filepath.Join(t.TempDir(), "missing.zim"),
+		dir,
+	}
+
+	library, err := NewLibrary(paths)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer library.Close()
+
+	if e, g := 2, len(library.Archives()); e != g {
+		t.Fatalf("len(library.Archives()): expected '%d', got '%d'", e, g)
+	}
+
+	createLibraryTestArchive(t, paths[1], "00000000-0000-4000-8000-000000000003", "missing", "", "")
+
+	if err := library.Refresh(context.Background()); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	archives := library.Archives()
+
+	if e, g := 3, len(archives); e != g {
+		t.Fatalf("len(archives): expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := "missing", archives[1].Name; e != g {
+		t.Errorf("archives[1].Name: expected '%s', got '%s'", e, g)
+	}
+}
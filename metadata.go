@@ -1,6 +1,7 @@
 package zim
 
 import (
+	"context"
 	"io"
 
 	"github.com/pkg/errors"
@@ -21,10 +22,15 @@ const (
 	MetadataFlavour              MetadataKey = "Flavour"
 	MetadataSource               MetadataKey = "Source"
 	MetadataLanguage             MetadataKey = "Language"
+	MetadataScraper              MetadataKey = "Scraper"
+	MetadataLicense              MetadataKey = "License"
+	MetadataRelation             MetadataKey = "Relation"
+	MetadataCounter              MetadataKey = "Counter"
 	MetadataIllustration48x48at1 MetadataKey = "Illustration_48x48@1"
 	MetadataIllustration96x96at2 MetadataKey = "Illustration_96x96@2"
 )
 
+// knownKeys are the metadata returned by Metadata() when no key is given.
 var knownKeys = []MetadataKey{
 	MetadataName,
 	MetadataTitle,
@@ -41,8 +47,38 @@ var knownKeys = []MetadataKey{
 	MetadataIllustration96x96at2,
 }
 
-// Metadata returns a copy of the internal metadata map of the ZIM file.
+// MetadataKeys returns the keys of all the metadata of the archive, custom
+// ones included, in lexicographic order.
+func (r *Reader) MetadataKeys() ([]MetadataKey, error) {
+	return r.MetadataKeysContext(context.Background())
+}
+
+// MetadataKeysContext is like MetadataKeys but stops on the cancellation of
+// the given context.
+func (r *Reader) MetadataKeysContext(ctx context.Context) ([]MetadataKey, error) {
+	keys := make([]MetadataKey, 0)
+
+	it := r.EntriesWithURLPrefixContext(ctx, V5NamespaceMetadata, "")
+	for it.Next() {
+		keys = append(keys, MetadataKey(it.Entry().URL()))
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return keys, nil
+}
+
+// Metadata returns the metadata of the ZIM file with the given keys, or the
+// well-known metadata if no key is given. Missing keys are omitted.
 func (r *Reader) Metadata(keys ...MetadataKey) (map[MetadataKey]string, error) {
+	return r.MetadataContext(context.Background(), keys...)
+}
+
+// MetadataContext is like Metadata but stops on the cancellation of the
+// given context.
+func (r *Reader) MetadataContext(ctx context.Context, keys ...MetadataKey) (map[MetadataKey]string, error) {
 	if len(keys) == 0 {
 		keys = knownKeys
 	}
@@ -50,7 +86,7 @@ func (r *Reader) Metadata(keys ...MetadataKey) (map[MetadataKey]string, error) {
 	metadata := make(map[MetadataKey]string)
 
 	for _, key := range keys {
-		entry, err := r.EntryWithURL(V5NamespaceMetadata, string(key))
+		entry, err := r.EntryWithURLContext(ctx, V5NamespaceMetadata, string(key))
 		if err != nil {
 			if errors.Is(err, ErrNotFound) {
 				continue
@@ -59,23 +95,67 @@ func (r *Reader) Metadata(keys ...MetadataKey) (map[MetadataKey]string, error) {
 			return nil, errors.WithStack(err)
 		}
 
-		content, err := entry.Redirect()
+		value, err := readMetadataValue(ctx, entry)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, errors.Wrapf(err, "could not read metadata '%s'", key)
 		}
 
-		reader, err := content.Reader()
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
+		metadata[key] = value
+	}
+
+	return metadata, nil
+}
 
-		data, err := io.ReadAll(reader)
+// AllMetadata returns all the metadata of the archive, custom ones, Counter
+// and illustrations included, read in a single pass over the namespace.
+func (r *Reader) AllMetadata() (map[MetadataKey]string, error) {
+	return r.AllMetadataContext(context.Background())
+}
+
+// AllMetadataContext is like AllMetadata but stops on the cancellation of the
+// given context.
+func (r *Reader) AllMetadataContext(ctx context.Context) (map[MetadataKey]string, error) {
+	metadata := make(map[MetadataKey]string)
+
+	it := r.EntriesWithURLPrefixContext(ctx, V5NamespaceMetadata, "")
+	for it.Next() {
+		entry := it.Entry()
+
+		value, err := readMetadataValue(ctx, entry)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, errors.Wrapf(err, "could not read metadata '%s'", entry.URL())
 		}
 
-		metadata[key] = string(data)
+		metadata[MetadataKey(entry.URL())] = value
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, errors.WithStack(err)
 	}
 
 	return metadata, nil
 }
+
+func readMetadataValue(ctx context.Context, entry Entry) (string, error) {
+	content, err := entry.Redirect()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	reader, err := content.ReaderContext(ctx)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		reader.Close()
+		return "", errors.WithStack(err)
+	}
+
+	if err := reader.Close(); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return string(data), nil
+}
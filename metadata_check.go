@@ -0,0 +1,280 @@
+package zim
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+)
+
+const (
+	maxTitleLength           = 30
+	maxDescriptionLength     = 80
+	maxLongDescriptionLength = 4000
+)
+
+// mandatoryMetadata are the keys every archive must have, see
+// https://wiki.openzim.org/wiki/Metadata.
+var mandatoryMetadata = []MetadataKey{
+	MetadataName,
+	MetadataTitle,
+	MetadataLanguage,
+	MetadataCreator,
+	MetadataPublisher,
+	MetadataDate,
+	MetadataDescription,
+	IllustrationKey(48, 1),
+}
+
+type MetadataSeverity string
+
+const (
+	// MetadataError is the severity of the violations of the openZIM
+	// metadata rules.
+	MetadataError MetadataSeverity = "error"
+	// MetadataWarning is the severity of the departures from the openZIM
+	// metadata recommendations.
+	MetadataWarning MetadataSeverity = "warning"
+)
+
+type MetadataProblemKind string
+
+const (
+	MetadataProblemMissing             MetadataProblemKind = "missing"
+	MetadataProblemEmpty               MetadataProblemKind = "empty"
+	MetadataProblemTooLong             MetadataProblemKind = "too-long"
+	MetadataProblemTooShort            MetadataProblemKind = "too-short"
+	MetadataProblemInvalidDate         MetadataProblemKind = "invalid-date"
+	MetadataProblemInvalidLanguage     MetadataProblemKind = "invalid-language"
+	MetadataProblemInvalidIllustration MetadataProblemKind = "invalid-illustration"
+)
+
+// MetadataProblem is a departure from the openZIM metadata rules found by
+// Reader.CheckMetadata().
+type MetadataProblem struct {
+	Severity MetadataSeverity
+	Kind     MetadataProblemKind
+	Key      MetadataKey
+	Message  string
+}
+
+func (p MetadataProblem) String() string {
+	return fmt.Sprintf("%s %s [%s]: %s", p.Severity, p.Kind, p.Key, p.Message)
+}
+
+// CheckMetadata validates the metadata of the archive against the openZIM
+// rules: mandatory keys, length of the title and descriptions, format of the
+// date, ISO 639-3 languages and 48x48 PNG illustration.
+//
+// The returned problems are ordered by key, an error is only returned if
+// the metadata could not be read.
+func (r *Reader) CheckMetadata() ([]MetadataProblem, error) {
+	return r.CheckMetadataContext(context.Background())
+}
+
+// CheckMetadataContext is like CheckMetadata but stops on the cancellation
+// of the given context.
+func (r *Reader) CheckMetadataContext(ctx context.Context) ([]MetadataProblem, error) {
+	metadata, err := r.AllMetadataContext(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	checker := &metadataChecker{
+		metadata: metadata,
+		problems: make([]MetadataProblem, 0),
+	}
+
+	checker.checkMandatory()
+	checker.checkLengths()
+	checker.checkDate()
+	checker.checkLanguage()
+	checker.checkIllustrations()
+
+	sort.SliceStable(checker.problems, func(i, j int) bool {
+		return checker.problems[i].Key < checker.problems[j].Key
+	})
+
+	return checker.problems, nil
+}
+
+type metadataChecker struct {
+	metadata map[MetadataKey]string
+	problems []MetadataProblem
+}
+
+func (c *metadataChecker) report(severity MetadataSeverity, kind MetadataProblemKind, key MetadataKey, format string, args ...any) {
+	c.problems = append(c.problems, MetadataProblem{
+		Severity: severity,
+		Kind:     kind,
+		Key:      key,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// value returns the value of the given key, or false if it is missing or
+// empty, missing and empty mandatory keys being reported by checkMandatory.
+func (c *metadataChecker) value(key MetadataKey) (string, bool) {
+	value, exists := c.metadata[key]
+	if !exists || strings.TrimSpace(value) == "" {
+		return "", false
+	}
+
+	return value, true
+}
+
+func (c *metadataChecker) checkMandatory() {
+	mandatory := make(map[MetadataKey]struct{}, len(mandatoryMetadata))
+
+	for _, key := range mandatoryMetadata {
+		mandatory[key] = struct{}{}
+
+		value, exists := c.metadata[key]
+
+		switch {
+		case !exists:
+			c.report(MetadataError, MetadataProblemMissing, key, "mandatory metadata is missing")
+		case strings.TrimSpace(value) == "":
+			c.report(MetadataError, MetadataProblemEmpty, key, "mandatory metadata is empty")
+		}
+	}
+
+	for key, value := range c.metadata {
+		if _, exists := mandatory[key]; exists {
+			continue
+		}
+
+		if strings.TrimSpace(value) == "" {
+			c.report(MetadataWarning, MetadataProblemEmpty, key, "metadata is empty")
+		}
+	}
+}
+
+func (c *metadataChecker) checkLengths() {
+	limits := []struct {
+		Key      MetadataKey
+		Max      int
+		Severity MetadataSeverity
+	}{
+		{Key: MetadataTitle, Max: maxTitleLength, Severity: MetadataWarning},
+		{Key: MetadataDescription, Max: maxDescriptionLength, Severity: MetadataError},
+		{Key: MetadataLongDescription, Max: maxLongDescriptionLength, Severity: MetadataError},
+	}
+
+	for _, limit := range limits {
+		value, exists := c.value(limit.Key)
+		if !exists {
+			continue
+		}
+
+		if length := utf8.RuneCountInString(value); length > limit.Max {
+			c.report(limit.Severity, MetadataProblemTooLong, limit.Key, "%d characters long, more than %d", length, limit.Max)
+		}
+	}
+
+	longDescription, exists := c.value(MetadataLongDescription)
+	if !exists {
+		return
+	}
+
+	description, _ := c.value(MetadataDescription)
+
+	if utf8.RuneCountInString(longDescription) <= utf8.RuneCountInString(description) {
+		c.report(MetadataWarning, MetadataProblemTooShort, MetadataLongDescription, "not longer than the description")
+	}
+}
+
+func (c *metadataChecker) checkDate() {
+	value, exists := c.value(MetadataDate)
+	if !exists {
+		return
+	}
+
+	if _, err := time.Parse(time.DateOnly, value); err != nil {
+		c.report(MetadataError, MetadataProblemInvalidDate, MetadataDate, "'%s' is not formatted as YYYY-MM-DD", value)
+	}
+}
+
+func (c *metadataChecker) checkLanguage() {
+	value, exists := c.value(MetadataLanguage)
+	if !exists {
+		return
+	}
+
+	for _, code := range ParseLanguages(value) {
+		if !isISO6393(code) {
+			c.report(MetadataError, MetadataProblemInvalidLanguage, MetadataLanguage, "'%s' is not an ISO 639-3 language code", code)
+		}
+	}
+}
+
+func (c *metadataChecker) checkIllustrations() {
+	keys := make([]MetadataKey, 0)
+
+	for key := range c.metadata {
+		if strings.HasPrefix(string(key), illustrationKeyPrefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	mandatory := IllustrationKey(48, 1)
+
+	for _, key := range keys {
+		value, exists := c.value(key)
+		if !exists {
+			continue
+		}
+
+		// Only the 48x48 illustration is mandatory
+		severity := MetadataWarning
+		if key == mandatory {
+			severity = MetadataError
+		}
+
+		width, height, scale, ok := ParseIllustrationKey(key)
+		if !ok {
+			c.report(severity, MetadataProblemInvalidIllustration, key, "key is not formatted as Illustration_<width>x<height>@<scale>")
+			continue
+		}
+
+		config, err := png.DecodeConfig(bytes.NewReader([]byte(value)))
+		if err != nil {
+			c.report(severity, MetadataProblemInvalidIllustration, key, "not a PNG image: %s", err)
+			continue
+		}
+
+		if config.Width != width*scale || config.Height != height*scale {
+			c.report(severity, MetadataProblemInvalidIllustration, key, "image is %dx%d pixels, expected %dx%d", config.Width, config.Height, width*scale, height*scale)
+		}
+	}
+}
+
+// isISO6393 returns true if the given code is a known ISO 639-3 language
+// code, excluding the two letters ISO 639-1 codes.
+func isISO6393(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+
+	for _, r := range code {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+
+	base, err := language.ParseBase(code)
+	if err != nil {
+		return false
+	}
+
+	return base.ISO3() == code
+}
@@ -0,0 +1,175 @@
+package zim
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheckMetadata(t *testing.T) {
+	type testCase struct {
+		Name string
+		// Path is the archive to check, or empty to create one with Metadata.
+		Path             string
+		Metadata         map[MetadataKey]string
+		ExpectedProblems []string
+	}
+
+	illustration := func(size int) string {
+		var buf bytes.Buffer
+
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, size, size))); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		return buf.String()
+	}
+
+	valid := func(overrides map[MetadataKey]string) map[MetadataKey]string {
+		metadata := map[MetadataKey]string{
+			MetadataName:           "go-zim_en_test",
+			MetadataTitle:          "Test archive",
+			MetadataLanguage:       "eng",
+			MetadataCreator:        "go-zim",
+			MetadataPublisher:      "go-zim",
+			MetadataDate:           "2024-01-30",
+			MetadataDescription:    "Test archive",
+			IllustrationKey(48, 1): illustration(48),
+		}
+
+		for key, value := range overrides {
+			metadata[key] = value
+		}
+
+		return metadata
+	}
+
+	testCases := []testCase{
+		{
+			Name:             "Wikibooks",
+			Path:             "testdata/wikibooks_af_all_maxi_2023-06.zim",
+			ExpectedProblems: []string{},
+		},
+		{
+			Name: "MissingIllustration",
+			Path: "testdata/go-zim_test_zlib_2024-01.zim",
+			ExpectedProblems: []string{
+				"error missing [Illustration_48x48@1]: mandatory metadata is missing",
+			},
+		},
+		{
+			Name:             "Valid",
+			Metadata:         valid(nil),
+			ExpectedProblems: []string{},
+		},
+		{
+			Name: "Invalid",
+			Metadata: valid(map[MetadataKey]string{
+				MetadataTitle:           strings.Repeat("t", 31),
+				MetadataDescription:     strings.Repeat("d", 81),
+				MetadataLongDescription: strings.Repeat("l", 81),
+				MetadataDate:            "30/01/2024",
+				MetadataLanguage:        "eng,fr,xyz",
+				MetadataCreator:         " ",
+				MetadataSource:          "",
+				IllustrationKey(48, 1):  illustration(96),
+				IllustrationKey(48, 2):  "not an image",
+			}),
+			ExpectedProblems: []string{
+				"error empty [Creator]: mandatory metadata is empty",
+				"error invalid-date [Date]: '30/01/2024' is not formatted as YYYY-MM-DD",
+				"error too-long [Description]: 81 characters long, more than 80",
+				"error invalid-illustration [Illustration_48x48@1]: image is 96x96 pixels, expected 48x48",
+				"warning invalid-illustration [Illustration_48x48@2]: not a PNG image: png: invalid format: not a PNG file",
+				"error invalid-language [Language]: 'fr' is not an ISO 639-3 language code",
+				"error invalid-language [Language]: 'xyz' is not an ISO 639-3 language code",
+				"warning too-short [LongDescription]: not longer than the description",
+				"warning empty [Source]: metadata is empty",
+				"warning too-long [Title]: 31 characters long, more than 30",
+			},
+		},
+		{
+			Name: "SpacedLanguages",
+			Metadata: valid(map[MetadataKey]string{
+				MetadataLanguage: "eng, fra,,deu ",
+			}),
+			ExpectedProblems: []string{},
+		},
+		{
+			Name: "MissingKeys",
+			Metadata: map[MetadataKey]string{
+				MetadataName: "go-zim_en_test",
+			},
+			ExpectedProblems: []string{
+				"error missing [Creator]: mandatory metadata is missing",
+				"error missing [Date]: mandatory metadata is missing",
+				"error missing [Description]: mandatory metadata is missing",
+				"error missing [Illustration_48x48@1]: mandatory metadata is missing",
+				"error missing [Language]: mandatory metadata is missing",
+				"error missing [Publisher]: mandatory metadata is missing",
+				"error missing [Title]: mandatory metadata is missing",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			path := tc.Path
+
+			if path == "" {
+				path = filepath.Join(t.TempDir(), "test.zim")
+				createMetadataTestArchive(t, path, tc.Metadata)
+			}
+
+			reader, err := Open(path)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer reader.Close()
+
+			problems, err := reader.CheckMetadata()
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			messages := make([]string, 0, len(problems))
+			for _, p := range problems {
+				messages = append(messages, p.String())
+			}
+
+			if e, g := tc.ExpectedProblems, messages; !reflect.DeepEqual(e, g) {
+				t.Errorf("problems: expected '%q', got '%q'", e, g)
+			}
+		})
+	}
+}
+
+func createMetadataTestArchive(t *testing.T, path string, metadata map[MetadataKey]string) {
+	t.Helper()
+
+	writer, err := Create(path)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for key, value := range metadata {
+		if err := writer.AddMetadata(key, value); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	if err := writer.AddContent(V5NamespaceArticle, "Main_Page", "Main Page", "text/html", strings.NewReader("<html></html>")); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+}
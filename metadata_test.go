@@ -0,0 +1,232 @@
+package zim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestMetadataKeys(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer reader.Close()
+
+	keys, err := reader.MetadataKeys()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	expected := []MetadataKey{
+		MetadataCounter, MetadataCreator, MetadataDate, MetadataDescription,
+		MetadataFlavour, IllustrationKey(48, 1), MetadataLanguage, MetadataName,
+		MetadataPublisher, MetadataScraper, MetadataTags, MetadataTitle,
+	}
+
+	if e, g := expected, keys; !reflect.DeepEqual(e, g) {
+		t.Errorf("keys: expected '%v', got '%v'", e, g)
+	}
+
+	all, err := reader.AllMetadata()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := len(expected), len(all); e != g {
+		t.Errorf("len(all): expected '%d', got '%d'", e, g)
+	}
+
+	// Only the well-known metadata are returned by default
+	known, err := reader.Metadata()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 10, len(known); e != g {
+		t.Errorf("len(known): expected '%d', got '%d'", e, g)
+	}
+
+	if _, exists := known[MetadataCounter]; exists {
+		t.Errorf("known metadata should not contain '%s'", MetadataCounter)
+	}
+}
+
+func TestArchiveMetadata(t *testing.T) {
+	type testCase struct {
+		Path                 string
+		ExpectedName         string
+		ExpectedDate         time.Time
+		ExpectedLanguages    []string
+		ExpectedCategory     string
+		ExpectedPictures     bool
+		ExpectedFullText     bool
+		ExpectedArticles     uint64
+		ExpectedMedia        uint64
+		ExpectedIllustration int
+	}
+
+	testCases := []testCase{
+		{
+			Path:                 "testdata/wikibooks_af_all_maxi_2023-06.zim",
+			ExpectedName:         "wikibooks_af_all",
+			ExpectedDate:         time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC),
+			ExpectedLanguages:    []string{"afr"},
+			ExpectedCategory:     "wikibooks",
+			ExpectedPictures:     true,
+			ExpectedFullText:     true,
+			ExpectedArticles:     143,
+			ExpectedMedia:        99,
+			ExpectedIllustration: 5365,
+		},
+		{
+			Path:              "testdata/go-zim_test_zlib_2024-01.zim",
+			ExpectedName:      "go-zim_test_zlib",
+			ExpectedDate:      time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC),
+			ExpectedLanguages: []string{"eng"},
+			ExpectedCategory:  "test",
+			ExpectedPictures:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Path, func(t *testing.T) {
+			reader, err := Open(tc.Path)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer reader.Close()
+
+			metadata, err := reader.ArchiveMetadata()
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := tc.ExpectedName, metadata.Name; e != g {
+				t.Errorf("metadata.Name: expected '%s', got '%s'", e, g)
+			}
+
+			if e, g := tc.ExpectedDate, metadata.Date; !e.Equal(g) {
+				t.Errorf("metadata.Date: expected '%v', got '%v'", e, g)
+			}
+
+			if e, g := tc.ExpectedLanguages, metadata.Languages; !reflect.DeepEqual(e, g) {
+				t.Errorf("metadata.Languages: expected '%v', got '%v'", e, g)
+			}
+
+			if e, g := tc.ExpectedCategory, metadata.Tags.Category(); e != g {
+				t.Errorf("metadata.Tags.Category(): expected '%s', got '%s'", e, g)
+			}
+
+			if e, g := tc.ExpectedPictures, metadata.Tags.HasPictures(); e != g {
+				t.Errorf("metadata.Tags.HasPictures(): expected '%v', got '%v'", e, g)
+			}
+
+			if e, g := tc.ExpectedFullText, metadata.Tags.HasFullTextIndex(); e != g {
+				t.Errorf("metadata.Tags.HasFullTextIndex(): expected '%v', got '%v'", e, g)
+			}
+
+			if e, g := tc.ExpectedArticles, metadata.Counter.ArticleCount(); e != g {
+				t.Errorf("metadata.Counter.ArticleCount(): expected '%d', got '%d'", e, g)
+			}
+
+			if e, g := tc.ExpectedMedia, metadata.Counter.MediaCount(); e != g {
+				t.Errorf("metadata.Counter.MediaCount(): expected '%d', got '%d'", e, g)
+			}
+
+			illustration, exists := metadata.Illustration(48, 1)
+			if tc.ExpectedIllustration == 0 {
+				if exists {
+					t.Errorf("expected no illustration")
+				}
+
+				return
+			}
+
+			if !exists {
+				t.Fatalf("expected a 48x48@1 illustration")
+			}
+
+			if e, g := tc.ExpectedIllustration, len(illustration.Data); e != g {
+				t.Errorf("len(illustration.Data): expected '%d', got '%d'", e, g)
+			}
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags := ParseTags("wikipedia; _category:wikipedia;_pictures:no;nodet;;_ftindex:yes")
+
+	if e, g := []string{"wikipedia", "_category:wikipedia", "_pictures:no", "nodet", "_ftindex:yes"}, tags.List(); !reflect.DeepEqual(e, g) {
+		t.Errorf("tags.List(): expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "wikipedia", tags.Category(); e != g {
+		t.Errorf("tags.Category(): expected '%s', got '%s'", e, g)
+	}
+
+	if tags.HasPictures() {
+		t.Errorf("tags.HasPictures(): expected 'false'")
+	}
+
+	if !tags.HasVideos() {
+		t.Errorf("tags.HasVideos(): expected 'true'")
+	}
+
+	if tags.HasDetails() {
+		t.Errorf("tags.HasDetails(): expected 'false' with the legacy 'nodet' tag")
+	}
+
+	if !tags.HasFullTextIndex() {
+		t.Errorf("tags.HasFullTextIndex(): expected 'true'")
+	}
+}
+
+func TestParseLanguages(t *testing.T) {
+	if e, g := []string{"eng", "fra", "deu"}, ParseLanguages("eng, fra,,deu "); !reflect.DeepEqual(e, g) {
+		t.Errorf("ParseLanguages(): expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := []string{}, ParseLanguages(""); !reflect.DeepEqual(e, g) {
+		t.Errorf("ParseLanguages(): expected '%v', got '%v'", e, g)
+	}
+}
+
+func TestParseIllustrationKey(t *testing.T) {
+	type testCase struct {
+		Key           MetadataKey
+		ExpectedOK    bool
+		ExpectedWidth int
+		ExpectedScale int
+	}
+
+	testCases := []testCase{
+		{Key: "Illustration_48x48@1", ExpectedOK: true, ExpectedWidth: 48, ExpectedScale: 1},
+		{Key: "Illustration_96x96@2", ExpectedOK: true, ExpectedWidth: 96, ExpectedScale: 2},
+		{Key: "Illustration_48x48", ExpectedOK: false},
+		{Key: "Illustration_axb@1", ExpectedOK: false},
+		{Key: "Title", ExpectedOK: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.Key), func(t *testing.T) {
+			width, _, scale, ok := ParseIllustrationKey(tc.Key)
+
+			if e, g := tc.ExpectedOK, ok; e != g {
+				t.Fatalf("ok: expected '%v', got '%v'", e, g)
+			}
+
+			if e, g := tc.ExpectedWidth, width; e != g {
+				t.Errorf("width: expected '%d', got '%d'", e, g)
+			}
+
+			if e, g := tc.ExpectedScale, scale; e != g {
+				t.Errorf("scale: expected '%d', got '%d'", e, g)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package zim
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	splitExtension      = ".zim"
+	firstSplitExtension = ".zimaa"
+	// maxSplitParts is the number of parts which can be named with a two
+	// letters suffix, from "aa" to "zz".
+	maxSplitParts = 26 * 26
+)
+
+// MultiPartReaderAt exposes the concatenation of multiple parts as a single
+// ReadAtCloser, for archives split in multiple files.
+type MultiPartReaderAt struct {
+	parts []ReadAtCloser
+	// offsets holds the start offset of each part in the concatenation.
+	offsets []int64
+	size    int64
+}
+
+// NewMultiPartReaderAt returns a MultiPartReaderAt concatenating the given
+// parts, in order. The size of each part must be provided.
+func NewMultiPartReaderAt(parts []ReadAtCloser, sizes []int64) (*MultiPartReaderAt, error) {
+	if len(parts) != len(sizes) {
+		return nil, errors.Errorf("got '%d' parts but '%d' sizes", len(parts), len(sizes))
+	}
+
+	offsets := make([]int64, len(parts))
+	size := int64(0)
+
+	for i, s := range sizes {
+		if s < 0 {
+			return nil, errors.Errorf("invalid size '%d' for part '%d'", s, i)
+		}
+
+		offsets[i] = size
+		size += s
+	}
+
+	return &MultiPartReaderAt{
+		parts:   parts,
+		offsets: offsets,
+		size:    size,
+	}, nil
+}
+
+// Size returns the total size of the parts.
+func (r *MultiPartReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *MultiPartReaderAt) ReadAt(data []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.Errorf("invalid offset '%d'", offset)
+	}
+
+	if offset >= r.size {
+		return 0, io.EOF
+	}
+
+	// Last part starting before or at the offset
+	idx := sort.Search(len(r.offsets), func(i int) bool {
+		return r.offsets[i] > offset
+	}) - 1
+
+	read := 0
+
+	for read < len(data) && idx < len(r.parts) {
+		partOffset := offset + int64(read) - r.offsets[idx]
+		partSize := r.partSize(idx)
+
+		if partOffset >= partSize {
+			idx++
+			continue
+		}
+
+		chunk := data[read:]
+		if remaining := partSize - partOffset; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+
+		n, err := r.parts[idx].ReadAt(chunk, partOffset)
+		read += n
+
+		if err != nil && !(errors.Is(err, io.EOF) && n == len(chunk)) {
+			if errors.Is(err, io.EOF) {
+				return read, errors.Wrapf(io.ErrUnexpectedEOF, "part '%d' is shorter than expected", idx)
+			}
+
+			return read, errors.WithStack(err)
+		}
+
+		idx++
+	}
+
+	if read < len(data) {
+		return read, io.EOF
+	}
+
+	return read, nil
+}
+
+func (r *MultiPartReaderAt) partSize(idx int) int64 {
+	if idx == len(r.offsets)-1 {
+		return r.size - r.offsets[idx]
+	}
+
+	return r.offsets[idx+1] - r.offsets[idx]
+}
+
+// Close closes all the parts.
+func (r *MultiPartReaderAt) Close() error {
+	var firstErr error
+
+	for _, p := range r.parts {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = errors.WithStack(err)
+		}
+	}
+
+	return firstErr
+}
+
+// splitPartPaths returns the paths of the parts of the split archive
+// designated by the given path, either the path of the first part
+// (".zimaa") or the path of the archive without the part suffix (".zim").
+// It returns nil if the path does not designate a split archive.
+func splitPartPaths(path string) ([]string, error) {
+	var base string
+
+	switch {
+	case strings.HasSuffix(path, firstSplitExtension):
+		base = strings.TrimSuffix(path, "aa")
+	case strings.HasSuffix(path, splitExtension):
+		if _, err := os.Stat(path); err == nil || !errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		base = path
+	default:
+		return nil, nil
+	}
+
+	paths := make([]string, 0)
+
+	for i := 0; i < maxSplitParts; i++ {
+		partPath := fmt.Sprintf("%s%c%c", base, 'a'+i/26, 'a'+i%26)
+
+		if _, err := os.Stat(partPath); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			}
+
+			return nil, errors.WithStack(err)
+		}
+
+		paths = append(paths, partPath)
+	}
+
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	return paths, nil
+}
+
+// openSplitArchive opens the given parts as a single MultiPartReaderAt.
+func openSplitArchive(paths []string) (*MultiPartReaderAt, error) {
+	parts := make([]ReadAtCloser, 0, len(paths))
+	sizes := make([]int64, 0, len(paths))
+
+	closeParts := func() {
+		for _, p := range parts {
+			p.Close()
+		}
+	}
+
+	for _, p := range paths {
+		file, err := os.Open(p)
+		if err != nil {
+			closeParts()
+			return nil, errors.WithStack(err)
+		}
+
+		parts = append(parts, file)
+
+		stat, err := file.Stat()
+		if err != nil {
+			closeParts()
+			return nil, errors.WithStack(err)
+		}
+
+		sizes = append(sizes, stat.Size())
+	}
+
+	reader, err := NewMultiPartReaderAt(parts, sizes)
+	if err != nil {
+		closeParts()
+		return nil, errors.WithStack(err)
+	}
+
+	return reader, nil
+}
+
+var _ ReadAtCloser = &MultiPartReaderAt{}
@@ -0,0 +1,147 @@
+package zim
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type nopCloserReaderAt struct {
+	*bytes.Reader
+}
+
+func (nopCloserReaderAt) Close() error {
+	return nil
+}
+
+func TestMultiPartReaderAt(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	sizes := []int64{3, 0, 7, 10}
+
+	parts := make([]ReadAtCloser, 0, len(sizes))
+	offset := int64(0)
+
+	for _, s := range sizes {
+		parts = append(parts, nopCloserReaderAt{bytes.NewReader(data[offset : offset+s])})
+		offset += s
+	}
+
+	reader, err := NewMultiPartReaderAt(parts, sizes)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := int64(len(data)), reader.Size(); e != g {
+		t.Errorf("reader.Size(): expected '%d', got '%d'", e, g)
+	}
+
+	for start := 0; start < len(data); start++ {
+		for end := start; end <= len(data); end++ {
+			buff := make([]byte, end-start)
+
+			n, err := reader.ReadAt(buff, int64(start))
+			if err != nil {
+				t.Fatalf("ReadAt(%d, %d): %+v", start, end, errors.WithStack(err))
+			}
+
+			if e, g := string(data[start:end]), string(buff[:n]); e != g {
+				t.Errorf("ReadAt(%d, %d): expected '%s', got '%s'", start, end, e, g)
+			}
+		}
+	}
+
+	buff := make([]byte, 5)
+
+	n, err := reader.ReadAt(buff, 17)
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF error, got '%v'", err)
+	}
+
+	if e, g := "hij", string(buff[:n]); e != g {
+		t.Errorf("ReadAt(17): expected '%s', got '%s'", e, g)
+	}
+
+	if _, err := NewMultiPartReaderAt(parts, sizes[1:]); err == nil {
+		t.Errorf("expected an error with mismatching sizes")
+	}
+}
+
+func TestOpenSplitArchive(t *testing.T) {
+	source := "testdata/wikibooks_af_all_maxi_2023-06.zim"
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	dir := t.TempDir()
+	partSize := len(data)/3 + 1
+
+	for i := 0; i*partSize < len(data); i++ {
+		end := (i + 1) * partSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		partPath := filepath.Join(dir, fmt.Sprintf("archive.zima%c", 'a'+i))
+		if err := os.WriteFile(partPath, data[i*partSize:end], 0o644); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	expected, err := Open(source)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer expected.Close()
+
+	for _, path := range []string{"archive.zimaa", "archive.zim"} {
+		t.Run(path, func(t *testing.T) {
+			reader, err := Open(filepath.Join(dir, path))
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := reader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			if e, g := expected.UUID(), reader.UUID(); e != g {
+				t.Errorf("reader.UUID(): expected '%s', got '%s'", e, g)
+			}
+
+			if err := reader.Verify(context.Background()); err != nil {
+				t.Errorf("%+v", errors.WithStack(err))
+			}
+
+			it := reader.Entries()
+			for it.Next() {
+				expectedEntry, err := expected.EntryAt(it.Index())
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				if e, g := expectedEntry.FullURL(), it.Entry().FullURL(); e != g {
+					t.Errorf("entry '%d': expected '%s', got '%s'", it.Index(), e, g)
+				}
+			}
+
+			if err := it.Err(); err != nil {
+				t.Errorf("%+v", errors.WithStack(err))
+			}
+		})
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing.zim")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist error, got '%v'", err)
+	}
+}
@@ -6,6 +6,29 @@ type Options struct {
 	URLCacheSize int
 	URLCacheTTL  time.Duration
 	CacheSize    int
+	Preload      bool
+
+	// ClusterCacheSize is the maximum number of decompressed clusters
+	// kept in memory and shared by all the blob readers. A value lower or
+	// equal to zero disables the cache.
+	ClusterCacheSize int
+
+	// ClusterCacheBytes is the maximum total size, in bytes, of the
+	// decompressed clusters kept in the cluster cache. Clusters larger than
+	// it are not cached. A value lower or equal to zero disables the cache.
+	//
+	// The clusters being decompressed are not accounted for: in the worst
+	// case, a reader holds ClusterCacheBytes plus one decompressed cluster
+	// per cluster loaded concurrently.
+	ClusterCacheBytes int64
+
+	// StreamingThreshold is the compressed size above which a cluster is
+	// decoded on the fly when reading one of its blobs, instead of being
+	// decompressed in memory and cached. A negative value disables streaming.
+	StreamingThreshold int64
+
+	// Decoders overrides the registered decoder factories for this reader.
+	Decoders map[Compression]ClusterDecoderFactory
 }
 
 type OptionFunc func(opts *Options)
@@ -13,6 +36,9 @@ type OptionFunc func(opts *Options)
 func NewOptions(funcs ...OptionFunc) *Options {
 	funcs = append([]OptionFunc{
 		WithCacheSize(2048),
+		WithClusterCacheSize(16),
+		WithClusterCacheBytes(128 << 20),
+		WithStreamingThreshold(8 << 20),
 	}, funcs...)
 
 	opts := &Options{}
@@ -28,3 +54,43 @@ func WithCacheSize(size int) OptionFunc {
 		opts.CacheSize = size
 	}
 }
+
+func WithClusterCacheSize(size int) OptionFunc {
+	return func(opts *Options) {
+		opts.ClusterCacheSize = size
+	}
+}
+
+func WithClusterCacheBytes(size int64) OptionFunc {
+	return func(opts *Options) {
+		opts.ClusterCacheBytes = size
+	}
+}
+
+func WithStreamingThreshold(size int64) OptionFunc {
+	return func(opts *Options) {
+		opts.StreamingThreshold = size
+	}
+}
+
+// WithDecoder sets the decoder factory used by the reader for the given
+// compression identifier, taking precedence over the ones registered with
+// RegisterDecoder().
+func WithDecoder(compression Compression, factory ClusterDecoderFactory) OptionFunc {
+	return func(opts *Options) {
+		if opts.Decoders == nil {
+			opts.Decoders = make(map[Compression]ClusterDecoderFactory)
+		}
+
+		opts.Decoders[compression] = factory
+	}
+}
+
+// WithPreload enables the loading of the whole URL index in memory
+// when the reader is created. Lookups by URL are then resolved without
+// reading the archive, at the cost of a full scan of the entries on startup.
+func WithPreload(preload bool) OptionFunc {
+	return func(opts *Options) {
+		opts.Preload = preload
+	}
+}
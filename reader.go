@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/pkg/errors"
@@ -17,6 +21,8 @@ const zimFormatMagicNumber uint32 = 0x44D495A
 const nullByte = '\x00'
 const zimRedirect = 0xffff
 
+// Reader reads a ZIM archive. It is safe for concurrent use, see the
+// package documentation for details.
 type Reader struct {
 	majorVersion  uint16
 	minorVersion  uint16
@@ -34,9 +40,38 @@ type Reader struct {
 	mimeTypes    []string
 	urlIndex     []uint64
 	clusterIndex []uint64
+	titleIndex   []uint32
 
 	cache *lru.Cache[string, Entry]
-	urls  map[string]int
+
+	clusterCache       *clusterCache
+	clusterCacheHits   atomic.Uint64
+	clusterCacheMisses atomic.Uint64
+	streamingThreshold int64
+	decoders           map[Compression]ClusterDecoderFactory
+
+	clusterLoadsMutex sync.Mutex
+	clusterLoads      map[uint64]*clusterLoad
+
+	// urls is only populated when the reader is created with the
+	// WithPreload() option, otherwise lookups are done with a binary
+	// search over the URL pointer list.
+	urls map[string]int
+
+	// fullTextIndex is lazily opened on the first search.
+	fullTextIndexOnce sync.Once
+	fullTextIndex     *glassDatabase
+	fullTextIndexErr  error
+
+	// frontArticles is the lazily loaded title ordered listing of the
+	// front articles, nil if the archive does not provide it.
+	frontArticlesOnce sync.Once
+	frontArticles     []uint32
+	frontArticlesErr  error
+
+	// modTime is the modification time of the archive file, zero if
+	// unknown.
+	modTime time.Time
 
 	reader ReadAtCloser
 }
@@ -53,10 +88,22 @@ func (r *Reader) ClusterCount() uint32 {
 	return r.clusterCount
 }
 
+// Size returns the size of the archive in bytes, up to the end of its
+// checksum.
+func (r *Reader) Size() int64 {
+	return int64(r.checksumPos) + checksumSize
+}
+
 func (r *Reader) UUID() string {
 	return r.uuid
 }
 
+// ModTime returns the modification time of the archive file, or the zero
+// time if the underlying ReadAtCloser does not provide it.
+func (r *Reader) ModTime() time.Time {
+	return r.modTime
+}
+
 func (r *Reader) Close() error {
 	if err := r.reader.Close(); err != nil {
 		return errors.WithStack(err)
@@ -66,24 +113,174 @@ func (r *Reader) Close() error {
 }
 
 func (r *Reader) MainPage() (Entry, error) {
+	return r.MainPageContext(context.Background())
+}
+
+// MainPageContext is like MainPage but stops on the cancellation of the
+// given context.
+func (r *Reader) MainPageContext(ctx context.Context) (Entry, error) {
 	if r.mainPage == 0xffffffff {
 		return nil, errors.WithStack(ErrNotFound)
 	}
 
-	entry, err := r.EntryAt(int(r.mainPage))
+	entry, err := r.EntryAtContext(ctx, int(r.mainPage))
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, errors.WithStack(ctxErr)
+		}
+
 		return nil, errors.WithStack(ErrNotFound)
 	}
 
 	return entry, nil
 }
 
+// Entries returns an iterator over the entries of the archive, ordered
+// by namespace and URL.
 func (r *Reader) Entries() *EntryIterator {
+	return r.EntriesContext(context.Background())
+}
+
+// EntriesContext is like Entries but the iteration stops with the error of
+// the given context once it is done.
+func (r *Reader) EntriesContext(ctx context.Context) *EntryIterator {
 	return &EntryIterator{
-		reader: r,
+		ctx:     ctx,
+		count:   len(r.urlIndex),
+		entryAt: r.EntryAt,
 	}
 }
 
+// EntriesByTitle returns an iterator over the entries of the archive,
+// ordered by namespace and title.
+func (r *Reader) EntriesByTitle() *EntryIterator {
+	return r.EntriesByTitleContext(context.Background())
+}
+
+// EntriesByTitleContext is like EntriesByTitle but the iteration stops with
+// the error of the given context once it is done.
+func (r *Reader) EntriesByTitleContext(ctx context.Context) *EntryIterator {
+	if r.titleIndex == nil {
+		return &EntryIterator{
+			err: errors.Wrap(ErrNotFound, "archive does not provide a title index"),
+		}
+	}
+
+	return &EntryIterator{
+		ctx:     ctx,
+		count:   len(r.titleIndex),
+		entryAt: r.entryAtTitlePosition,
+	}
+}
+
+// EntriesWithURLPrefix returns an iterator over the entries of the given
+// namespace whose URL starts with the given prefix, ordered by URL. The
+// bounds of the range are found with a binary search over the URL pointer
+// list.
+func (r *Reader) EntriesWithURLPrefix(ns Namespace, prefix string) *EntryIterator {
+	return r.EntriesWithURLPrefixContext(context.Background(), ns, prefix)
+}
+
+// EntriesWithURLPrefixContext is like EntriesWithURLPrefix but the iteration
+// stops with the error of the given context once it is done.
+func (r *Reader) EntriesWithURLPrefixContext(ctx context.Context, ns Namespace, prefix string) *EntryIterator {
+	lower, err := r.searchURLIndex(ctx, func(entry Entry) bool {
+		return compareURL(entry.Namespace(), entry.URL(), ns, prefix) >= 0
+	})
+	if err != nil {
+		return &EntryIterator{err: errors.WithStack(err)}
+	}
+
+	upper, err := r.searchURLIndex(ctx, func(entry Entry) bool {
+		return compareURL(entry.Namespace(), entry.URL(), ns, prefix) > 0 &&
+			(entry.Namespace() != ns || !strings.HasPrefix(entry.URL(), prefix))
+	})
+	if err != nil {
+		return &EntryIterator{err: errors.WithStack(err)}
+	}
+
+	return &EntryIterator{
+		ctx:     ctx,
+		index:   lower,
+		count:   upper,
+		entryAt: r.EntryAt,
+	}
+}
+
+// Namespaces returns the namespaces of the entries of the archive, in
+// order.
+func (r *Reader) Namespaces() ([]Namespace, error) {
+	return r.NamespacesContext(context.Background())
+}
+
+// NamespacesContext is like Namespaces but stops on the cancellation of the
+// given context.
+func (r *Reader) NamespacesContext(ctx context.Context) ([]Namespace, error) {
+	namespaces := make([]Namespace, 0)
+
+	for pos := 0; pos < len(r.urlIndex); {
+		entry, err := r.EntryAtContext(ctx, pos)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		ns := entry.Namespace()
+		namespaces = append(namespaces, ns)
+
+		// Skip to the first entry of the next namespace
+		pos, err = r.searchURLIndex(ctx, func(entry Entry) bool {
+			return entry.Namespace() > ns
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return namespaces, nil
+}
+
+// searchURLIndex returns the position of the first entry of the URL pointer
+// list for which the given predicate is true, the predicate being false
+// then true over the list.
+func (r *Reader) searchURLIndex(ctx context.Context, predicate func(entry Entry) bool) (int, error) {
+	var searchErr error
+
+	pos := sort.Search(len(r.urlIndex), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+
+		entry, err := r.EntryAtContext(ctx, i)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+
+		return predicate(entry)
+	})
+
+	if searchErr != nil {
+		return 0, errors.WithStack(searchErr)
+	}
+
+	return pos, nil
+}
+
+// EntryAtContext is like EntryAt but fails with the error of the given
+// context once it is done.
+func (r *Reader) EntryAtContext(ctx context.Context, idx int) (Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	entry, err := r.EntryAt(idx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entry, nil
+}
+
 func (r *Reader) EntryAt(idx int) (Entry, error) {
 	if idx >= len(r.urlIndex) || idx < 0 {
 		return nil, errors.Wrapf(ErrInvalidIndex, "index '%d' out of bounds", idx)
@@ -91,7 +288,7 @@ func (r *Reader) EntryAt(idx int) (Entry, error) {
 
 	entryPtr := r.urlIndex[idx]
 
-	entry, err := r.parseEntryAt(int64(entryPtr))
+	entry, err := r.parseEntryAt(idx, int64(entryPtr))
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -102,12 +299,32 @@ func (r *Reader) EntryAt(idx int) (Entry, error) {
 }
 
 func (r *Reader) EntryWithFullURL(url string) (Entry, error) {
-	urlNum, exists := r.urls[url]
-	if !exists {
+	return r.EntryWithFullURLContext(context.Background(), url)
+}
+
+// EntryWithFullURLContext is like EntryWithFullURL but stops on the
+// cancellation of the given context.
+func (r *Reader) EntryWithFullURLContext(ctx context.Context, url string) (Entry, error) {
+	if r.urls != nil {
+		urlNum, exists := r.urls[url]
+		if !exists {
+			return nil, errors.WithStack(ErrNotFound)
+		}
+
+		entry, err := r.EntryAtContext(ctx, urlNum)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return entry, nil
+	}
+
+	ns, url, found := strings.Cut(url, "/")
+	if !found || len(ns) != 1 {
 		return nil, errors.WithStack(ErrNotFound)
 	}
 
-	entry, err := r.EntryAt(urlNum)
+	entry, err := r.searchEntryWithURL(ctx, Namespace(ns), url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -116,9 +333,22 @@ func (r *Reader) EntryWithFullURL(url string) (Entry, error) {
 }
 
 func (r *Reader) EntryWithURL(ns Namespace, url string) (Entry, error) {
-	fullURL := toFullURL(ns, url)
+	return r.EntryWithURLContext(context.Background(), ns, url)
+}
+
+// EntryWithURLContext is like EntryWithURL but stops on the cancellation
+// of the given context.
+func (r *Reader) EntryWithURLContext(ctx context.Context, ns Namespace, url string) (Entry, error) {
+	if r.urls != nil {
+		entry, err := r.EntryWithFullURLContext(ctx, toFullURL(ns, url))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return entry, nil
+	}
 
-	entry, err := r.EntryWithFullURL(fullURL)
+	entry, err := r.searchEntryWithURL(ctx, ns, url)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -126,14 +356,61 @@ func (r *Reader) EntryWithURL(ns Namespace, url string) (Entry, error) {
 	return entry, nil
 }
 
+// searchEntryWithURL performs a binary search over the URL pointer list.
+// Entries are sorted by namespace then URL in the ZIM format, so a lookup
+// only needs to parse O(log n) entries.
+func (r *Reader) searchEntryWithURL(ctx context.Context, ns Namespace, url string) (Entry, error) {
+	lower, upper := 0, len(r.urlIndex)-1
+
+	for lower <= upper {
+		middle := lower + (upper-lower)/2
+
+		entry, err := r.EntryAtContext(ctx, middle)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		switch compareURL(ns, url, entry.Namespace(), entry.URL()) {
+		case 0:
+			return entry, nil
+		case -1:
+			upper = middle - 1
+		default:
+			lower = middle + 1
+		}
+	}
+
+	return nil, errors.WithStack(ErrNotFound)
+}
+
 func (r *Reader) EntryWithTitle(ns Namespace, title string) (Entry, error) {
+	return r.EntryWithTitleContext(context.Background(), ns, title)
+}
+
+// EntryWithTitleContext is like EntryWithTitle but stops on the
+// cancellation of the given context, which matters for archives without
+// title index as every entry may have to be scanned.
+func (r *Reader) EntryWithTitleContext(ctx context.Context, ns Namespace, title string) (Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	entry, found := r.getEntryByTitleFromCache(ns, title)
 	if found {
-		logger.Debug(context.Background(), "found entry with title from cache", logger.F("entry", entry.FullURL()))
+		logger.Debug(ctx, "found entry with title from cache", logger.F("entry", entry.FullURL()))
 		return entry, nil
 	}
 
-	iterator := r.Entries()
+	if r.titleIndex != nil {
+		entry, err := r.searchEntryWithTitle(ctx, ns, title)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return entry, nil
+	}
+
+	iterator := r.EntriesContext(ctx)
 
 	for iterator.Next() {
 		entry := iterator.Entry()
@@ -149,6 +426,48 @@ func (r *Reader) EntryWithTitle(ns Namespace, title string) (Entry, error) {
 	return nil, errors.WithStack(ErrNotFound)
 }
 
+// searchEntryWithTitle performs a binary search over the title index.
+func (r *Reader) searchEntryWithTitle(ctx context.Context, ns Namespace, title string) (Entry, error) {
+	lower, upper := 0, len(r.titleIndex)-1
+
+	for lower <= upper {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		middle := lower + (upper-lower)/2
+
+		entry, err := r.entryAtTitlePosition(middle)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		switch compareURL(ns, title, entry.Namespace(), entry.Title()) {
+		case 0:
+			return entry, nil
+		case -1:
+			upper = middle - 1
+		default:
+			lower = middle + 1
+		}
+	}
+
+	return nil, errors.WithStack(ErrNotFound)
+}
+
+func (r *Reader) entryAtTitlePosition(pos int) (Entry, error) {
+	if pos >= len(r.titleIndex) || pos < 0 {
+		return nil, errors.Wrapf(ErrInvalidIndex, "title index '%d' out of bounds", pos)
+	}
+
+	entry, err := r.EntryAt(int(r.titleIndex[pos]))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entry, nil
+}
+
 func (r *Reader) getURLCacheKey(fullURL string) string {
 	return "url:" + fullURL
 }
@@ -194,6 +513,10 @@ func (r *Reader) parse() error {
 		return errors.WithStack(err)
 	}
 
+	if err := r.parseTitleIndex(); err != nil {
+		return errors.WithStack(err)
+	}
+
 	return nil
 }
 
@@ -337,7 +660,7 @@ func (r *Reader) parseUUID(data []byte) error {
 		return errors.WithStack(err)
 	}
 
-	parts = append(parts, fmt.Sprintf("%x%x", val32, val16))
+	parts = append(parts, fmt.Sprintf("%08x%04x", val32, val16))
 
 	r.uuid = strings.Join(parts, "-")
 
@@ -345,22 +668,29 @@ func (r *Reader) parseUUID(data []byte) error {
 }
 
 func (r *Reader) parseMimeTypes() error {
+	const batchSize = 64
+
 	mimeTypes := make([]string, 0)
 	offset := int64(r.mimeListPos)
-	read := int64(0)
-	var err error
-	var found []string
+
 	for {
-		found, read, err = r.readStringsAt(offset+read, 64, 1024)
+		found, read, err := r.readStringsAt(offset, batchSize, 1024)
 		if err != nil && !errors.Is(err, io.EOF) {
 			return errors.WithStack(err)
 		}
 
+		offset += read
+
 		if len(found) == 0 || found[0] == "" {
 			break
 		}
 
 		mimeTypes = append(mimeTypes, found...)
+
+		// The list ended with an empty string before the batch was filled
+		if len(found) < batchSize {
+			break
+		}
 	}
 
 	r.mimeTypes = mimeTypes
@@ -380,22 +710,115 @@ func (r *Reader) parseURLIndex() error {
 }
 
 func (r *Reader) parseClusterIndex() error {
-	clusterIndex, err := r.parsePointerIndex(int64(r.clusterPtrPos), int64(r.clusterCount+1))
+	clusterIndex, err := r.parsePointerIndex(int64(r.clusterPtrPos), int64(r.clusterCount))
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	r.clusterIndex = clusterIndex
+	// The last cluster ends where the checksum begins
+	r.clusterIndex = append(clusterIndex, r.checksumPos)
 
 	return nil
 }
 
-func (r *Reader) parseEntryAt(offset int64) (Entry, error) {
+const (
+	titleListingV0URL        = "listing/titlesOrdered/v0"
+	noTitlePtrPos     uint64 = 0xffffffffffffffff
+)
+
+func (r *Reader) parseTitleIndex() error {
+	// Recent archives may store the title ordered listing as a dedicated
+	// entry, in which case the header title pointer might not be set.
+	titleIndex, err := r.readTitleListing(titleListingV0URL)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return errors.WithStack(err)
+	}
+
+	if titleIndex != nil {
+		r.titleIndex = titleIndex
+
+		return nil
+	}
+
+	if r.titlePtrPos == 0 || r.titlePtrPos == noTitlePtrPos {
+		return nil
+	}
+
+	data := make([]byte, int64(r.entryCount)*4)
+	if err := r.readRange(int64(r.titlePtrPos), data); err != nil {
+		return errors.WithStack(err)
+	}
+
+	titleIndex, err = decodeTitleIndex(data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	r.titleIndex = titleIndex
+
+	return nil
+}
+
+// readTitleListing reads the entry indexes of the given title ordered
+// listing of the search namespace.
+func (r *Reader) readTitleListing(url string) ([]uint32, error) {
+	listing, err := r.EntryWithURL(V6NamespaceSearch, url)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	content, err := listing.Redirect()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	reader, err := content.Reader()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	titleIndex, err := decodeTitleIndex(data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return titleIndex, nil
+}
+
+func decodeTitleIndex(data []byte) ([]uint32, error) {
+	count := len(data) / 4
+	index := make([]uint32, count)
+
+	for i := 0; i < count; i++ {
+		offset := i * 4
+		idx, err := readUint32(data[offset:offset+4], binary.LittleEndian)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		index[i] = idx
+	}
+
+	return index, nil
+}
+
+// parseEntryAt parses the entry at the given offset, idx being its position
+// in the URL pointer list.
+func (r *Reader) parseEntryAt(idx int, offset int64) (Entry, error) {
 	base, err := r.parseBaseEntry(offset)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	base.index = idx
+
 	var entry Entry
 
 	if base.mimeTypeIndex == zimRedirect {
@@ -435,7 +858,7 @@ func (r *Reader) parsePointerIndex(startAddr int64, count int64) ([]uint64, erro
 }
 
 func (r *Reader) getClusterOffsets(clusterNum int) (uint64, uint64, error) {
-	if clusterNum > len(r.clusterIndex)-1 || clusterNum < 0 {
+	if clusterNum >= len(r.clusterIndex)-1 || clusterNum < 0 {
 		return 0, 0, errors.Wrapf(ErrInvalidIndex, "index '%d' out of bounds", clusterNum)
 	}
 
@@ -479,11 +902,18 @@ func (r *Reader) readStringsAt(offset int64, count int, bufferSize int) ([]strin
 
 	for {
 		data := make([]byte, bufferSize)
-		err := r.readRange(offset+read, data)
+		n, err := r.reader.ReadAt(data, offset+read)
 		if err != nil && !errors.Is(err, io.EOF) {
 			return nil, read, errors.WithStack(err)
 		}
 
+		// Only consider the bytes actually read when reaching the end of the file
+		data = data[:n]
+
+		if n == 0 && errors.Is(err, io.EOF) {
+			return values, read, nil
+		}
+
 		for idx := 0; idx < len(data); idx++ {
 			d := data[idx]
 			if err := sb.WriteByte(d); err != nil {
@@ -502,7 +932,7 @@ func (r *Reader) readStringsAt(offset int64, count int, bufferSize int) ([]strin
 				str := strings.TrimRight(sb.String(), "\x00")
 				values = append(values, str)
 
-				if len(values) == count || errors.Is(err, io.EOF) {
+				if len(values) == count {
 					return values, read, nil
 				}
 
@@ -528,31 +958,72 @@ func NewReader(r ReadAtCloser, funcs ...OptionFunc) (*Reader, error) {
 	}
 
 	reader := &Reader{
-		reader: r,
-		cache:  cache,
+		reader:             r,
+		cache:              cache,
+		streamingThreshold: opts.StreamingThreshold,
+		decoders:           opts.Decoders,
+	}
+
+	if opts.ClusterCacheSize > 0 && opts.ClusterCacheBytes > 0 {
+		clusterCache, err := newClusterCache(opts.ClusterCacheSize, opts.ClusterCacheBytes)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		reader.clusterCache = clusterCache
+	}
+
+	if stater, ok := r.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if info, err := stater.Stat(); err == nil {
+			reader.modTime = info.ModTime()
+		}
 	}
 
 	if err := reader.parse(); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	if err := reader.preload(); err != nil {
-		return nil, errors.WithStack(err)
+	if opts.Preload {
+		if err := reader.preload(); err != nil {
+			return nil, errors.WithStack(err)
+		}
 	}
 
 	return reader, nil
 }
 
+// Open opens the archive at the given path. Split archives are detected
+// and their parts concatenated if the path designates the first part
+// (".zimaa") or a missing ".zim" file whose parts exist.
 func Open(path string, funcs ...OptionFunc) (*Reader, error) {
-	file, err := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
+	var file ReadAtCloser
+
+	partPaths, err := splitPartPaths(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if partPaths != nil {
+		file, err = openSplitArchive(partPaths)
+	} else {
+		file, err = os.OpenFile(path, os.O_RDONLY, os.ModePerm)
+	}
+
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	reader, err := NewReader(file, funcs...)
 	if err != nil {
+		file.Close()
 		return nil, errors.WithStack(err)
 	}
 
+	if partPaths != nil {
+		if info, err := os.Stat(partPaths[len(partPaths)-1]); err == nil {
+			reader.modTime = info.ModTime()
+		}
+	}
+
 	return reader, nil
 }
@@ -1,10 +1,13 @@
 package zim
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -55,6 +58,19 @@ func TestReader(t *testing.T) {
 				}
 			}()
 
+			if reader.ModTime().IsZero() {
+				t.Errorf("reader.ModTime(): expected the archive file modification time")
+			}
+
+			stat, err := os.Stat(zf)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := stat.Size(), reader.Size(); e != g {
+				t.Errorf("reader.Size(): expected '%d', got '%d'", e, g)
+			}
+
 			if e, g := testCase.UUID, reader.UUID(); e != g {
 				t.Errorf("reader.UUID(): expected '%s', got '%s'", e, g)
 			}
@@ -116,6 +132,531 @@ func TestReader(t *testing.T) {
 	}
 }
 
+func TestReaderEntryWithURL(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, zf := range files {
+		for _, preload := range []bool{false, true} {
+			testName := fmt.Sprintf("%s/Preload=%v", filepath.Base(zf), preload)
+			t.Run(testName, func(t *testing.T) {
+				reader, err := Open(zf, WithPreload(preload))
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				defer func() {
+					if err := reader.Close(); err != nil {
+						t.Errorf("%+v", errors.WithStack(err))
+					}
+				}()
+
+				count := 0
+
+				iterator := reader.Entries()
+				for iterator.Next() {
+					expected := iterator.Entry()
+					count++
+
+					entry, err := reader.EntryWithFullURL(expected.FullURL())
+					if err != nil {
+						t.Errorf("reader.EntryWithFullURL('%s'): %+v", expected.FullURL(), errors.WithStack(err))
+						continue
+					}
+
+					if e, g := expected.FullURL(), entry.FullURL(); e != g {
+						t.Errorf("reader.EntryWithFullURL(): expected '%s', got '%s'", e, g)
+					}
+
+					entry, err = reader.EntryWithURL(expected.Namespace(), expected.URL())
+					if err != nil {
+						t.Errorf("reader.EntryWithURL('%s', '%s'): %+v", expected.Namespace(), expected.URL(), errors.WithStack(err))
+						continue
+					}
+
+					if e, g := expected.FullURL(), entry.FullURL(); e != g {
+						t.Errorf("reader.EntryWithURL(): expected '%s', got '%s'", e, g)
+					}
+				}
+				if err := iterator.Err(); err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				if e, g := int(reader.EntryCount()), count; e != g {
+					t.Errorf("reader.Entries(): expected '%d' entries, got '%d'", e, g)
+				}
+
+				if _, err := reader.EntryWithURL(V5NamespaceArticle, "__does_not_exist__"); !errors.Is(err, ErrNotFound) {
+					t.Errorf("reader.EntryWithURL(): expected ErrNotFound, got '%v'", err)
+				}
+			})
+		}
+	}
+}
+
+func TestReaderEntriesByTitle(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, zf := range files {
+		t.Run(filepath.Base(zf), func(t *testing.T) {
+			reader, err := Open(zf)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := reader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			var previous Entry
+			count := 0
+
+			iterator := reader.EntriesByTitle()
+			for iterator.Next() {
+				entry := iterator.Entry()
+				count++
+
+				if previous != nil && compareURL(previous.Namespace(), previous.Title(), entry.Namespace(), entry.Title()) > 0 {
+					t.Errorf("reader.EntriesByTitle(): entry '%s' should not be after '%s'", entry.FullURL(), previous.FullURL())
+				}
+
+				previous = entry
+
+				found, err := reader.EntryWithTitle(entry.Namespace(), entry.Title())
+				if err != nil {
+					t.Errorf("reader.EntryWithTitle('%s', '%s'): %+v", entry.Namespace(), entry.Title(), errors.WithStack(err))
+					continue
+				}
+
+				if e, g := entry.Title(), found.Title(); e != g {
+					t.Errorf("reader.EntryWithTitle(): expected '%s', got '%s'", e, g)
+				}
+			}
+			if err := iterator.Err(); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := int(reader.EntryCount()), count; e != g {
+				t.Errorf("reader.EntriesByTitle(): expected '%d' entries, got '%d'", e, g)
+			}
+		})
+	}
+}
+
+func TestReaderClusterCache(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	// Collect two blobs stored in the same compressed cluster
+	var entries []*ContentEntry
+
+	iterator := reader.Entries()
+	for iterator.Next() && len(entries) < 2 {
+		content, ok := iterator.Entry().(*ContentEntry)
+		if !ok {
+			continue
+		}
+
+		compression, err := content.Compression()
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if compression != int(CompressionZStandard) {
+			continue
+		}
+
+		if len(entries) == 1 && entries[0].clusterIndex != content.clusterIndex {
+			continue
+		}
+
+		entries = append(entries, content)
+	}
+	if err := iterator.Err(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 2, len(entries); e != g {
+		t.Fatalf("expected '%d' entries, got '%d'", e, g)
+	}
+
+	for _, entry := range entries {
+		blobReader, err := entry.Reader()
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if _, err := io.ReadAll(blobReader); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	stats := reader.ClusterCacheStats()
+
+	if e, g := uint64(1), stats.Misses; e != g {
+		t.Errorf("stats.Misses: expected '%d', got '%d'", e, g)
+	}
+
+	if e, g := uint64(1), stats.Hits; e != g {
+		t.Errorf("stats.Hits: expected '%d', got '%d'", e, g)
+	}
+}
+
+func TestClusterCacheBytes(t *testing.T) {
+	cache, err := newClusterCache(16, 10)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	cache.Add(0, make([]byte, 4))
+	cache.Add(1, make([]byte, 4))
+	cache.Add(1, make([]byte, 4))
+	cache.Add(2, make([]byte, 4))
+	cache.Add(3, make([]byte, 11))
+
+	if cache.Contains(0) {
+		t.Errorf("expected the least recently used cluster to be evicted")
+	}
+
+	if !cache.Contains(1) || !cache.Contains(2) {
+		t.Errorf("expected the most recently used clusters to be cached")
+	}
+
+	if cache.Contains(3) {
+		t.Errorf("expected a cluster larger than the cache not to be cached")
+	}
+
+	if e, g := int64(8), cache.size; e != g {
+		t.Errorf("cache.size: expected '%d', got '%d'", e, g)
+	}
+}
+
+func TestReaderStreaming(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, zf := range files {
+		t.Run(filepath.Base(zf), func(t *testing.T) {
+			reader, err := Open(zf, WithClusterCacheSize(0))
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := reader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			streamingReader, err := Open(zf, WithClusterCacheSize(0), WithStreamingThreshold(0))
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := streamingReader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			iterator := reader.Entries()
+			for iterator.Next() {
+				content, ok := iterator.Entry().(*ContentEntry)
+				if !ok {
+					continue
+				}
+
+				expected, err := readEntryContent(content)
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				entry, err := streamingReader.EntryAt(iterator.Index())
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				blobReader, err := entry.(*ContentEntry).Reader()
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				size, err := blobReader.Size()
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				if e, g := int64(len(expected)), size; e != g {
+					t.Errorf("%s: blobReader.Size(): expected '%d', got '%d'", content.FullURL(), e, g)
+				}
+
+				middle := size / 2
+
+				if _, err := blobReader.Seek(middle, io.SeekStart); err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				tail, err := io.ReadAll(blobReader)
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				if !bytes.Equal(expected[middle:], tail) {
+					t.Errorf("%s: unexpected content after seeking to '%d'", content.FullURL(), middle)
+				}
+
+				if _, err := blobReader.Seek(0, io.SeekStart); err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				data, err := io.ReadAll(blobReader)
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				if !bytes.Equal(expected, data) {
+					t.Errorf("%s: unexpected content after seeking back to start", content.FullURL())
+				}
+
+				if err := blobReader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}
+			if err := iterator.Err(); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+		})
+	}
+}
+
+func TestUncompressedBlobReaderReadAt(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	entry, err := reader.EntryWithURL(V5NamespaceLayout, "favicon")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	content, err := entry.Redirect()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	expected, err := readEntryContent(content)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	blobReader, err := content.Reader()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer blobReader.Close()
+
+	readerAt, ok := blobReader.(io.ReaderAt)
+	if !ok {
+		t.Fatalf("expected blob reader to implement io.ReaderAt, got '%T'", blobReader)
+	}
+
+	offset := int64(len(expected) / 3)
+	data := make([]byte, len(expected)/3)
+
+	if _, err := readerAt.ReadAt(data, offset); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if !bytes.Equal(expected[offset:offset+int64(len(data))], data) {
+		t.Errorf("readerAt.ReadAt(): unexpected content at offset '%d'", offset)
+	}
+}
+
+func TestReaderWithDecoder(t *testing.T) {
+	calls := 0
+
+	decoder := func(r io.Reader) (io.ReadCloser, error) {
+		calls++
+		return ZStdDecoder(r)
+	}
+
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim", WithDecoder(CompressionZStandard, decoder))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	metadata, err := reader.Metadata(MetadataName)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "wikibooks_af_all", metadata[MetadataName]; e != g {
+		t.Errorf("metadata[MetadataName]: expected '%s', got '%s'", e, g)
+	}
+
+	if calls == 0 {
+		t.Errorf("expected custom decoder to be used")
+	}
+
+	if _, err := reader.decoder(Compression(42)); !errors.Is(err, ErrCompressionAlgorithmNotSupported) {
+		t.Errorf("reader.decoder(42): expected ErrCompressionAlgorithmNotSupported, got '%v'", err)
+	}
+}
+
+func TestNewCompressedBlobReader(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	entry, err := reader.EntryWithFullURL("M/Name")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	content := entry.(*ContentEntry)
+
+	expected, err := readEntryContent(content)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	start, end, err := reader.getClusterOffsets(int(content.clusterIndex))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Seekable decoders of the original API are still supported
+	var seekable BlobDecoderFactory = func(r io.Reader) (io.ReadSeekCloser, error) {
+		decoder, err := ZStdDecoder(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		defer decoder.Close()
+
+		data, err := io.ReadAll(decoder)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return &NoopReadSeekCloser{bytes.NewReader(data)}, nil
+	}
+
+	blobReaders := map[string]BlobReader{
+		"NewCompressedBlobReader": NewCompressedBlobReader(reader, seekable, start, end, content.blobIndex, 4),
+		"NewZStdBlobReader":       NewZStdBlobReader(reader, start, end, content.blobIndex, 4),
+	}
+
+	for name, blobReader := range blobReaders {
+		data, err := io.ReadAll(blobReader)
+		if err != nil {
+			t.Fatalf("%s: %+v", name, errors.WithStack(err))
+		}
+
+		if e, g := string(expected), string(data); e != g {
+			t.Errorf("%s: expected '%s', got '%s'", name, e, g)
+		}
+
+		if err := blobReader.Close(); err != nil {
+			t.Errorf("%s: %+v", name, errors.WithStack(err))
+		}
+	}
+}
+
+func TestCompressedBlobReaderInvalidIndex(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	entry, err := reader.EntryWithFullURL("M/Name")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	content := entry.(*ContentEntry)
+
+	start, end, err := reader.getClusterOffsets(int(content.clusterIndex))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, streaming := range []bool{true, false} {
+		// The index of a corrupted directory entry must not size any
+		// allocation
+		blobReader := newCompressedBlobReader(reader, ZStdDecoder, start, end, 1<<31, 4)
+		blobReader.streaming = streaming
+
+		if _, err := io.ReadAll(blobReader); !errors.Is(err, ErrInvalidIndex) {
+			t.Errorf("streaming '%v': expected ErrInvalidIndex, got '%v'", streaming, err)
+		}
+
+		if err := blobReader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}
+}
+
+func readEntryContent(content *ContentEntry) ([]byte, error) {
+	reader, err := content.Reader()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return data, nil
+}
+
 func loadZimFileTestCase(zimFile string) (*readerTestCase, error) {
 	testCaseFile, _ := strings.CutSuffix(zimFile, ".zim")
 
@@ -131,3 +672,69 @@ func loadZimFileTestCase(zimFile string) (*readerTestCase, error) {
 
 	return testCase, nil
 }
+
+func TestReaderEntriesWithURLPrefix(t *testing.T) {
+	reader, err := Open("testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	namespaces, err := reader.Namespaces()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := []Namespace{"A", "I", "M"}, namespaces; !slices.Equal(e, g) {
+		t.Errorf("reader.Namespaces(): expected '%v', got '%v'", e, g)
+	}
+
+	type testCase struct {
+		Namespace Namespace
+		Prefix    string
+		Expected  []string
+	}
+
+	testCases := []testCase{
+		{Namespace: V5NamespaceArticle, Prefix: "", Expected: []string{"A/Compression", "A/Diacritics", "A/Index", "A/Main_Page"}},
+		{Namespace: V5NamespaceArticle, Prefix: "Ma", Expected: []string{"A/Main_Page"}},
+		{Namespace: V5NamespaceImageFile, Prefix: "logo", Expected: []string{"I/logo.svg"}},
+		{Namespace: V5NamespaceArticle, Prefix: "Zz", Expected: []string{}},
+		{Namespace: "B", Prefix: "", Expected: []string{}},
+	}
+
+	for _, tc := range testCases {
+		urls := make([]string, 0)
+
+		iterator := reader.EntriesWithURLPrefix(tc.Namespace, tc.Prefix)
+		for iterator.Next() {
+			entry := iterator.Entry()
+			urls = append(urls, entry.FullURL())
+
+			indexed, err := reader.EntryAt(iterator.Index())
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := entry.FullURL(), indexed.FullURL(); e != g {
+				t.Errorf("iterator.Index(): expected entry '%s', got '%s'", e, g)
+			}
+
+			if e, g := iterator.Index(), entry.(interface{ Index() int }).Index(); e != g {
+				t.Errorf("entry.Index(): expected '%d', got '%d'", e, g)
+			}
+		}
+		if err := iterator.Err(); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if !slices.Equal(tc.Expected, urls) {
+			t.Errorf("reader.EntriesWithURLPrefix('%s', '%s'): expected '%v', got '%v'", tc.Namespace, tc.Prefix, tc.Expected, urls)
+		}
+	}
+}
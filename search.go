@@ -0,0 +1,586 @@
+package zim
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Full-text index locations, for the new (v6) and old (v5) namespace
+// schemes.
+const (
+	fullTextIndexURL   = "X/fulltext/xapian"
+	fullTextIndexV5URL = "Z/fulltextIndex/xapian"
+)
+
+// BM25 parameters, as used by default by Xapian.
+const (
+	bm25K1 = 1.0
+	bm25B  = 0.5
+)
+
+// BM25 weights the terms matching a document with the Okapi BM25 scheme,
+// using the parameters of Xapian so that the embedded and side-car indexes
+// rank the results of a query the same way.
+type BM25 struct {
+	// DocCount is the number of documents of the index.
+	DocCount uint64
+	// AvgDocLength is the average length of the documents of the index.
+	AvgDocLength float64
+}
+
+// Weight returns the weight of a term occurring wdf times in a document of
+// the given length, the term occurring in docFreq documents of the index.
+func (b BM25) Weight(docFreq uint64, wdf uint32, docLength uint32) float64 {
+	if wdf == 0 {
+		return 0
+	}
+
+	n := float64(b.DocCount)
+	freq := float64(docFreq)
+	idf := math.Log(1 + (n-freq+0.5)/(freq+0.5))
+
+	normLength := 1.0
+	if b.AvgDocLength > 0 {
+		normLength = float64(docLength) / b.AvgDocLength
+	}
+
+	tf := float64(wdf)
+
+	return idf * (tf * (bm25K1 + 1)) / (tf + bm25K1*((1-bm25B)+bm25B*normLength))
+}
+
+type SearchOptions struct {
+	Limit  int
+	Offset int
+	// SnippetSize is the number of words of the snippets, 0 disables them.
+	SnippetSize int
+}
+
+type SearchOptionFunc func(opts *SearchOptions)
+
+func NewSearchOptions(funcs ...SearchOptionFunc) *SearchOptions {
+	funcs = append([]SearchOptionFunc{
+		WithSearchLimit(25),
+		WithSearchOffset(0),
+		WithSearchSnippetSize(30),
+	}, funcs...)
+
+	opts := &SearchOptions{}
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+func WithSearchLimit(limit int) SearchOptionFunc {
+	return func(opts *SearchOptions) {
+		opts.Limit = limit
+	}
+}
+
+func WithSearchOffset(offset int) SearchOptionFunc {
+	return func(opts *SearchOptions) {
+		opts.Offset = offset
+	}
+}
+
+func WithSearchSnippetSize(size int) SearchOptionFunc {
+	return func(opts *SearchOptions) {
+		opts.SnippetSize = size
+	}
+}
+
+type SearchResult struct {
+	Entry   Entry
+	Score   float64
+	Snippet string
+}
+
+type SearchResults struct {
+	// Total is the number of entries matching the query.
+	Total   int
+	Results []SearchResult
+}
+
+// Search runs a query against the Xapian full-text index embedded in the
+// archive and returns the matching entries, ranked with BM25.
+//
+// All the words of the query must match. Double quoted words are matched as
+// a phrase if the index stores term positions, otherwise they are only
+// required to appear in the entry. ErrNotFound is returned if the archive
+// does not provide a full-text index.
+func (r *Reader) Search(ctx context.Context, query string, funcs ...SearchOptionFunc) (*SearchResults, error) {
+	opts := NewSearchOptions(funcs...)
+
+	db, err := r.openFullTextIndex()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	clauses := parseSearchQuery(query)
+	if len(clauses) == 0 {
+		return &SearchResults{}, nil
+	}
+
+	searcher := &xapianSearcher{
+		db:       db,
+		ctx:      ctx,
+		postings: make(map[string]map[uint32]uint32),
+		freqs:    make(map[string]uint64),
+	}
+
+	matches, err := searcher.search(clauses)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Hits whose entry is missing are filtered before paging, so that the
+	// total matches the results which can be returned
+	resolved, err := resolveSearchMatches(ctx, matches, func(docID uint32) (Entry, error) {
+		data, err := db.Data(docID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return r.entryWithIndexedPath(string(data))
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	results := &SearchResults{
+		Total:   len(resolved),
+		Results: make([]SearchResult, 0),
+	}
+
+	if opts.Offset >= len(resolved) {
+		return results, nil
+	}
+
+	resolved = resolved[opts.Offset:]
+	if opts.Limit > 0 && len(resolved) > opts.Limit {
+		resolved = resolved[:opts.Limit]
+	}
+
+	terms := searcher.terms(clauses)
+
+	for _, result := range resolved {
+		if opts.SnippetSize > 0 {
+			snippet, err := r.snippet(result.Entry, terms, opts.SnippetSize)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			result.Snippet = snippet
+		}
+
+		results.Results = append(results.Results, result)
+	}
+
+	return results, nil
+}
+
+// resolveSearchMatches returns the results of the given matches, in the same
+// order, skipping the matches whose entry is not found.
+func resolveSearchMatches(ctx context.Context, matches []searchMatch, resolve func(docID uint32) (Entry, error)) ([]SearchResult, error) {
+	results := make([]SearchResult, 0, len(matches))
+
+	for _, m := range matches {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		entry, err := resolve(m.docID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+
+			return nil, errors.WithStack(err)
+		}
+
+		results = append(results, SearchResult{Entry: entry, Score: m.score})
+	}
+
+	return results, nil
+}
+
+func (r *Reader) openFullTextIndex() (*glassDatabase, error) {
+	r.fullTextIndexOnce.Do(func() {
+		r.fullTextIndex, r.fullTextIndexErr = r.loadFullTextIndex()
+	})
+
+	return r.fullTextIndex, r.fullTextIndexErr
+}
+
+func (r *Reader) loadFullTextIndex() (*glassDatabase, error) {
+	var (
+		entry Entry
+		err   error
+	)
+
+	for _, url := range []string{fullTextIndexURL, fullTextIndexV5URL} {
+		entry, err = r.EntryWithFullURL(url)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, ErrNotFound) {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if entry == nil {
+		return nil, errors.Wrap(ErrNotFound, "archive does not provide a full-text index")
+	}
+
+	content, err := entry.Redirect()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	blob, err := content.Reader()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Full-text indexes are stored in uncompressed clusters and read in
+	// place. Otherwise, the index has to be loaded in memory.
+	readerAt, ok := blob.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(blob)
+		if err != nil {
+			blob.Close()
+			return nil, errors.WithStack(err)
+		}
+
+		if err := blob.Close(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		readerAt = bytes.NewReader(data)
+	}
+
+	db, err := openGlassDatabase(readerAt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open full-text index '%s'", entry.FullURL())
+	}
+
+	return db, nil
+}
+
+// entryWithIndexedPath returns the entry referenced by the data of an
+// indexed document: a full URL for archives using the old namespace scheme,
+// or a path in the content namespace for the newer ones.
+func (r *Reader) entryWithIndexedPath(path string) (Entry, error) {
+	entry, err := r.EntryWithFullURL(path)
+	if err == nil {
+		return entry, nil
+	}
+
+	if !errors.Is(err, ErrNotFound) {
+		return nil, errors.WithStack(err)
+	}
+
+	entry, err = r.EntryWithURL(V6NamespaceContent, path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entry, nil
+}
+
+// searchClause is a single word, or a phrase if it holds multiple terms.
+type searchClause []string
+
+func parseSearchQuery(query string) []searchClause {
+	clauses := make([]searchClause, 0)
+
+	for i, part := range strings.Split(query, `"`) {
+		terms := Tokenize(part)
+
+		// Odd parts are enclosed in double quotes
+		if i%2 == 1 && len(terms) > 1 {
+			clauses = append(clauses, searchClause(terms))
+			continue
+		}
+
+		for _, t := range terms {
+			clauses = append(clauses, searchClause{t})
+		}
+	}
+
+	return clauses
+}
+
+type searchMatch struct {
+	docID uint32
+	score float64
+}
+
+type xapianSearcher struct {
+	db       *glassDatabase
+	ctx      context.Context
+	postings map[string]map[uint32]uint32
+	freqs    map[string]uint64
+}
+
+func (s *xapianSearcher) terms(clauses []searchClause) []string {
+	terms := make([]string, 0)
+	seen := make(map[string]struct{})
+
+	for _, clause := range clauses {
+		for _, t := range clause {
+			if _, exists := seen[t]; exists {
+				continue
+			}
+
+			seen[t] = struct{}{}
+			terms = append(terms, t)
+		}
+	}
+
+	return terms
+}
+
+func (s *xapianSearcher) load(term string) (map[uint32]uint32, error) {
+	if postings, exists := s.postings[term]; exists {
+		return postings, nil
+	}
+
+	if err := s.ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	freq, list, err := s.db.Postings(term)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	postings := make(map[uint32]uint32, len(list))
+	for _, p := range list {
+		postings[p.docID] = p.wdf
+	}
+
+	s.postings[term] = postings
+	s.freqs[term] = freq
+
+	return postings, nil
+}
+
+func (s *xapianSearcher) search(clauses []searchClause) ([]searchMatch, error) {
+	terms := s.terms(clauses)
+
+	// Start with the rarest term to keep the candidate set small
+	for _, t := range terms {
+		if _, err := s.load(t); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	sort.SliceStable(terms, func(i, j int) bool {
+		return len(s.postings[terms[i]]) < len(s.postings[terms[j]])
+	})
+
+	candidates := make([]uint32, 0, len(s.postings[terms[0]]))
+	for docID := range s.postings[terms[0]] {
+		candidates = append(candidates, docID)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+
+	lengths := &glassDocLengths{db: s.db}
+	matches := make([]searchMatch, 0)
+	avgLength := s.db.averageDocLength()
+
+	for _, docID := range candidates {
+		if err := s.ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		matched, err := s.matches(docID, clauses)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if !matched {
+			continue
+		}
+
+		length, err := lengths.Get(docID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		score := 0.0
+		for _, t := range terms {
+			score += s.weight(t, s.postings[t][docID], length, avgLength)
+		}
+
+		matches = append(matches, searchMatch{docID: docID, score: score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	return matches, nil
+}
+
+func (s *xapianSearcher) matches(docID uint32, clauses []searchClause) (bool, error) {
+	for _, clause := range clauses {
+		for _, t := range clause {
+			if _, exists := s.postings[t][docID]; !exists {
+				return false, nil
+			}
+		}
+
+		if len(clause) < 2 || !s.db.HasPositions() {
+			continue
+		}
+
+		matched, err := s.matchesPhrase(docID, clause)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if !matched {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (s *xapianSearcher) matchesPhrase(docID uint32, phrase searchClause) (bool, error) {
+	positions := make([]map[uint32]struct{}, len(phrase))
+
+	var first []uint32
+
+	for i, t := range phrase {
+		list, err := s.db.Positions(t, docID)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if i == 0 {
+			first = list
+			continue
+		}
+
+		positions[i] = make(map[uint32]struct{}, len(list))
+		for _, p := range list {
+			positions[i][p] = struct{}{}
+		}
+	}
+
+	for _, start := range first {
+		matched := true
+
+		for i := 1; i < len(phrase); i++ {
+			if _, exists := positions[i][start+uint32(i)]; !exists {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *xapianSearcher) weight(term string, wdf uint32, length uint32, avgLength float64) float64 {
+	bm25 := BM25{DocCount: s.db.docCount, AvgDocLength: avgLength}
+	return bm25.Weight(s.freqs[term], wdf, length)
+}
+
+// snippet returns an excerpt of the text of the given entry around the
+// first occurrence of one of the given terms.
+func (r *Reader) snippet(entry Entry, terms []string, size int) (string, error) {
+	content, err := entry.Redirect()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if !strings.HasPrefix(content.MimeType(), "text/html") {
+		return "", nil
+	}
+
+	blob, err := content.Reader()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	defer blob.Close()
+
+	text, err := ExtractText(blob)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return Snippet(text, terms, size), nil
+}
+
+// Snippet returns an excerpt of at most size words of the given text,
+// starting a few words before the first occurrence of one of the given
+// terms.
+func Snippet(text string, terms []string, size int) string {
+	words := strings.Fields(text)
+	if len(words) == 0 || size <= 0 {
+		return ""
+	}
+
+	wanted := make(map[string]struct{}, len(terms))
+	for _, t := range terms {
+		wanted[t] = struct{}{}
+	}
+
+	start := 0
+
+	for i, w := range words {
+		found := false
+
+		for _, t := range Tokenize(w) {
+			if _, exists := wanted[t]; exists {
+				found = true
+				break
+			}
+		}
+
+		if found {
+			start = i - size/4
+			break
+		}
+	}
+
+	if start < 0 {
+		start = 0
+	}
+
+	end := start + size
+	if end > len(words) {
+		end = len(words)
+	}
+
+	snippet := strings.Join(words[start:end], " ")
+
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+
+	if end < len(words) {
+		snippet += "..."
+	}
+
+	return snippet
+}
@@ -0,0 +1,360 @@
+package zim
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestReaderSearch(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	ctx := context.Background()
+
+	type testCase struct {
+		Query         string
+		ExpectedTotal int
+		ExpectedFirst string
+	}
+
+	testCases := []testCase{
+		{Query: "sop", ExpectedTotal: 17, ExpectedFirst: "A/Kookboek"},
+		{Query: "Boontjie SOP", ExpectedTotal: 4, ExpectedFirst: "A/Boontjie_sop"},
+		{Query: `"boontjie sop"`, ExpectedTotal: 4, ExpectedFirst: "A/Boontjie_sop"},
+		{Query: "xyzzy", ExpectedTotal: 0},
+		{Query: "", ExpectedTotal: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Query, func(t *testing.T) {
+			results, err := reader.Search(ctx, tc.Query, WithSearchLimit(3))
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := tc.ExpectedTotal, results.Total; e != g {
+				t.Errorf("results.Total: expected '%d', got '%d'", e, g)
+			}
+
+			if e, g := min(3, tc.ExpectedTotal), len(results.Results); e != g {
+				t.Fatalf("len(results.Results): expected '%d', got '%d'", e, g)
+			}
+
+			if tc.ExpectedTotal == 0 {
+				return
+			}
+
+			if e, g := tc.ExpectedFirst, results.Results[0].Entry.FullURL(); e != g {
+				t.Errorf("results.Results[0].Entry.FullURL(): expected '%s', got '%s'", e, g)
+			}
+
+			if snippet := results.Results[0].Snippet; !strings.Contains(strings.ToLower(snippet), "sop") {
+				t.Errorf("snippet of first result does not contain 'sop': '%s'", snippet)
+			}
+
+			for i, r := range results.Results {
+				if i > 0 && r.Score > results.Results[i-1].Score {
+					t.Errorf("result '%d' has a greater score than the previous one", i)
+				}
+
+				if r.Snippet == "" {
+					t.Errorf("snippet of result '%s' should not be empty", r.Entry.FullURL())
+				}
+			}
+		})
+	}
+
+	paged, err := reader.Search(ctx, "sop", WithSearchOffset(15), WithSearchSnippetSize(0))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 2, len(paged.Results); e != g {
+		t.Errorf("len(paged.Results): expected '%d', got '%d'", e, g)
+	}
+
+	for _, r := range paged.Results {
+		if r.Snippet != "" {
+			t.Errorf("snippet of result '%s' should be empty", r.Entry.FullURL())
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := reader.Search(cancelled, "sop"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled error, got '%v'", err)
+	}
+}
+
+func TestResolveSearchMatches(t *testing.T) {
+	reader, err := Open("testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer reader.Close()
+
+	mainPage, err := reader.MainPage()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	matches := []searchMatch{{docID: 1, score: 3}, {docID: 2, score: 2}, {docID: 3, score: 1}}
+
+	// The entry of the second hit is missing from the archive
+	results, err := resolveSearchMatches(context.Background(), matches, func(docID uint32) (Entry, error) {
+		if docID == 2 {
+			return nil, errors.WithStack(ErrNotFound)
+		}
+
+		return mainPage, nil
+	})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	scores := make([]float64, 0, len(results))
+	for _, r := range results {
+		scores = append(scores, r.Score)
+	}
+
+	if e, g := []float64{3, 1}, scores; !reflect.DeepEqual(e, g) {
+		t.Errorf("scores: expected '%v', got '%v'", e, g)
+	}
+
+	failure := errors.New("failure")
+
+	if _, err := resolveSearchMatches(context.Background(), matches, func(docID uint32) (Entry, error) { return nil, failure }); !errors.Is(err, failure) {
+		t.Errorf("expected error '%v', got '%v'", failure, err)
+	}
+}
+
+func TestReaderSearchWithoutIndex(t *testing.T) {
+	reader, err := Open("testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	if _, err := reader.Search(context.Background(), "test"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound error, got '%v'", err)
+	}
+}
+
+func TestGlassDatabase(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	db, err := reader.openFullTextIndex()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Walk the whole posting list table
+	postList := db.tables[glassTablePostList]
+	cursor := postList.cursor()
+
+	ok, err := cursor.Seek(nil)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	count := uint64(0)
+	var previous []byte
+
+	for ok {
+		item, err := cursor.Item()
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if previous != nil && string(previous) >= string(item.key) {
+			t.Errorf("key '%x' is not after key '%x'", item.key, previous)
+		}
+
+		previous = append(previous[:0], item.key...)
+		count++
+
+		if ok, err = cursor.Next(); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	// The table count does not include the null item of the first block
+	if e, g := postList.entryCount+1, count; e != g {
+		t.Errorf("posting list table items: expected '%d', got '%d'", e, g)
+	}
+
+	lengths := &glassDocLengths{db: db}
+	total := uint64(0)
+
+	for docID := uint32(db.lastDocID); docID >= 1; docID-- {
+		length, err := lengths.Get(docID)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		total += uint64(length)
+	}
+
+	if e, g := db.totalDocLength, total; e != g {
+		t.Errorf("total document length: expected '%d', got '%d'", e, g)
+	}
+}
+
+func TestGlassDecodePositions(t *testing.T) {
+	type testCase struct {
+		Data     []byte
+		Expected []uint32
+	}
+
+	testCases := []testCase{
+		{Data: []byte{0x07}, Expected: []uint32{7}},
+		{Data: []byte{0x09, 0x03}, Expected: []uint32{3, 9}},
+		{Data: []byte{0x05, 0x0d}, Expected: []uint32{1, 2, 3, 4, 5}},
+		{Data: []byte{0x80, 0x08, 0x02, 0x18, 0x70, 0x80, 0xba, 0xc1, 0x16, 0x08}, Expected: []uint32{2, 5, 11, 12, 40, 41, 300, 1024}},
+	}
+
+	for _, tc := range testCases {
+		positions, err := glassDecodePositions(tc.Data)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if !reflect.DeepEqual(tc.Expected, positions) {
+			t.Errorf("glassDecodePositions(%x): expected '%v', got '%v'", tc.Data, tc.Expected, positions)
+		}
+	}
+}
+
+func TestGlassPackUintPreservingSort(t *testing.T) {
+	values := []uint64{0, 1, 0x1f, 0x20, 0xff, 0x100, 0x12c, 0x1fff, 0x2000, 0xffffff, 1 << 40}
+	packed := make([]string, len(values))
+
+	for i, v := range values {
+		packed[i] = glassPackUintPreservingSort(v)
+
+		unpacked, rest, err := glassUnpackUintPreservingSort([]byte(packed[i]))
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if unpacked != v || len(rest) != 0 {
+			t.Errorf("glassUnpackUintPreservingSort(%x): expected '%d', got '%d'", packed[i], v, unpacked)
+		}
+	}
+
+	if !sort.StringsAreSorted(packed) {
+		t.Errorf("packed values are not sorted: %x", packed)
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	html := `<html><head><title>Title</title><style>p { color: red; }</style></head>
+<body><h1>Crème&nbsp;brûlée</h1><script>alert("no");</script><p>A <b>rich</b>   custard &amp; caramel.</p></body></html>`
+
+	text, err := ExtractText(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "Crème brûlée A rich custard & caramel.", text; e != g {
+		t.Errorf("ExtractText(): expected '%s', got '%s'", e, g)
+	}
+
+	if e, g := []string{"crème", "brûlée", "a", "rich", "custard", "caramel", "1.5", "l'eau"}, Tokenize(text+" 1.5 l'eau."); !reflect.DeepEqual(e, g) {
+		t.Errorf("Tokenize(): expected '%v', got '%v'", e, g)
+	}
+
+}
+
+func TestGlassDatabaseCorrupted(t *testing.T) {
+	reader, err := Open("testdata/wikibooks_af_all_maxi_2023-06.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer reader.Close()
+
+	entry, err := reader.EntryWithFullURL(fullTextIndexURL)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	content, err := entry.Redirect()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	data, err := readEntryContent(content)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Truncated databases must be rejected without panicking
+	for size := 0; size < 2048; size++ {
+		if _, err := openGlassDatabase(bytes.NewReader(data[:size])); err == nil && size < len(glassMagic)+18 {
+			t.Errorf("expected an error on a database truncated to '%d' bytes", size)
+		}
+	}
+
+	// Corrupted blocks must only lead to errors
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 2000; i++ {
+		corrupted := append([]byte(nil), data...)
+
+		for j := 0; j < 8; j++ {
+			corrupted[2048+rnd.Intn(len(corrupted)-2048)] = byte(rnd.Intn(256))
+		}
+
+		db, err := openGlassDatabase(bytes.NewReader(corrupted))
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		for _, term := range []string{"sop", "boek", "kos"} {
+			_, postings, err := db.Postings(term)
+			if err != nil {
+				continue
+			}
+
+			lengths := &glassDocLengths{db: db}
+
+			for _, p := range postings {
+				_, _ = lengths.Get(p.docID)
+				_, _ = db.Data(p.docID)
+				_, _ = db.Positions(term, p.docID)
+			}
+		}
+	}
+}
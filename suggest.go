@@ -0,0 +1,315 @@
+package zim
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// titleListingV1URL is the title ordered listing of the front articles.
+const titleListingV1URL = "listing/titlesOrdered/v1"
+
+// maxFoldedRune is the upper bound of the runes considered when looking for
+// the case and diacritic variants of a character.
+const maxFoldedRune = 0x3000
+
+// Suggestion is an entry whose title matches a suggestion prefix.
+type Suggestion struct {
+	// Title is the title of the matching entry, which may be a redirect
+	// to Entry.
+	Title string
+	Entry *ContentEntry
+}
+
+// SuggestTitles returns at most limit entries whose title starts with the
+// given prefix, ignoring case and diacritics, in title order. Redirects are
+// resolved to their target and each target is only suggested once.
+//
+// The front articles listing is used if the archive provides one, otherwise
+// the entries of the article namespaces of the title pointer list are
+// suggested. ErrNotFound is returned if the archive does not provide any
+// title index.
+func (r *Reader) SuggestTitles(ctx context.Context, prefix string, limit int) ([]Suggestion, error) {
+	lists, err := r.suggestionLists()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	suggester := &titleSuggester{
+		ctx:         ctx,
+		limit:       limit,
+		seen:        make(map[string]struct{}),
+		suggestions: make([]Suggestion, 0),
+	}
+
+	target := foldTitle(prefix)
+
+	for _, list := range lists {
+		suggester.list = list
+
+		done, err := suggester.walk("", target)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if done {
+			break
+		}
+	}
+
+	return suggester.suggestions, nil
+}
+
+func (r *Reader) suggestionLists() ([]*titleList, error) {
+	r.frontArticlesOnce.Do(func() {
+		r.frontArticles, r.frontArticlesErr = r.readTitleListing(titleListingV1URL)
+		if errors.Is(r.frontArticlesErr, ErrNotFound) {
+			r.frontArticlesErr = nil
+		}
+	})
+
+	if r.frontArticlesErr != nil {
+		return nil, errors.WithStack(r.frontArticlesErr)
+	}
+
+	if r.frontArticles != nil {
+		return []*titleList{
+			{reader: r, namespace: V6NamespaceContent, indexes: r.frontArticles},
+		}, nil
+	}
+
+	if r.titleIndex == nil {
+		return nil, errors.Wrap(ErrNotFound, "archive does not provide a title index")
+	}
+
+	return []*titleList{
+		{reader: r, namespace: V5NamespaceArticle, indexes: r.titleIndex},
+		{reader: r, namespace: V6NamespaceContent, indexes: r.titleIndex},
+	}, nil
+}
+
+// titleList is a list of entry indexes ordered by namespace and title, from
+// which only the entries of a namespace are considered.
+type titleList struct {
+	reader    *Reader
+	namespace Namespace
+	indexes   []uint32
+}
+
+func (l *titleList) at(pos int) (Entry, error) {
+	entry, err := l.reader.EntryAt(int(l.indexes[pos]))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entry, nil
+}
+
+// lowerBound returns the position of the first entry whose title is greater
+// than or equal to the given title.
+func (l *titleList) lowerBound(title string) (int, error) {
+	var searchErr error
+
+	pos := sort.Search(len(l.indexes), func(i int) bool {
+		entry, err := l.at(i)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+
+		return compareURL(entry.Namespace(), entry.Title(), l.namespace, title) >= 0
+	})
+
+	if searchErr != nil {
+		return 0, errors.WithStack(searchErr)
+	}
+
+	return pos, nil
+}
+
+// hasPrefix returns true if the entry at the given position is in the
+// namespace of the list and has a title starting with the given prefix.
+func (l *titleList) hasPrefix(pos int, prefix string) (Entry, bool, error) {
+	if pos >= len(l.indexes) {
+		return nil, false, nil
+	}
+
+	entry, err := l.at(pos)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	if entry.Namespace() != l.namespace || !strings.HasPrefix(entry.Title(), prefix) {
+		return nil, false, nil
+	}
+
+	return entry, true, nil
+}
+
+type titleSuggester struct {
+	ctx         context.Context
+	list        *titleList
+	limit       int
+	seen        map[string]struct{}
+	suggestions []Suggestion
+}
+
+// walk looks for the titles starting with the raw prefix followed by
+// characters folding to the remaining target. Titles are sorted by bytes, so
+// each variant of the next character of the target is explored in turn,
+// pruning the variants which do not start any title. It returns true once
+// the limit is reached.
+func (s *titleSuggester) walk(raw string, target string) (bool, error) {
+	if err := s.ctx.Err(); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if target == "" {
+		return s.collect(raw)
+	}
+
+	first, _ := utf8.DecodeRuneInString(target)
+
+	for _, variant := range foldVariants(first) {
+		folded := foldTitle(string(variant))
+
+		var next string
+
+		switch {
+		case strings.HasPrefix(target, folded):
+			next = target[len(folded):]
+		case strings.HasPrefix(folded, target):
+			next = ""
+		default:
+			continue
+		}
+
+		candidate := raw + string(variant)
+
+		pos, err := s.list.lowerBound(candidate)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if _, ok, err := s.list.hasPrefix(pos, candidate); err != nil || !ok {
+			if err != nil {
+				return false, errors.WithStack(err)
+			}
+
+			continue
+		}
+
+		done, err := s.walk(candidate, next)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if done {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// collect adds the entries whose title starts with the given prefix to the
+// suggestions.
+func (s *titleSuggester) collect(prefix string) (bool, error) {
+	pos, err := s.list.lowerBound(prefix)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	for ; ; pos++ {
+		if len(s.suggestions) >= s.limit {
+			return true, nil
+		}
+
+		if err := s.ctx.Err(); err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		entry, ok, err := s.list.hasPrefix(pos, prefix)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if !ok {
+			return false, nil
+		}
+
+		content, err := entry.Redirect()
+		if err != nil {
+			if errors.Is(err, ErrInvalidRedirect) {
+				continue
+			}
+
+			return false, errors.WithStack(err)
+		}
+
+		if _, exists := s.seen[content.FullURL()]; exists {
+			continue
+		}
+
+		s.seen[content.FullURL()] = struct{}{}
+
+		s.suggestions = append(s.suggestions, Suggestion{
+			Title: entry.Title(),
+			Entry: content,
+		})
+	}
+}
+
+// foldTitle returns the given string lower cased and without diacritics.
+func foldTitle(s string) string {
+	var b strings.Builder
+
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+var (
+	foldVariantsOnce  sync.Once
+	foldVariantsTable map[rune][]rune
+)
+
+// foldVariants returns the runes whose folded form starts with the given
+// folded rune, in increasing order.
+func foldVariants(folded rune) []rune {
+	foldVariantsOnce.Do(func() {
+		foldVariantsTable = make(map[rune][]rune)
+
+		for r := rune(0); r < maxFoldedRune; r++ {
+			if !utf8.ValidRune(r) {
+				continue
+			}
+
+			f := foldTitle(string(r))
+			if f == "" {
+				continue
+			}
+
+			first, _ := utf8.DecodeRuneInString(f)
+			foldVariantsTable[first] = append(foldVariantsTable[first], r)
+		}
+	})
+
+	if variants, exists := foldVariantsTable[folded]; exists {
+		return variants
+	}
+
+	return []rune{folded}
+}
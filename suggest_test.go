@@ -0,0 +1,112 @@
+package zim
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestReaderSuggestTitles(t *testing.T) {
+	type testCase struct {
+		File     string
+		Prefix   string
+		Limit    int
+		Expected []string
+	}
+
+	testCases := []testCase{
+		{
+			File:   "testdata/wikibooks_af_all_maxi_2023-06.zim",
+			Prefix: "HOË",
+			Limit:  4,
+			Expected: []string{
+				"Hoe kan ek bydra -> A/Wikibooks:Hoe_kan_ek_bydra",
+				"Hoe om 'n atlas te gebruik -> A/Hoe_om_'n_atlas_te_gebruik",
+				"Hoe om te gebruik -> A/Hoe_om_te_gebruik",
+				"Hoërskool Natuur- en Skeikunde -> A/Hoërskool_Natuur-_en_Skeikunde",
+			},
+		},
+		{
+			File:   "testdata/wikibooks_af_all_maxi_2023-06.zim",
+			Prefix: "boont",
+			Limit:  10,
+			Expected: []string{
+				"Boontjie slaai -> A/Boontjie_slaai",
+				"Boontjie sop -> A/Boontjie_sop",
+				"Boontjie sop met spekblokkies -> A/Boontjie_sop_met_spekblokkies",
+			},
+		},
+		{
+			File:     "testdata/go-zim_test_zlib_2024-01.zim",
+			Prefix:   "creme B",
+			Limit:    10,
+			Expected: []string{"Crème brûlée -> A/Diacritics"},
+		},
+		{
+			File:     "testdata/go-zim_test_zlib_2024-01.zim",
+			Prefix:   "in",
+			Limit:    10,
+			Expected: []string{"Index -> A/Main_Page"},
+		},
+		{
+			File:   "testdata/go-zim_test_zlib_2024-01.zim",
+			Prefix: "",
+			Limit:  10,
+			Expected: []string{
+				"Compression -> A/Compression",
+				"Crème brûlée -> A/Diacritics",
+				"Index -> A/Main_Page",
+			},
+		},
+		{
+			File:     "testdata/go-zim_test_zlib_2024-01.zim",
+			Prefix:   "",
+			Limit:    1,
+			Expected: []string{"Compression -> A/Compression"},
+		},
+		{
+			File:     "testdata/go-zim_test_zlib_2024-01.zim",
+			Prefix:   "xyz",
+			Limit:    10,
+			Expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s/%s", tc.File, tc.Prefix), func(t *testing.T) {
+			reader, err := Open(tc.File)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := reader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			suggestions, err := reader.SuggestTitles(context.Background(), tc.Prefix, tc.Limit)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := len(tc.Expected), len(suggestions); e != g {
+				t.Fatalf("len(suggestions): expected '%d', got '%d'", e, g)
+			}
+
+			for i, s := range suggestions {
+				if e, g := tc.Expected[i], fmt.Sprintf("%s -> %s", s.Title, s.Entry.FullURL()); e != g {
+					t.Errorf("suggestions[%d]: expected '%s', got '%s'", i, e, g)
+				}
+			}
+		})
+	}
+}
+
+func TestFoldTitle(t *testing.T) {
+	if e, g := "creme brulee", foldTitle("Crème BRÛLÉE"); e != g {
+		t.Errorf("foldTitle(): expected '%s', got '%s'", e, g)
+	}
+}
@@ -0,0 +1,184 @@
+#!/usr/bin/env python3
+"""Generates the go-zim_test_zlib_2024-01.zim and go-zim_test_bzip2_2024-01.zim
+test archives.
+
+Usage, from the root of the repository:
+
+    python3 testdata/generate_compressed_archives.py
+
+The archives are written byte by byte following the ZIM v5 layout, with a
+compressed cluster holding the articles and the metadata and an uncompressed
+one holding an image. Python is used as the standard library of Go has no
+bzip2 encoder, and zim.Writer only writes zstd, xz and uncompressed
+clusters.
+
+The output is deterministic: running this script again must leave the
+committed archives unchanged. The expectations of the reader tests, in the
+.json files of the same name, are maintained by hand.
+"""
+
+import bz2
+import hashlib
+import struct
+import uuid
+import zlib
+
+ZIM_MAGIC = 72173914
+NO_LAYOUT_PAGE = 0xFFFFFFFF
+REDIRECT_MIME_TYPE = 0xFFFF
+UNCOMPRESSED = 1
+
+MIME_TYPES = ["text/html", "text/plain", "image/svg+xml"]
+HTML, TEXT, SVG = range(len(MIME_TYPES))
+
+COMPRESSED_CLUSTER, UNCOMPRESSED_CLUSTER = 0, 1
+
+
+def html(title, body):
+    return (
+        '<!DOCTYPE html><html><head><meta charset="utf-8"><title>%s</title></head>'
+        "<body><h1>%s</h1>%s</body></html>" % (title, title, body)
+    ).encode()
+
+
+def content_entries(compression_name):
+    """Returns the content entries as (namespace, url, title, mime type
+    index, content, cluster) tuples."""
+    return [
+        ("A", "Main_Page", "Main Page", HTML, html("Main Page", '<p>Welcome to this test archive.</p><p><a href="Compression">Compression</a></p>' + "<p>Lorem ipsum dolor sit amet.</p>" * 50), COMPRESSED_CLUSTER),
+        ("A", "Compression", "Compression", HTML, html("Compression", "<p>Clusters of this archive are compressed.</p>" + "<p>Consectetur adipiscing elit.</p>" * 80), COMPRESSED_CLUSTER),
+        ("A", "Diacritics", "Crème brûlée", HTML, html("Crème brûlée", "<p>Une recette française.</p>"), COMPRESSED_CLUSTER),
+        ("I", "logo.svg", "logo.svg", SVG, b'<svg xmlns="http://www.w3.org/2000/svg" width="48" height="48"><rect width="48" height="48" fill="#336699"/></svg>', UNCOMPRESSED_CLUSTER),
+        ("M", "Creator", "", TEXT, b"go-zim", COMPRESSED_CLUSTER),
+        ("M", "Date", "", TEXT, b"2024-01-30", COMPRESSED_CLUSTER),
+        ("M", "Description", "", TEXT, b"Test archive with %s compressed clusters" % compression_name.encode(), COMPRESSED_CLUSTER),
+        ("M", "Language", "", TEXT, b"eng", COMPRESSED_CLUSTER),
+        ("M", "Name", "", TEXT, ("go-zim_test_%s" % compression_name).encode(), COMPRESSED_CLUSTER),
+        ("M", "Publisher", "", TEXT, b"go-zim", COMPRESSED_CLUSTER),
+        ("M", "Tags", "", TEXT, b"_category:test;_pictures:no;_videos:no", COMPRESSED_CLUSTER),
+        ("M", "Title", "", TEXT, ("Test %s archive" % compression_name).encode(), COMPRESSED_CLUSTER),
+    ]
+
+
+# Redirect entries as (namespace, url, title, (target namespace, target url))
+REDIRECTS = [("A", "Index", "Index", ("A", "Main_Page"))]
+
+
+def cluster_bytes(blobs):
+    """Returns the uncompressed data of a cluster, its 32 bits blob offsets
+    followed by its blobs."""
+    offsets = []
+    offset = (len(blobs) + 1) * 4
+
+    for blob in blobs:
+        offsets.append(offset)
+        offset += len(blob)
+
+    offsets.append(offset)
+
+    return b"".join(struct.pack("<I", o) for o in offsets) + b"".join(blobs)
+
+
+def build(path, compression, compression_name, compress, archive_uuid):
+    entries = content_entries(compression_name)
+
+    # Entries are ordered by namespace and URL in the URL pointer list
+    all_entries = [(e[0], e[1], e[2], e) for e in entries] + [(r[0], r[1], r[2], r) for r in REDIRECTS]
+    all_entries.sort(key=lambda e: (e[0].encode(), e[1].encode()))
+    index_of = {(e[0], e[1]): i for i, e in enumerate(all_entries)}
+
+    clusters = [[], []]
+    blob_of = {}
+
+    for e in entries:
+        cluster = e[5]
+        blob_of[(e[0], e[1])] = (cluster, len(clusters[cluster]))
+        clusters[cluster].append(e[4])
+
+    cluster_data = [
+        bytes([compression]) + compress(cluster_bytes(clusters[COMPRESSED_CLUSTER])),
+        bytes([UNCOMPRESSED]) + cluster_bytes(clusters[UNCOMPRESSED_CLUSTER]),
+    ]
+
+    dirents = []
+
+    for namespace, url, title, e in all_entries:
+        # The title is omitted when it is the URL
+        raw_title = b"" if title == url else title.encode()
+
+        if len(e) == 4:
+            target = index_of[e[3]]
+            dirent = struct.pack("<HBcI", REDIRECT_MIME_TYPE, 0, namespace.encode(), 0) + struct.pack("<I", target)
+        else:
+            cluster, blob = blob_of[(namespace, url)]
+            dirent = struct.pack("<HBcI", e[3], 0, namespace.encode(), 0) + struct.pack("<II", cluster, blob)
+
+        dirents.append(dirent + url.encode() + b"\0" + raw_title + b"\0")
+
+    def title_key(i):
+        namespace, url, title, _ = all_entries[i]
+        return (namespace.encode(), (title or url).encode())
+
+    title_order = sorted(range(len(all_entries)), key=title_key)
+
+    mime_list = b"".join(m.encode() + b"\0" for m in MIME_TYPES) + b"\0"
+
+    # The header is followed by the mime type list, the URL and title pointer
+    # lists, the directory entries, the cluster pointer list and the clusters
+    pos = 80
+    mime_pos = pos
+    pos += len(mime_list)
+    url_ptr_pos = pos
+    pos += 8 * len(dirents)
+    title_ptr_pos = pos
+    pos += 4 * len(dirents)
+
+    dirent_pos = []
+    for dirent in dirents:
+        dirent_pos.append(pos)
+        pos += len(dirent)
+
+    cluster_ptr_pos = pos
+    pos += 8 * len(cluster_data)
+
+    cluster_pos = []
+    for data in cluster_data:
+        cluster_pos.append(pos)
+        pos += len(data)
+
+    checksum_pos = pos
+
+    main_page = index_of[("A", "Main_Page")]
+
+    header = struct.pack("<IHH", ZIM_MAGIC, 5, 0) + archive_uuid.bytes + struct.pack(
+        "<IIQQQQIIQ",
+        len(dirents),
+        len(cluster_data),
+        url_ptr_pos,
+        title_ptr_pos,
+        cluster_ptr_pos,
+        mime_pos,
+        main_page,
+        NO_LAYOUT_PAGE,
+        checksum_pos,
+    )
+    assert len(header) == 80
+
+    body = (
+        header
+        + mime_list
+        + b"".join(struct.pack("<Q", p) for p in dirent_pos)
+        + b"".join(struct.pack("<I", i) for i in title_order)
+        + b"".join(dirents)
+        + b"".join(struct.pack("<Q", p) for p in cluster_pos)
+        + b"".join(cluster_data)
+    )
+    assert len(body) == checksum_pos
+
+    with open(path, "wb") as f:
+        f.write(body + hashlib.md5(body).digest())
+
+
+if __name__ == "__main__":
+    build("testdata/go-zim_test_zlib_2024-01.zim", 2, "zlib", lambda d: zlib.compress(d, 9), uuid.UUID("5f1c2e4a-9b7d-4c3e-8a21-6d0f3b9e7c12"))
+    build("testdata/go-zim_test_bzip2_2024-01.zim", 3, "bzip2", lambda d: bz2.compress(d, 9), uuid.UUID("0b6e8d2f-3a41-4f5c-9e7a-2c8d1f4b6a93"))
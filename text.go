@@ -0,0 +1,172 @@
+package zim
+
+import (
+	"bufio"
+	"html"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// ignoredElements are the HTML elements whose content is not text.
+var ignoredElements = map[string]struct{}{
+	"head":     {},
+	"script":   {},
+	"style":    {},
+	"noscript": {},
+	"template": {},
+	"svg":      {},
+}
+
+// ExtractText returns the text content of an HTML document, with tags,
+// scripts and styles removed, entities decoded and white spaces collapsed.
+func ExtractText(r io.Reader) (string, error) {
+	reader := bufio.NewReader(r)
+
+	var (
+		text    strings.Builder
+		tag     strings.Builder
+		inTag   bool
+		ignored string
+	)
+
+	flushText := func(s string) {
+		if ignored != "" {
+			return
+		}
+
+		text.WriteString(s)
+	}
+
+	var chunk strings.Builder
+
+	for {
+		c, err := reader.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		switch {
+		case inTag && c == '>':
+			inTag = false
+
+			raw := tag.String()
+			tag.Reset()
+
+			name, closing := parseTagName(raw)
+
+			switch {
+			case ignored == "" && !closing:
+				if _, exists := ignoredElements[name]; exists && !strings.HasSuffix(raw, "/") {
+					ignored = name
+				}
+			case ignored != "" && closing && name == ignored:
+				ignored = ""
+			}
+
+			chunk.WriteByte(' ')
+
+		case inTag:
+			tag.WriteByte(c)
+
+		case c == '<':
+			flushText(html.UnescapeString(chunk.String()))
+			chunk.Reset()
+			inTag = true
+
+		default:
+			if ignored == "" {
+				chunk.WriteByte(c)
+			}
+		}
+	}
+
+	flushText(html.UnescapeString(chunk.String()))
+
+	return strings.Join(strings.Fields(text.String()), " "), nil
+}
+
+// parseTagName returns the lower cased name of the element described by
+// the given tag content and whether the tag is a closing one.
+func parseTagName(tag string) (string, bool) {
+	closing := strings.HasPrefix(tag, "/")
+	tag = strings.TrimPrefix(tag, "/")
+
+	end := strings.IndexFunc(tag, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '/'
+	})
+
+	if end >= 0 {
+		tag = tag[:end]
+	}
+
+	return strings.ToLower(tag), closing
+}
+
+// Tokenize splits a text in lower cased terms, following the rules used by
+// Xapian when indexing ZIM archives: words are made of letters, marks and
+// digits, and may contain apostrophes between letters or dots and commas
+// between digits.
+func Tokenize(text string) []string {
+	terms := make([]string, 0)
+
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			terms = append(terms, current.String())
+			current.Reset()
+		}
+	}
+
+	var previous rune
+
+	for i, r := range text {
+		if isWordRune(r) {
+			current.WriteRune(unicode.ToLower(r))
+			previous = r
+
+			continue
+		}
+
+		if current.Len() > 0 && isInfixRune(previous, r) {
+			next, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r):])
+
+			if (unicode.IsDigit(previous) && unicode.IsDigit(next)) || (unicode.IsLetter(previous) && unicode.IsLetter(next) && r != '.' && r != ',') {
+				current.WriteRune(r)
+				previous = r
+
+				continue
+			}
+		}
+
+		flush()
+		previous = r
+	}
+
+	flush()
+
+	return terms
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || unicode.In(r, unicode.Nl, unicode.No, unicode.Pc)
+}
+
+func isInfixRune(previous, r rune) bool {
+	switch r {
+	case '.', ',':
+		return unicode.IsDigit(previous)
+	case '\'', '’', '&':
+		return unicode.IsLetter(previous)
+	default:
+		return false
+	}
+}
@@ -1,80 +1,91 @@
 package zim
 
 import (
-	"bytes"
-	"sync"
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 )
 
+// UncompressedBlobReader reads a blob stored in an uncompressed cluster
+// directly from the archive, without buffering it in memory. Read and Seek
+// share the reader position and are not safe for concurrent use, ReadAt can
+// be called from multiple goroutines.
 type UncompressedBlobReader struct {
+	ctx             context.Context
 	reader          *Reader
 	blobStartOffset uint64
 	blobEndOffset   uint64
 	blobSize        int
-	readOffset      int
 
-	blob         *bytes.Reader
-	loadBlobOnce sync.Once
-	loadBlobErr  error
+	section *io.SectionReader
+	closed  atomic.Bool
 }
 
 // Seek implements BlobReader.
 func (r *UncompressedBlobReader) Seek(offset int64, whence int) (int64, error) {
-	blob, err := r.loadBlob()
-	if err != nil {
+	if r.closed.Load() {
+		return 0, errors.WithStack(os.ErrClosed)
+	}
+
+	if err := r.ctx.Err(); err != nil {
 		return 0, errors.WithStack(err)
 	}
 
-	return blob.Seek(offset, whence)
+	return r.section.Seek(offset, whence)
 }
 
 // Size implements BlobReader.
 func (r *UncompressedBlobReader) Size() (int64, error) {
-	return int64(r.blobEndOffset - r.blobStartOffset), nil
+	return r.section.Size(), nil
 }
 
 // Close implements io.ReadCloser.
 func (r *UncompressedBlobReader) Close() error {
+	r.closed.Store(true)
 	return nil
 }
 
 // Read implements io.ReadCloser.
-func (r *UncompressedBlobReader) Read(p []byte) (n int, err error) {
-	blobData, err := r.loadBlob()
-	if err != nil {
+func (r *UncompressedBlobReader) Read(p []byte) (int, error) {
+	if r.closed.Load() {
+		return 0, errors.WithStack(os.ErrClosed)
+	}
+
+	if err := r.ctx.Err(); err != nil {
 		return 0, errors.WithStack(err)
 	}
 
-	return blobData.Read(p)
+	return r.section.Read(p)
 }
 
-func (r *UncompressedBlobReader) loadBlob() (*bytes.Reader, error) {
-	r.loadBlobOnce.Do(func() {
-		data := make([]byte, r.blobEndOffset-r.blobStartOffset)
-		err := r.reader.readRange(int64(r.blobStartOffset), data)
-		if err != nil {
-			r.loadBlobErr = errors.WithStack(err)
-			return
-		}
-
-		r.blob = bytes.NewReader(data)
-	})
-	if r.loadBlobErr != nil {
-		return nil, errors.WithStack(r.loadBlobErr)
+// ReadAt implements io.ReaderAt.
+func (r *UncompressedBlobReader) ReadAt(p []byte, offset int64) (int, error) {
+	if r.closed.Load() {
+		return 0, errors.WithStack(os.ErrClosed)
 	}
 
-	return r.blob, nil
+	if err := r.ctx.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return r.section.ReadAt(p, offset)
 }
 
 func NewUncompressedBlobReader(reader *Reader, blobStartOffset, blobEndOffset uint64, blobSize int) *UncompressedBlobReader {
 	return &UncompressedBlobReader{
+		ctx:             context.Background(),
 		reader:          reader,
 		blobStartOffset: blobStartOffset,
 		blobEndOffset:   blobEndOffset,
 		blobSize:        blobSize,
-		readOffset:      0,
+		section:         io.NewSectionReader(reader.reader, int64(blobStartOffset), int64(blobEndOffset-blobStartOffset)),
 	}
 }
 
-var _ BlobReader = &UncompressedBlobReader{}
+var (
+	_ BlobReader  = &UncompressedBlobReader{}
+	_ io.ReaderAt = &UncompressedBlobReader{}
+)
@@ -0,0 +1,110 @@
+package zim
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const checksumSize = md5.Size
+
+// VerifyProgressFunc is called while the archive is being verified with
+// the number of bytes already hashed and the total number of bytes to hash.
+type VerifyProgressFunc func(read int64, total int64)
+
+type VerifyOptions struct {
+	BufferSize int
+	OnProgress VerifyProgressFunc
+}
+
+type VerifyOptionFunc func(opts *VerifyOptions)
+
+func NewVerifyOptions(funcs ...VerifyOptionFunc) *VerifyOptions {
+	funcs = append([]VerifyOptionFunc{
+		WithVerifyBufferSize(1 << 20),
+	}, funcs...)
+
+	opts := &VerifyOptions{}
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+func WithVerifyBufferSize(size int) VerifyOptionFunc {
+	return func(opts *VerifyOptions) {
+		opts.BufferSize = size
+	}
+}
+
+func WithVerifyProgress(fn VerifyProgressFunc) VerifyOptionFunc {
+	return func(opts *VerifyOptions) {
+		opts.OnProgress = fn
+	}
+}
+
+// Checksum returns the MD5 checksum stored at the end of the archive.
+func (r *Reader) Checksum() ([]byte, error) {
+	checksum := make([]byte, checksumSize)
+	if err := r.readRange(int64(r.checksumPos), checksum); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return checksum, nil
+}
+
+// Verify computes the MD5 checksum of the archive and compares it to the
+// one stored at the end of the file. ErrChecksumMismatch is returned if
+// they differ.
+func (r *Reader) Verify(ctx context.Context, funcs ...VerifyOptionFunc) error {
+	opts := NewVerifyOptions(funcs...)
+
+	expected, err := r.Checksum()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	total := int64(r.checksumPos)
+	content := io.NewSectionReader(r.reader, 0, total)
+	hash := md5.New()
+	buff := make([]byte, opts.BufferSize)
+	read := int64(0)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		n, err := content.Read(buff)
+		if n > 0 {
+			hash.Write(buff[:n])
+			read += int64(n)
+
+			if opts.OnProgress != nil {
+				opts.OnProgress(read, total)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if read != total {
+		return errors.Wrapf(io.ErrUnexpectedEOF, "read '%d' bytes, expected '%d'", read, total)
+	}
+
+	if computed := hash.Sum(nil); !bytes.Equal(expected, computed) {
+		return errors.Wrapf(ErrChecksumMismatch, "expected '%x', got '%x'", expected, computed)
+	}
+
+	return nil
+}
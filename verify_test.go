@@ -0,0 +1,136 @@
+package zim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestReaderVerify(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, zf := range files {
+		t.Run(filepath.Base(zf), func(t *testing.T) {
+			reader, err := Open(zf)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := reader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			var lastRead, lastTotal int64
+
+			onProgress := func(read, total int64) {
+				lastRead, lastTotal = read, total
+			}
+
+			if err := reader.Verify(context.Background(), WithVerifyProgress(onProgress)); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if lastRead == 0 || lastRead != lastTotal {
+				t.Errorf("expected progress to reach total, got '%d/%d'", lastRead, lastTotal)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			if err := reader.Verify(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("reader.Verify(): expected context.Canceled, got '%v'", err)
+			}
+
+			problems, err := reader.Check(context.Background())
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			for _, p := range problems {
+				t.Errorf("reader.Check(): unexpected problem '%s'", p)
+			}
+
+			// Clusters are read through the context of the check
+			checker := &archiveChecker{reader: reader, ctx: ctx}
+
+			if _, err := checker.checkCluster(0, reader.clusterIndex[0], reader.clusterIndex[1]); !errors.Is(err, context.Canceled) {
+				t.Errorf("checker.checkCluster(): expected context.Canceled, got '%v'", err)
+			}
+		})
+	}
+}
+
+func TestReaderVerifyCorrupted(t *testing.T) {
+	data, err := os.ReadFile("testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	original, err := Open("testdata/go-zim_test_zlib_2024-01.zim")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	var redirectPtr uint64
+
+	iterator := original.Entries()
+	for iterator.Next() {
+		if iterator.Entry().FullURL() == "A/Index" {
+			redirectPtr = original.urlIndex[iterator.Index()]
+		}
+	}
+	if err := iterator.Err(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := original.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Corrupt the last byte of the last cluster
+	data[len(data)-checksumSize-1] ^= 0xff
+
+	// Make the redirect target index of the "A/Index" entry out of bounds
+	copy(data[redirectPtr+8:redirectPtr+12], []byte{0xff, 0xff, 0xff, 0x00})
+
+	corrupted := filepath.Join(t.TempDir(), "corrupted.zim")
+	if err := os.WriteFile(corrupted, data, 0o644); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	reader, err := Open(corrupted)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Errorf("%+v", errors.WithStack(err))
+		}
+	}()
+
+	if err := reader.Verify(context.Background()); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("reader.Verify(): expected ErrChecksumMismatch, got '%v'", err)
+	}
+
+	problems, err := reader.Check(context.Background())
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, len(problems); e != g {
+		t.Fatalf("reader.Check(): expected '%d' problem, got '%d': %v", e, g, problems)
+	}
+
+	if e, g := ProblemInvalidRedirect, problems[0].Kind; e != g {
+		t.Errorf("problems[0].Kind: expected '%s', got '%s'", e, g)
+	}
+}
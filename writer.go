@@ -0,0 +1,719 @@
+package zim
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+type WriterOptions struct {
+	// Compression is the algorithm used for clusters holding compressible
+	// content. Only CompressionZStandard, CompressionXZ and CompressionNone
+	// are supported.
+	Compression Compression
+	// ClusterSize is the uncompressed size above which a cluster is
+	// written to the archive.
+	ClusterSize int
+	// UUID is the identifier of the archive, in its hexadecimal form.
+	// A random one is generated if empty.
+	UUID string
+	// TempDir is the directory used to store the clusters until the
+	// archive is finalized.
+	TempDir string
+}
+
+type WriterOptionFunc func(opts *WriterOptions)
+
+func NewWriterOptions(funcs ...WriterOptionFunc) *WriterOptions {
+	funcs = append([]WriterOptionFunc{
+		WithWriterCompression(CompressionZStandard),
+		WithWriterClusterSize(2 << 20),
+	}, funcs...)
+
+	opts := &WriterOptions{}
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+func WithWriterCompression(compression Compression) WriterOptionFunc {
+	return func(opts *WriterOptions) {
+		opts.Compression = compression
+	}
+}
+
+func WithWriterClusterSize(size int) WriterOptionFunc {
+	return func(opts *WriterOptions) {
+		opts.ClusterSize = size
+	}
+}
+
+func WithWriterUUID(uuid string) WriterOptionFunc {
+	return func(opts *WriterOptions) {
+		opts.UUID = uuid
+	}
+}
+
+func WithWriterTempDir(dir string) WriterOptionFunc {
+	return func(opts *WriterOptions) {
+		opts.TempDir = dir
+	}
+}
+
+type writerEntry struct {
+	namespace Namespace
+	url       string
+	title     string
+
+	// Content entries
+	mimeTypeIndex uint16
+	cluster       *writerCluster
+	blobIndex     uint32
+
+	// Redirect entries
+	redirect       bool
+	targetFullURL  string
+	redirectTarget uint32
+}
+
+func (e *writerEntry) sortTitle() string {
+	if e.title == "" {
+		return e.url
+	}
+
+	return e.title
+}
+
+func (e *writerEntry) size() uint64 {
+	title := e.title
+	if title == e.url {
+		title = ""
+	}
+
+	size := uint64(len(e.url) + 1 + len(title) + 1)
+
+	if e.redirect {
+		return size + 12
+	}
+
+	return size + 16
+}
+
+type writerCluster struct {
+	compression Compression
+	offsets     []uint64
+	data        bytes.Buffer
+
+	// Set when the cluster is written to the temporary file
+	num uint32
+}
+
+// Writer creates a ZIM archive. Entries are added with AddContent() and
+// AddRedirect(), the archive being written to the underlying writer when
+// Close() is called.
+type Writer struct {
+	writer io.Writer
+	closer io.Closer
+	opts   *WriterOptions
+	uuid   []byte
+
+	entries   []*writerEntry
+	fullURLs  map[string]struct{}
+	mainPage  string
+	mimeTypes []string
+	mimeIndex map[string]uint16
+
+	compressedCluster   *writerCluster
+	uncompressedCluster *writerCluster
+	extended            bool
+
+	clusters       *os.File
+	clusterOffsets []uint64
+	clustersSize   uint64
+
+	closed bool
+}
+
+// AddContent adds an entry with the given content to the archive.
+func (w *Writer) AddContent(ns Namespace, url string, title string, mimeType string, content io.Reader) error {
+	if err := w.checkEntry(ns, url); err != nil {
+		return errors.WithStack(err)
+	}
+
+	mimeTypeIndex, err := w.getMimeTypeIndex(mimeType)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	cluster := w.uncompressedCluster
+	if w.opts.Compression != CompressionNone && isCompressible(mimeType) {
+		cluster = w.compressedCluster
+	}
+
+	blobIndex := uint32(len(cluster.offsets))
+	start := cluster.data.Len()
+
+	if _, err := io.Copy(&cluster.data, content); err != nil {
+		// Discard the partially copied content, which would otherwise be
+		// prepended to the next blob of the cluster
+		cluster.data.Truncate(start)
+
+		return errors.WithStack(err)
+	}
+
+	cluster.offsets = append(cluster.offsets, uint64(cluster.data.Len()))
+
+	w.addEntry(&writerEntry{
+		namespace:     ns,
+		url:           url,
+		title:         title,
+		mimeTypeIndex: mimeTypeIndex,
+		cluster:       cluster,
+		blobIndex:     blobIndex,
+	})
+
+	if cluster.data.Len() >= w.opts.ClusterSize {
+		if err := w.flushCluster(cluster); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// AddMetadata adds a metadata entry to the archive.
+func (w *Writer) AddMetadata(key MetadataKey, value string) error {
+	if err := w.AddContent(V5NamespaceMetadata, string(key), "", "text/plain", strings.NewReader(value)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// AddRedirect adds an entry redirecting to the entry with the given
+// namespace and URL. The target does not need to exist yet but must be
+// added before the writer is closed.
+func (w *Writer) AddRedirect(ns Namespace, url string, title string, targetNamespace Namespace, targetURL string) error {
+	if err := w.checkEntry(ns, url); err != nil {
+		return errors.WithStack(err)
+	}
+
+	w.addEntry(&writerEntry{
+		namespace:     ns,
+		url:           url,
+		title:         title,
+		redirect:      true,
+		targetFullURL: toFullURL(targetNamespace, targetURL),
+	})
+
+	return nil
+}
+
+// SetMainPage defines the entry used as the main page of the archive.
+func (w *Writer) SetMainPage(ns Namespace, url string) {
+	w.mainPage = toFullURL(ns, url)
+}
+
+// Close finalizes the archive and writes it to the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return errors.WithStack(os.ErrClosed)
+	}
+
+	w.closed = true
+
+	defer func() {
+		w.clusters.Close()
+		os.Remove(w.clusters.Name())
+	}()
+
+	if err := w.finalize(); err != nil {
+		if w.closer != nil {
+			w.closer.Close()
+		}
+
+		return errors.WithStack(err)
+	}
+
+	if w.closer != nil {
+		if err := w.closer.Close(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) checkEntry(ns Namespace, url string) error {
+	if w.closed {
+		return errors.WithStack(os.ErrClosed)
+	}
+
+	if len(ns) != 1 {
+		return errors.Errorf("invalid namespace '%s'", ns)
+	}
+
+	if url == "" {
+		return errors.New("entry url must not be empty")
+	}
+
+	fullURL := toFullURL(ns, url)
+	if _, exists := w.fullURLs[fullURL]; exists {
+		return errors.Errorf("duplicate entry '%s'", fullURL)
+	}
+
+	return nil
+}
+
+func (w *Writer) addEntry(entry *writerEntry) {
+	w.entries = append(w.entries, entry)
+	w.fullURLs[toFullURL(entry.namespace, entry.url)] = struct{}{}
+}
+
+func (w *Writer) getMimeTypeIndex(mimeType string) (uint16, error) {
+	if idx, exists := w.mimeIndex[mimeType]; exists {
+		return idx, nil
+	}
+
+	if mimeType == "" {
+		return 0, errors.New("mime type must not be empty")
+	}
+
+	if len(w.mimeTypes) >= zimRedirect-1 {
+		return 0, errors.New("too many mime types")
+	}
+
+	idx := uint16(len(w.mimeTypes))
+	w.mimeTypes = append(w.mimeTypes, mimeType)
+	w.mimeIndex[mimeType] = idx
+
+	return idx, nil
+}
+
+// flushCluster writes the given cluster to the temporary clusters file and
+// resets it.
+func (w *Writer) flushCluster(cluster *writerCluster) error {
+	if len(cluster.offsets) == 0 {
+		return nil
+	}
+
+	blobCount := len(cluster.offsets)
+	blobSize := uint64(4)
+	extended := uint64(blobCount+1)*8+uint64(cluster.data.Len()) > math.MaxUint32
+	if extended {
+		blobSize = 8
+		w.extended = true
+	}
+
+	tableSize := uint64(blobCount+1) * blobSize
+
+	clusterStart := w.clustersSize
+	counter := &countingWriter{writer: w.clusters}
+
+	header := byte(cluster.compression)
+	if extended {
+		header |= 1 << 4
+	}
+
+	if _, err := counter.Write([]byte{header}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	encoder, err := newClusterEncoder(cluster.compression, counter)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	table := make([]byte, tableSize)
+	writeOffset := func(idx int, offset uint64) {
+		if extended {
+			binary.LittleEndian.PutUint64(table[uint64(idx)*blobSize:], offset)
+		} else {
+			binary.LittleEndian.PutUint32(table[uint64(idx)*blobSize:], uint32(offset))
+		}
+	}
+
+	writeOffset(0, tableSize)
+	for idx, end := range cluster.offsets {
+		writeOffset(idx+1, tableSize+end)
+	}
+
+	if _, err := encoder.Write(table); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := cluster.data.WriteTo(encoder); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := encoder.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	cluster.num = uint32(len(w.clusterOffsets))
+	cluster.offsets = nil
+	cluster.data = bytes.Buffer{}
+
+	w.clusterOffsets = append(w.clusterOffsets, clusterStart)
+	w.clustersSize += counter.written
+
+	// Entries keep a reference to the flushed cluster, new blobs go to a
+	// fresh one
+	fresh := &writerCluster{compression: cluster.compression}
+	if cluster == w.compressedCluster {
+		w.compressedCluster = fresh
+	} else {
+		w.uncompressedCluster = fresh
+	}
+
+	return nil
+}
+
+func (w *Writer) finalize() error {
+	if err := w.flushCluster(w.compressedCluster); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := w.flushCluster(w.uncompressedCluster); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(w.entries) == 0 {
+		return errors.New("archive must contain at least one entry")
+	}
+
+	sort.Slice(w.entries, func(i, j int) bool {
+		return compareURL(w.entries[i].namespace, w.entries[i].url, w.entries[j].namespace, w.entries[j].url) < 0
+	})
+
+	indexes := make(map[string]uint32, len(w.entries))
+	for idx, entry := range w.entries {
+		indexes[toFullURL(entry.namespace, entry.url)] = uint32(idx)
+	}
+
+	for _, entry := range w.entries {
+		if !entry.redirect {
+			continue
+		}
+
+		target, exists := indexes[entry.targetFullURL]
+		if !exists {
+			return errors.Errorf("redirect target '%s' of entry '%s' does not exist", entry.targetFullURL, toFullURL(entry.namespace, entry.url))
+		}
+
+		entry.redirectTarget = target
+	}
+
+	mainPage := uint32(0xffffffff)
+	if w.mainPage != "" {
+		idx, exists := indexes[w.mainPage]
+		if !exists {
+			return errors.Errorf("main page '%s' does not exist", w.mainPage)
+		}
+
+		mainPage = idx
+	}
+
+	titleIndex := make([]uint32, len(w.entries))
+	for idx := range titleIndex {
+		titleIndex[idx] = uint32(idx)
+	}
+
+	sort.SliceStable(titleIndex, func(i, j int) bool {
+		a, b := w.entries[titleIndex[i]], w.entries[titleIndex[j]]
+		return compareURL(a.namespace, a.sortTitle(), b.namespace, b.sortTitle()) < 0
+	})
+
+	// Compute the layout of the archive
+	var mimeList bytes.Buffer
+	for _, mimeType := range w.mimeTypes {
+		mimeList.WriteString(mimeType)
+		mimeList.WriteByte(nullByte)
+	}
+	mimeList.WriteByte(nullByte)
+
+	entryCount := uint64(len(w.entries))
+
+	mimeListPos := uint64(headerSize)
+	urlPtrPos := mimeListPos + uint64(mimeList.Len())
+	titlePtrPos := urlPtrPos + entryCount*8
+	direntsPos := titlePtrPos + entryCount*4
+
+	direntPositions := make([]uint64, len(w.entries))
+	position := direntsPos
+	for idx, entry := range w.entries {
+		direntPositions[idx] = position
+		position += entry.size()
+	}
+
+	clusterPtrPos := position
+	clustersPos := clusterPtrPos + uint64(len(w.clusterOffsets))*8
+	checksumPos := clustersPos + w.clustersSize
+
+	hash := md5.New()
+	buffered := bufio.NewWriter(io.MultiWriter(w.writer, hash))
+
+	majorVersion := uint16(5)
+	if w.extended {
+		majorVersion = 6
+	}
+
+	header := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(header[0:4], zimFormatMagicNumber)
+	binary.LittleEndian.PutUint16(header[4:6], majorVersion)
+	binary.LittleEndian.PutUint16(header[6:8], 0)
+	copy(header[8:24], w.uuid)
+	binary.LittleEndian.PutUint32(header[24:28], uint32(entryCount))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(len(w.clusterOffsets)))
+	binary.LittleEndian.PutUint64(header[32:40], urlPtrPos)
+	binary.LittleEndian.PutUint64(header[40:48], titlePtrPos)
+	binary.LittleEndian.PutUint64(header[48:56], clusterPtrPos)
+	binary.LittleEndian.PutUint64(header[56:64], mimeListPos)
+	binary.LittleEndian.PutUint32(header[64:68], mainPage)
+	binary.LittleEndian.PutUint32(header[68:72], 0xffffffff)
+	binary.LittleEndian.PutUint64(header[72:80], checksumPos)
+
+	if _, err := buffered.Write(header); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := mimeList.WriteTo(buffered); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, pos := range direntPositions {
+		if err := binary.Write(buffered, binary.LittleEndian, pos); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, idx := range titleIndex {
+		if err := binary.Write(buffered, binary.LittleEndian, idx); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, entry := range w.entries {
+		if err := writeDirent(buffered, entry); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, offset := range w.clusterOffsets {
+		if err := binary.Write(buffered, binary.LittleEndian, clustersPos+offset); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if _, err := w.clusters.Seek(0, io.SeekStart); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := io.Copy(buffered, w.clusters); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := w.writer.Write(hash.Sum(nil)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func writeDirent(w io.Writer, entry *writerEntry) error {
+	mimeTypeIndex := entry.mimeTypeIndex
+	if entry.redirect {
+		mimeTypeIndex = zimRedirect
+	}
+
+	// Mime type, parameter length, namespace and revision
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[0:2], mimeTypeIndex)
+	data[3] = entry.namespace[0]
+
+	if entry.redirect {
+		data = binary.LittleEndian.AppendUint32(data, entry.redirectTarget)
+	} else {
+		data = binary.LittleEndian.AppendUint32(data, entry.cluster.num)
+		data = binary.LittleEndian.AppendUint32(data, entry.blobIndex)
+	}
+
+	title := entry.title
+	if title == entry.url {
+		title = ""
+	}
+
+	data = append(data, entry.url...)
+	data = append(data, nullByte)
+	data = append(data, title...)
+	data = append(data, nullByte)
+
+	if _, err := w.Write(data); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func newClusterEncoder(compression Compression, w io.Writer) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+
+	case CompressionZStandard:
+		encoder, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return encoder, nil
+
+	case CompressionXZ:
+		encoder, err := xz.NewWriter(w)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return encoder, nil
+
+	default:
+		return nil, errors.Wrapf(ErrCompressionAlgorithmNotSupported, "unexpected compression algorithm '%d'", compression)
+	}
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += uint64(n)
+
+	return n, err
+}
+
+// isCompressible returns false for mime types of content which is usually
+// already compressed, so that it can be stored in uncompressed clusters
+// and read without decompression.
+func isCompressible(mimeType string) bool {
+	mimeType = strings.ToLower(mimeType)
+
+	switch {
+	case strings.HasPrefix(mimeType, "image/svg"):
+		return true
+	case strings.HasPrefix(mimeType, "image/"),
+		strings.HasPrefix(mimeType, "video/"),
+		strings.HasPrefix(mimeType, "audio/"),
+		strings.HasPrefix(mimeType, "font/woff"),
+		strings.HasPrefix(mimeType, "application/zip"),
+		strings.HasPrefix(mimeType, "application/gzip"),
+		strings.HasPrefix(mimeType, "application/x-xz"),
+		strings.HasPrefix(mimeType, "application/zstd"):
+		return false
+	default:
+		return true
+	}
+}
+
+func parseUUID(uuid string) ([]byte, error) {
+	data, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(data) != 16 {
+		return nil, errors.Errorf("invalid uuid '%s'", uuid)
+	}
+
+	return data, nil
+}
+
+// NewWriter returns a Writer creating a ZIM archive in the given writer.
+func NewWriter(w io.Writer, funcs ...WriterOptionFunc) (*Writer, error) {
+	opts := NewWriterOptions(funcs...)
+
+	switch opts.Compression {
+	case CompressionNone, CompressionZStandard, CompressionXZ:
+	default:
+		return nil, errors.Wrapf(ErrCompressionAlgorithmNotSupported, "unexpected compression algorithm '%d'", opts.Compression)
+	}
+
+	var uuid []byte
+
+	if opts.UUID != "" {
+		parsed, err := parseUUID(opts.UUID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		uuid = parsed
+	} else {
+		uuid = make([]byte, 16)
+		if _, err := rand.Read(uuid); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	clusters, err := os.CreateTemp(opts.TempDir, "go-zim-clusters-*")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	writer := &Writer{
+		writer:              w,
+		opts:                opts,
+		uuid:                uuid,
+		fullURLs:            make(map[string]struct{}),
+		mimeIndex:           make(map[string]uint16),
+		compressedCluster:   &writerCluster{compression: opts.Compression},
+		uncompressedCluster: &writerCluster{compression: CompressionNone},
+		clusters:            clusters,
+	}
+
+	return writer, nil
+}
+
+// Create returns a Writer creating a ZIM archive at the given path.
+func Create(path string, funcs ...WriterOptionFunc) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	writer, err := NewWriter(file, funcs...)
+	if err != nil {
+		file.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	writer.closer = file
+
+	return writer, nil
+}
@@ -0,0 +1,257 @@
+package zim
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestWriter(t *testing.T) {
+	compressions := []Compression{CompressionZStandard, CompressionXZ, CompressionNone}
+
+	for _, compression := range compressions {
+		t.Run(fmt.Sprintf("Compression=%d", compression), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.zim")
+			uuid := "0c7a9d3e-5b21-4f8a-9e6d-00000000beef"
+
+			writer, err := Create(path, WithWriterCompression(compression), WithWriterClusterSize(1024), WithWriterUUID(uuid))
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			contents := map[string]string{}
+
+			for i := 0; i < 50; i++ {
+				url := fmt.Sprintf("Page_%02d", i)
+				title := fmt.Sprintf("Page %02d", i)
+				content := fmt.Sprintf("<html><body><h1>%s</h1>%s</body></html>", title, strings.Repeat("<p>Lorem ipsum</p>", i))
+
+				if err := writer.AddContent(V5NamespaceArticle, url, title, "text/html", strings.NewReader(content)); err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				contents["A/"+url] = content
+			}
+
+			image := string(bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 64))
+			if err := writer.AddContent(V5NamespaceImageFile, "image.png", "", "image/png", strings.NewReader(image)); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			contents["I/image.png"] = image
+
+			if err := writer.AddMetadata(MetadataTitle, "Test archive"); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if err := writer.AddRedirect(V5NamespaceArticle, "Home", "Home", V5NamespaceArticle, "Page_00"); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if err := writer.AddContent(V5NamespaceArticle, "Page_00", "", "text/html", strings.NewReader("")); err == nil {
+				t.Errorf("writer.AddContent(): expected duplicate entry error")
+			}
+
+			writer.SetMainPage(V5NamespaceArticle, "Home")
+
+			if err := writer.Close(); err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			reader, err := Open(path)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			defer func() {
+				if err := reader.Close(); err != nil {
+					t.Errorf("%+v", errors.WithStack(err))
+				}
+			}()
+
+			if e, g := uuid, reader.UUID(); e != g {
+				t.Errorf("reader.UUID(): expected '%s', got '%s'", e, g)
+			}
+
+			if e, g := uint32(53), reader.EntryCount(); e != g {
+				t.Errorf("reader.EntryCount(): expected '%d', got '%d'", e, g)
+			}
+
+			if err := reader.Verify(context.Background()); err != nil {
+				t.Errorf("%+v", errors.WithStack(err))
+			}
+
+			problems, err := reader.Check(context.Background())
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			for _, p := range problems {
+				t.Errorf("reader.Check(): unexpected problem '%s'", p)
+			}
+
+			for fullURL, expected := range contents {
+				entry, err := reader.EntryWithFullURL(fullURL)
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				content, err := entry.Redirect()
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				data, err := readEntryContent(content)
+				if err != nil {
+					t.Fatalf("%+v", errors.WithStack(err))
+				}
+
+				if e, g := expected, string(data); e != g {
+					t.Errorf("%s: expected content '%s', got '%s'", fullURL, e, g)
+				}
+			}
+
+			imageEntry, err := reader.EntryWithURL(V5NamespaceImageFile, "image.png")
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			imageCompression, err := imageEntry.(*ContentEntry).Compression()
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := int(CompressionNone), imageCompression; e != g {
+				t.Errorf("image compression: expected '%d', got '%d'", e, g)
+			}
+
+			entry, err := reader.EntryWithTitle(V5NamespaceArticle, "Page 42")
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := "A/Page_42", entry.FullURL(); e != g {
+				t.Errorf("reader.EntryWithTitle(): expected '%s', got '%s'", e, g)
+			}
+
+			mainPage, err := reader.MainPage()
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := "A/Home", mainPage.FullURL(); e != g {
+				t.Errorf("reader.MainPage(): expected '%s', got '%s'", e, g)
+			}
+
+			target, err := mainPage.Redirect()
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := "A/Page_00", target.FullURL(); e != g {
+				t.Errorf("mainPage.Redirect(): expected '%s', got '%s'", e, g)
+			}
+
+			metadata, err := reader.Metadata(MetadataTitle)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := "Test archive", metadata[MetadataTitle]; e != g {
+				t.Errorf("metadata[MetadataTitle]: expected '%s', got '%s'", e, g)
+			}
+		})
+	}
+}
+
+func TestWriterInvalidRedirect(t *testing.T) {
+	var buff bytes.Buffer
+
+	writer, err := NewWriter(&buff)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := writer.AddRedirect(V5NamespaceArticle, "Home", "", V5NamespaceArticle, "Missing"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := writer.Close(); err == nil {
+		t.Errorf("writer.Close(): expected error for missing redirect target")
+	}
+}
+
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+
+	return n, nil
+}
+
+func TestWriterFailingContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.zim")
+
+	writer, err := Create(path)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := writer.AddContent(V5NamespaceArticle, "First", "", "text/html", strings.NewReader("first")); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	failing := &failingReader{data: []byte("partial content"), err: errors.New("read failed")}
+
+	if err := writer.AddContent(V5NamespaceArticle, "Failing", "", "text/html", failing); err == nil {
+		t.Fatalf("writer.AddContent(): expected error from the failing reader")
+	}
+
+	if err := writer.AddContent(V5NamespaceArticle, "Next", "", "text/html", strings.NewReader("next")); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer reader.Close()
+
+	if _, err := reader.EntryWithURL(V5NamespaceArticle, "Failing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for the failed entry, got '%v'", err)
+	}
+
+	for url, expected := range map[string]string{"First": "first", "Next": "next"} {
+		entry, err := reader.EntryWithURL(V5NamespaceArticle, url)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		data, err := readEntryContent(entry.(*ContentEntry))
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if e, g := expected, string(data); e != g {
+			t.Errorf("%s: expected content '%s', got '%s'", url, e, g)
+		}
+	}
+}
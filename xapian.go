@@ -0,0 +1,1104 @@
+package zim
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Minimal read-only support of the Xapian "glass" backend, as embedded in
+// ZIM archives as single file databases. Only what is needed to run term
+// and phrase queries is implemented: posting lists, document lengths,
+// document data and positions.
+//
+// See https://xapian.org/docs/ and the glass backend sources for the
+// description of the format.
+
+var glassMagic = []byte("\x0f\x0dXapian Glass")
+
+const (
+	glassTablePostList = iota
+	glassTableDocData
+	glassTableTermList
+	glassTablePosition
+	glassTableSpelling
+	glassTableSynonym
+	glassTableCount
+)
+
+const (
+	// Size of the block header: revision (4), level (1), max free (2),
+	// total free (2) and directory end (2)
+	glassBlockHeaderSize = 11
+	glassItemSizeMask    = 0x1fff
+
+	// Block sizes supported by the glass backend
+	glassMinBlockSize = 2048
+	glassMaxBlockSize = 65536
+
+	glassItemCompressed     = 0x80
+	glassItemFirstComponent = 0x40
+	glassItemLastComponent  = 0x20
+)
+
+// glassDocLengthKey is the key of the first chunk of the document length
+// list, stored in the posting list table.
+const glassDocLengthKey = "\x00\xe0"
+
+type glassTable struct {
+	db          *glassDatabase
+	root        uint32
+	level       int
+	empty       bool
+	entryCount  uint64
+	compressMin uint64
+}
+
+type glassDatabase struct {
+	reader    io.ReaderAt
+	blockSize int
+
+	tables [glassTableCount]*glassTable
+
+	docCount       uint64
+	lastDocID      uint64
+	totalDocLength uint64
+}
+
+func (db *glassDatabase) averageDocLength() float64 {
+	if db.docCount == 0 {
+		return 0
+	}
+
+	return float64(db.totalDocLength) / float64(db.docCount)
+}
+
+func openGlassDatabase(reader io.ReaderAt) (*glassDatabase, error) {
+	// The version "file" is stored in the first block of single file
+	// databases and is always smaller than the minimum block size.
+	header := make([]byte, 2048)
+
+	n, err := reader.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.WithStack(err)
+	}
+
+	header = header[:n]
+
+	if !bytes.HasPrefix(header, glassMagic) {
+		return nil, errors.New("invalid xapian glass database magic")
+	}
+
+	// Magic, format version (2) and database UUID (16)
+	dataStart := len(glassMagic) + 2 + 16
+	if len(header) < dataStart {
+		return nil, errors.Wrap(io.ErrUnexpectedEOF, "truncated xapian glass database header")
+	}
+
+	data := header[dataStart:]
+
+	db := &glassDatabase{
+		reader: reader,
+	}
+
+	// Revision
+	if _, data, err = glassUnpackUint(data); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for i := 0; i < glassTableCount; i++ {
+		table, rest, err := db.parseRootInfo(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse root info of table '%d'", i)
+		}
+
+		db.tables[i] = table
+		data = rest
+	}
+
+	stats := make([]uint64, 7)
+	for i := range stats {
+		if stats[i], data, err = glassUnpackUint(data); err != nil {
+			return nil, errors.Wrap(err, "could not parse database statistics")
+		}
+	}
+
+	db.docCount = stats[0]
+	db.lastDocID = stats[0] + stats[1]
+	db.totalDocLength = stats[6]
+
+	return db, nil
+}
+
+func (db *glassDatabase) parseRootInfo(data []byte) (*glassTable, []byte, error) {
+	values := make([]uint64, 5)
+
+	var err error
+
+	for i := range values {
+		if values[i], data, err = glassUnpackUint(data); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+	}
+
+	// Free list, not needed to read the database
+	freeListSize, data, err := glassUnpackUint(data)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	if uint64(len(data)) < freeListSize {
+		return nil, nil, errors.WithStack(io.ErrUnexpectedEOF)
+	}
+
+	data = data[freeListSize:]
+
+	if values[3] > glassMaxBlockSize>>11 {
+		return nil, nil, errors.Errorf("invalid block size '%d'", values[3])
+	}
+
+	blockSize := int(values[3] << 11)
+	if blockSize < glassMinBlockSize || blockSize&(blockSize-1) != 0 {
+		return nil, nil, errors.Errorf("invalid block size '%d'", blockSize)
+	}
+
+	if db.blockSize == 0 {
+		db.blockSize = blockSize
+	}
+
+	table := &glassTable{
+		db:          db,
+		root:        uint32(values[0]),
+		level:       int(values[1] >> 2),
+		empty:       values[1]&0x01 != 0,
+		entryCount:  values[2],
+		compressMin: values[4],
+	}
+
+	return table, data, nil
+}
+
+func (db *glassDatabase) readBlock(num uint32) ([]byte, error) {
+	block := make([]byte, db.blockSize)
+
+	if _, err := db.reader.ReadAt(block, int64(num)*int64(db.blockSize)); err != nil {
+		return nil, errors.Wrapf(err, "could not read block '%d'", num)
+	}
+
+	dirEnd := int(binary.BigEndian.Uint16(block[9:11]))
+	if dirEnd < glassBlockHeaderSize || dirEnd > len(block) || (dirEnd-glassBlockHeaderSize)%2 != 0 {
+		return nil, errors.Errorf("invalid directory end '%d' in block '%d'", dirEnd, num)
+	}
+
+	return block, nil
+}
+
+type glassBlock struct {
+	data  []byte
+	level int
+	count int
+}
+
+func (b *glassBlock) itemOffset(idx int) (int, error) {
+	if idx < 0 || idx >= b.count {
+		return 0, errors.Errorf("item index '%d' out of bounds", idx)
+	}
+
+	offset := int(binary.BigEndian.Uint16(b.data[glassBlockHeaderSize+2*idx:]))
+	if offset < glassBlockHeaderSize || offset >= len(b.data) {
+		return 0, errors.Errorf("invalid item offset '%d'", offset)
+	}
+
+	return offset, nil
+}
+
+// branch returns the key, component number and child block number of the
+// item at the given index of a branch block.
+func (b *glassBlock) branch(idx int) ([]byte, int, uint32, error) {
+	offset, err := b.itemOffset(idx)
+	if err != nil {
+		return nil, 0, 0, errors.WithStack(err)
+	}
+
+	if offset+5 > len(b.data) {
+		return nil, 0, 0, errors.WithStack(io.ErrUnexpectedEOF)
+	}
+
+	child := binary.BigEndian.Uint32(b.data[offset:])
+	keyLen := int(b.data[offset+4])
+	keyStart := offset + 5
+
+	if keyStart+keyLen+2 > len(b.data) {
+		return nil, 0, 0, errors.WithStack(io.ErrUnexpectedEOF)
+	}
+
+	key := b.data[keyStart : keyStart+keyLen]
+	component := int(binary.BigEndian.Uint16(b.data[keyStart+keyLen:]))
+
+	return key, component, child, nil
+}
+
+type glassItem struct {
+	key        []byte
+	component  int
+	first      bool
+	last       bool
+	compressed bool
+	tag        []byte
+}
+
+func (b *glassBlock) leaf(idx int) (*glassItem, error) {
+	offset, err := b.itemOffset(idx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if offset+3 > len(b.data) {
+		return nil, errors.WithStack(io.ErrUnexpectedEOF)
+	}
+
+	flags := b.data[offset]
+	size := int(binary.BigEndian.Uint16(b.data[offset:])&glassItemSizeMask) + 3
+	keyLen := int(b.data[offset+2])
+
+	end := offset + size
+	if end > len(b.data) || offset+3+keyLen > end {
+		return nil, errors.Errorf("invalid item size '%d'", size)
+	}
+
+	item := &glassItem{
+		key:        b.data[offset+3 : offset+3+keyLen],
+		component:  1,
+		first:      flags&glassItemFirstComponent != 0,
+		last:       flags&glassItemLastComponent != 0,
+		compressed: flags&glassItemCompressed != 0,
+	}
+
+	tagStart := offset + 3 + keyLen
+
+	if !item.first {
+		if tagStart+2 > end {
+			return nil, errors.WithStack(io.ErrUnexpectedEOF)
+		}
+
+		item.component = int(binary.BigEndian.Uint16(b.data[tagStart:]))
+		tagStart += 2
+	}
+
+	item.tag = b.data[tagStart:end]
+
+	return item, nil
+}
+
+func (b *glassBlock) key(idx int) ([]byte, int, error) {
+	if b.level > 0 {
+		key, component, _, err := b.branch(idx)
+		return key, component, err
+	}
+
+	item, err := b.leaf(idx)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	return item.key, item.component, nil
+}
+
+func (t *glassTable) block(num uint32) (*glassBlock, error) {
+	data, err := t.db.readBlock(num)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	dirEnd := int(binary.BigEndian.Uint16(data[9:11]))
+
+	return &glassBlock{
+		data:  data,
+		level: int(data[4]),
+		count: (dirEnd - glassBlockHeaderSize) / 2,
+	}, nil
+}
+
+// glassCursor iterates over the items of a table, in key order.
+type glassCursor struct {
+	table *glassTable
+	// blocks and positions hold the path from the root block to the
+	// current leaf block.
+	blocks    []*glassBlock
+	positions []int
+}
+
+func (t *glassTable) cursor() *glassCursor {
+	return &glassCursor{
+		table: t,
+	}
+}
+
+func compareGlassKeys(key1 []byte, component1 int, key2 []byte, component2 int) int {
+	if cmp := bytes.Compare(key1, key2); cmp != 0 {
+		return cmp
+	}
+
+	switch {
+	case component1 < component2:
+		return -1
+	case component1 > component2:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Seek moves the cursor to the first item with a key greater than or equal
+// to the given key. It returns false if there is no such item.
+func (c *glassCursor) Seek(key []byte) (bool, error) {
+	upper, err := c.descend(key)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if upper < 0 {
+		return false, nil
+	}
+
+	depth := len(c.blocks) - 1
+	block := c.blocks[depth]
+
+	pos := upper
+	if pos > 0 {
+		itemKey, component, err := block.key(pos - 1)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if compareGlassKeys(itemKey, component, key, 1) == 0 {
+			pos--
+		}
+	}
+
+	if pos >= block.count {
+		c.positions[depth] = block.count - 1
+		return c.Next()
+	}
+
+	c.positions[depth] = pos
+
+	return true, nil
+}
+
+// SeekFloor moves the cursor to the last item with a key lower than or
+// equal to the given key. It returns false if there is no such item.
+func (c *glassCursor) SeekFloor(key []byte) (bool, error) {
+	upper, err := c.descend(key)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if upper < 0 {
+		return false, nil
+	}
+
+	depth := len(c.blocks) - 1
+
+	if upper == 0 {
+		c.positions[depth] = 0
+		return c.Prev()
+	}
+
+	c.positions[depth] = upper - 1
+
+	return true, nil
+}
+
+// descend walks the tree from the root block to the leaf block which may
+// contain the given key, and returns the index of the first item of the
+// leaf greater than the key, or -1 if the table is empty.
+func (c *glassCursor) descend(key []byte) (int, error) {
+	c.blocks = c.blocks[:0]
+	c.positions = c.positions[:0]
+
+	if c.table.empty {
+		return -1, nil
+	}
+
+	num := c.table.root
+
+	for {
+		block, err := c.table.block(num)
+		if err != nil {
+			return -1, errors.WithStack(err)
+		}
+
+		var searchErr error
+
+		upper := sort.Search(block.count, func(i int) bool {
+			itemKey, component, err := block.key(i)
+			if err != nil {
+				searchErr = err
+				return true
+			}
+
+			return compareGlassKeys(itemKey, component, key, 1) > 0
+		})
+
+		if searchErr != nil {
+			return -1, errors.WithStack(searchErr)
+		}
+
+		// Each level is one below its parent, which protects against cycles
+		// in corrupted trees
+		if depth := len(c.blocks); depth > 0 && block.level != c.blocks[depth-1].level-1 {
+			return -1, errors.Errorf("invalid level '%d' of block '%d'", block.level, num)
+		}
+
+		c.blocks = append(c.blocks, block)
+
+		if block.level == 0 {
+			if block.count == 0 {
+				return -1, nil
+			}
+
+			c.positions = append(c.positions, upper)
+
+			return upper, nil
+		}
+
+		// The first item of a branch block has a null key, so the searched
+		// key is always greater than it.
+		pos := upper - 1
+		if pos < 0 {
+			pos = 0
+		}
+
+		c.positions = append(c.positions, pos)
+
+		_, _, child, err := block.branch(pos)
+		if err != nil {
+			return -1, errors.WithStack(err)
+		}
+
+		num = child
+	}
+}
+
+// Next moves the cursor to the next item. It returns false when the end of
+// the table is reached.
+func (c *glassCursor) Next() (bool, error) {
+	return c.move(1)
+}
+
+// Prev moves the cursor to the previous item. It returns false when the
+// beginning of the table is reached.
+func (c *glassCursor) Prev() (bool, error) {
+	return c.move(-1)
+}
+
+func (c *glassCursor) move(step int) (bool, error) {
+	if len(c.blocks) == 0 {
+		return false, nil
+	}
+
+	depth := len(c.blocks) - 1
+
+	// Go up until a block has a sibling item in the given direction
+	for {
+		c.positions[depth] += step
+
+		if c.positions[depth] >= 0 && c.positions[depth] < c.blocks[depth].count {
+			break
+		}
+
+		if depth == 0 {
+			c.positions[depth] -= step
+			return false, nil
+		}
+
+		depth--
+	}
+
+	// Then go down to the leaf level
+	for depth < len(c.blocks)-1 {
+		_, _, child, err := c.blocks[depth].branch(c.positions[depth])
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		block, err := c.table.block(child)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if block.level != c.blocks[depth].level-1 {
+			return false, errors.Errorf("invalid level '%d' of block '%d'", block.level, child)
+		}
+
+		depth++
+
+		c.blocks[depth] = block
+		if step > 0 {
+			c.positions[depth] = 0
+		} else {
+			c.positions[depth] = block.count - 1
+		}
+
+		if block.count == 0 {
+			return false, errors.New("unexpected empty block")
+		}
+	}
+
+	return true, nil
+}
+
+// Item returns the item under the cursor.
+func (c *glassCursor) Item() (*glassItem, error) {
+	depth := len(c.blocks) - 1
+	if depth < 0 {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	return c.blocks[depth].leaf(c.positions[depth])
+}
+
+// Tag returns the key of the item under the cursor and its full tag,
+// reassembling its components and decompressing it if needed. The cursor is
+// left on the last component of the item.
+func (c *glassCursor) Tag() ([]byte, []byte, error) {
+	item, err := c.Item()
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	key := append([]byte(nil), item.key...)
+	compressed := item.compressed
+	tag := append([]byte(nil), item.tag...)
+
+	for !item.last {
+		ok, err := c.Next()
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		if !ok {
+			return nil, nil, errors.Errorf("missing components for key '%x'", key)
+		}
+
+		if item, err = c.Item(); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		tag = append(tag, item.tag...)
+	}
+
+	if compressed {
+		decompressed, err := io.ReadAll(flate.NewReader(bytes.NewReader(tag)))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "could not decompress tag of key '%x'", key)
+		}
+
+		tag = decompressed
+	}
+
+	return key, tag, nil
+}
+
+// Get returns the tag associated with the given key, or ErrNotFound.
+func (t *glassTable) Get(key []byte) ([]byte, error) {
+	cursor := t.cursor()
+
+	ok, err := cursor.Seek(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !ok {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	itemKey, tag, err := cursor.Tag()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !bytes.Equal(itemKey, key) {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	return tag, nil
+}
+
+type glassPosting struct {
+	docID uint32
+	wdf   uint32
+}
+
+// glassTermKey returns the key of the first chunk of the posting list of the
+// given term.
+func glassTermKey(term string) []byte {
+	return []byte(glassPackStringPreservingSort(term, true))
+}
+
+// glassTermChunkKey returns the key of the chunk of the posting list of the
+// given term starting with the given document.
+func glassTermChunkKey(term string, docID uint32) []byte {
+	return []byte(glassPackStringPreservingSort(term, false) + glassPackUintPreservingSort(uint64(docID)))
+}
+
+// Postings returns the term frequency and the full posting list of the
+// given term. A zero term frequency is returned if the term does not exist.
+func (db *glassDatabase) Postings(term string) (uint64, []glassPosting, error) {
+	table := db.tables[glassTablePostList]
+	cursor := table.cursor()
+	firstKey := glassTermKey(term)
+
+	ok, err := cursor.Seek(firstKey)
+	if err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+
+	if !ok {
+		return 0, nil, nil
+	}
+
+	key, tag, err := cursor.Tag()
+	if err != nil {
+		return 0, nil, errors.WithStack(err)
+	}
+
+	if !bytes.Equal(key, firstKey) {
+		return 0, nil, nil
+	}
+
+	termFreq, firstDocID, tag, err := glassParseFirstChunkHeader(tag)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "could not parse posting list of term '%s'", term)
+	}
+
+	// The term frequency comes from the database, it is not trusted to
+	// preallocate the posting list
+	postings := make([]glassPosting, 0, min(termFreq, uint64(len(tag))))
+	chunkPrefix := []byte(glassPackStringPreservingSort(term, false))
+
+	for {
+		var last bool
+
+		postings, last, err = glassParseChunk(tag, firstDocID, postings)
+		if err != nil {
+			return 0, nil, errors.Wrapf(err, "could not parse posting list of term '%s'", term)
+		}
+
+		if last {
+			break
+		}
+
+		ok, err := cursor.Next()
+		if err != nil {
+			return 0, nil, errors.WithStack(err)
+		}
+
+		if !ok {
+			return 0, nil, errors.Errorf("missing posting list chunk for term '%s'", term)
+		}
+
+		if key, tag, err = cursor.Tag(); err != nil {
+			return 0, nil, errors.WithStack(err)
+		}
+
+		if !bytes.HasPrefix(key, chunkPrefix) {
+			return 0, nil, errors.Errorf("missing posting list chunk for term '%s'", term)
+		}
+
+		docID, _, err := glassUnpackUintPreservingSort(key[len(chunkPrefix):])
+		if err != nil {
+			return 0, nil, errors.WithStack(err)
+		}
+
+		firstDocID = uint32(docID)
+	}
+
+	return termFreq, postings, nil
+}
+
+// glassDocLengths looks up document lengths, keeping the last decoded chunk
+// of the document length list.
+type glassDocLengths struct {
+	db      *glassDatabase
+	first   uint32
+	last    uint32
+	lengths map[uint32]uint32
+}
+
+func (l *glassDocLengths) Get(docID uint32) (uint32, error) {
+	if l.lengths != nil && docID >= l.first && docID <= l.last {
+		return l.lengths[docID], nil
+	}
+
+	table := l.db.tables[glassTablePostList]
+	cursor := table.cursor()
+	chunkKey := []byte(glassDocLengthKey + glassPackUintPreservingSort(uint64(docID)))
+
+	// The chunk containing the document is the last one with a key lower
+	// or equal to the searched key.
+	ok, err := cursor.SeekFloor(chunkKey)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	if !ok {
+		return 0, errors.Wrapf(ErrNotFound, "no length for document '%d'", docID)
+	}
+
+	// Move to the first component of the item
+	for {
+		item, err := cursor.Item()
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		if item.first {
+			break
+		}
+
+		if ok, err := cursor.Prev(); err != nil || !ok {
+			return 0, errors.Errorf("missing first component of document length chunk")
+		}
+	}
+
+	key, tag, err := cursor.Tag()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	if !bytes.HasPrefix(key, []byte(glassDocLengthKey)) {
+		return 0, errors.Wrapf(ErrNotFound, "no length for document '%d'", docID)
+	}
+
+	var firstDocID uint32
+
+	if len(key) == len(glassDocLengthKey) {
+		if _, firstDocID, tag, err = glassParseFirstChunkHeader(tag); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	} else {
+		first, _, err := glassUnpackUintPreservingSort(key[len(glassDocLengthKey):])
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		firstDocID = uint32(first)
+	}
+
+	postings, _, err := glassParseChunk(tag, firstDocID, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not parse document length chunk")
+	}
+
+	if len(postings) == 0 {
+		return 0, errors.Wrapf(ErrNotFound, "no length for document '%d'", docID)
+	}
+
+	l.first = postings[0].docID
+	l.last = postings[len(postings)-1].docID
+	l.lengths = make(map[uint32]uint32, len(postings))
+
+	for _, p := range postings {
+		l.lengths[p.docID] = p.wdf
+	}
+
+	length, exists := l.lengths[docID]
+	if !exists {
+		return 0, errors.Wrapf(ErrNotFound, "no length for document '%d'", docID)
+	}
+
+	return length, nil
+}
+
+// Data returns the data associated with the given document.
+func (db *glassDatabase) Data(docID uint32) ([]byte, error) {
+	key := []byte(glassPackUintPreservingSort(uint64(docID)))
+
+	data, err := db.tables[glassTableDocData].Get(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read data of document '%d'", docID)
+	}
+
+	return data, nil
+}
+
+// HasPositions returns true if the database stores term positions.
+func (db *glassDatabase) HasPositions() bool {
+	return !db.tables[glassTablePosition].empty
+}
+
+// Positions returns the positions of the given term in the given document.
+func (db *glassDatabase) Positions(term string, docID uint32) ([]uint32, error) {
+	data, err := db.tables[glassTablePosition].Get(glassTermChunkKey(term, docID))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	return glassDecodePositions(data)
+}
+
+// glassDecodePositions decodes a position list, stored as its last position
+// followed by the interpolative coding of the other positions.
+func glassDecodePositions(data []byte) ([]uint32, error) {
+	last, data, err := glassUnpackUint(data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(data) == 0 {
+		return []uint32{uint32(last)}, nil
+	}
+
+	reader := &glassBitReader{data: data}
+
+	first := reader.decode(last)
+	size := reader.decode(last-first) + 2
+
+	if size > uint64(len(data))*8+2 {
+		return nil, errors.Errorf("invalid position list size '%d'", size)
+	}
+
+	positions := make([]uint32, size)
+	positions[0] = uint32(first)
+	positions[size-1] = uint32(last)
+
+	reader.decodeInterpolative(positions, 0, int(size-1))
+
+	if reader.overflow {
+		return nil, errors.WithStack(io.ErrUnexpectedEOF)
+	}
+
+	return positions, nil
+}
+
+type glassBitReader struct {
+	data     []byte
+	idx      int
+	acc      uint64
+	bits     int
+	overflow bool
+}
+
+func (r *glassBitReader) read(count int) uint64 {
+	if count == 0 {
+		return 0
+	}
+
+	for r.bits < count {
+		var b byte
+		if r.idx < len(r.data) {
+			b = r.data[r.idx]
+		} else {
+			r.overflow = true
+		}
+
+		r.idx++
+		r.acc |= uint64(b) << r.bits
+		r.bits += 8
+	}
+
+	value := r.acc & (1<<count - 1)
+	r.acc >>= count
+	r.bits -= count
+
+	return value
+}
+
+// decode reads a value in [0, outOf) encoded with the minimal number of
+// bits.
+func (r *glassBitReader) decode(outOf uint64) uint64 {
+	if outOf <= 1 {
+		return 0
+	}
+
+	size := bits.Len64(outOf - 1)
+	spare := (uint64(1) << size) - outOf
+
+	if spare == 0 {
+		return r.read(size)
+	}
+
+	midStart := (outOf - spare) / 2
+
+	value := r.read(size - 1)
+	if value < midStart && r.read(1) == 1 {
+		value += midStart + spare
+	}
+
+	return value
+}
+
+func (r *glassBitReader) decodeInterpolative(positions []uint32, j, k int) {
+	for j+1 < k {
+		mid := j + (k-j)/2
+		outOf := uint64(positions[k]) - uint64(positions[j]) + uint64(j) - uint64(k) + 1
+		lowest := uint64(positions[j]) + uint64(mid-j)
+
+		positions[mid] = uint32(r.decode(outOf) + lowest)
+
+		r.decodeInterpolative(positions, j, mid)
+
+		j = mid
+	}
+}
+
+// glassParseFirstChunkHeader parses the header of the first chunk of a
+// posting list and returns the term frequency, the first document ID and
+// the remaining chunk data.
+func glassParseFirstChunkHeader(data []byte) (uint64, uint32, []byte, error) {
+	termFreq, data, err := glassUnpackUint(data)
+	if err != nil {
+		return 0, 0, nil, errors.WithStack(err)
+	}
+
+	// Collection frequency
+	if _, data, err = glassUnpackUint(data); err != nil {
+		return 0, 0, nil, errors.WithStack(err)
+	}
+
+	firstDocID, data, err := glassUnpackUint(data)
+	if err != nil {
+		return 0, 0, nil, errors.WithStack(err)
+	}
+
+	return termFreq, uint32(firstDocID + 1), data, nil
+}
+
+// glassParseChunk parses a posting list chunk starting with the given
+// document and appends its postings. It returns true if the chunk is the
+// last one of the list.
+func glassParseChunk(data []byte, docID uint32, postings []glassPosting) ([]glassPosting, bool, error) {
+	if len(data) == 0 {
+		return nil, false, errors.WithStack(io.ErrUnexpectedEOF)
+	}
+
+	last := data[0] == '1'
+
+	// Last document ID of the chunk, relative to the first one
+	_, data, err := glassUnpackUint(data[1:])
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	wdf, data, err := glassUnpackUint(data)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	postings = append(postings, glassPosting{docID: docID, wdf: uint32(wdf)})
+
+	for len(data) > 0 {
+		var increment uint64
+
+		if increment, data, err = glassUnpackUint(data); err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+
+		if wdf, data, err = glassUnpackUint(data); err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+
+		docID += uint32(increment + 1)
+		postings = append(postings, glassPosting{docID: docID, wdf: uint32(wdf)})
+	}
+
+	return postings, last, nil
+}
+
+func glassUnpackUint(data []byte) (uint64, []byte, error) {
+	var (
+		value uint64
+		shift uint
+	)
+
+	for i, b := range data {
+		if shift > 63 {
+			return 0, nil, errors.New("integer overflow")
+		}
+
+		value |= uint64(b&0x7f) << shift
+
+		if b < 0x80 {
+			return value, data[i+1:], nil
+		}
+
+		shift += 7
+	}
+
+	return 0, nil, errors.WithStack(io.ErrUnexpectedEOF)
+}
+
+// glassPackStringPreservingSort encodes a string so that the encoded keys
+// sort in the same order as the strings. Null bytes are escaped and, unless
+// the string is the last part of the key, a null terminator is appended.
+func glassPackStringPreservingSort(value string, last bool) string {
+	var b bytes.Buffer
+
+	for i := 0; i < len(value); i++ {
+		b.WriteByte(value[i])
+
+		if value[i] == 0 {
+			b.WriteByte(0xff)
+		}
+	}
+
+	if !last {
+		b.WriteByte(0)
+	}
+
+	return b.String()
+}
+
+// glassPackUintPreservingSort encodes an integer so that the encoded keys
+// sort in the same order as the integers: the 3 high bits of the first byte
+// hold the number of following bytes, the remaining bits and the following
+// bytes hold the integer in big endian order.
+func glassPackUintPreservingSort(value uint64) string {
+	buf := make([]byte, 0, 9)
+
+	for {
+		buf = append(buf, byte(value))
+		value >>= 8
+
+		if value&^0x1f == 0 {
+			break
+		}
+	}
+
+	buf = append(buf, byte((len(buf)-1)<<5)|byte(value))
+
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+
+	return string(buf)
+}
+
+func glassUnpackUintPreservingSort(data []byte) (uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, errors.WithStack(io.ErrUnexpectedEOF)
+	}
+
+	size := int(data[0]>>5) + 1
+	if len(data) < size+1 {
+		return 0, nil, errors.WithStack(io.ErrUnexpectedEOF)
+	}
+
+	value := uint64(data[0] & 0x1f)
+	for _, b := range data[1 : size+1] {
+		value = value<<8 | uint64(b)
+	}
+
+	return value, data[size+1:], nil
+}
@@ -1,32 +1,26 @@
 package zim
 
 import (
-	"bytes"
 	"io"
 
 	"github.com/pkg/errors"
 	"github.com/ulikunitz/xz"
 )
 
-func NewXZBlobReader(reader *Reader, clusterStartOffset, clusterEndOffset uint64, blobIndex uint32, blobSize int) *CompressedBlobReader {
-	return NewCompressedBlobReader(
-		reader,
-		func(r io.Reader) (io.ReadSeekCloser, error) {
-			decoder, err := xz.NewReader(r)
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+func init() {
+	RegisterDecoder(CompressionXZ, XZDecoder)
+}
 
-			buff, err := io.ReadAll(decoder)
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+// XZDecoder is the default ClusterDecoderFactory for XZ compressed clusters.
+func XZDecoder(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := xz.NewReader(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
 
-			return &NoopReadSeekCloser{bytes.NewReader(buff)}, nil
-		},
-		clusterStartOffset,
-		clusterEndOffset,
-		blobIndex,
-		blobSize,
-	)
+	return io.NopCloser(decoder), nil
+}
+
+func NewXZBlobReader(reader *Reader, clusterStartOffset, clusterEndOffset uint64, blobIndex uint32, blobSize int) *CompressedBlobReader {
+	return newCompressedBlobReader(reader, XZDecoder, clusterStartOffset, clusterEndOffset, blobIndex, blobSize)
 }
@@ -0,0 +1,26 @@
+package zim
+
+import (
+	"compress/zlib"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	RegisterDecoder(CompressionZLib, ZLibDecoder)
+}
+
+// ZLibDecoder is the default ClusterDecoderFactory for zlib compressed clusters.
+func ZLibDecoder(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return decoder, nil
+}
+
+func NewZLibBlobReader(reader *Reader, clusterStartOffset, clusterEndOffset uint64, blobIndex uint32, blobSize int) *CompressedBlobReader {
+	return newCompressedBlobReader(reader, ZLibDecoder, clusterStartOffset, clusterEndOffset, blobIndex, blobSize)
+}
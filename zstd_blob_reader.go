@@ -1,32 +1,29 @@
 package zim
 
 import (
-	"bytes"
 	"io"
 
 	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
 )
 
-func NewZStdBlobReader(reader *Reader, clusterStartOffset, clusterEndOffset uint64, blobIndex uint32, blobSize int) *CompressedBlobReader {
-	return NewCompressedBlobReader(
-		reader,
-		func(r io.Reader) (io.ReadSeekCloser, error) {
-			decoder, err := zstd.NewReader(r)
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+func init() {
+	RegisterDecoder(CompressionZStandard, ZStdDecoder)
+}
 
-			buff, err := io.ReadAll(decoder)
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+// ZStdDecoder is the default ClusterDecoderFactory for Zstandard compressed
+// clusters.
+func ZStdDecoder(r io.Reader) (io.ReadCloser, error) {
+	// Decoding synchronously avoids leaking decoder goroutines
+	// when a blob reader is not closed
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
 
-			return &NoopReadSeekCloser{bytes.NewReader(buff)}, nil
-		},
-		clusterStartOffset,
-		clusterEndOffset,
-		blobIndex,
-		blobSize,
-	)
+	return decoder.IOReadCloser(), nil
+}
+
+func NewZStdBlobReader(reader *Reader, clusterStartOffset, clusterEndOffset uint64, blobIndex uint32, blobSize int) *CompressedBlobReader {
+	return newCompressedBlobReader(reader, ZStdDecoder, clusterStartOffset, clusterEndOffset, blobIndex, blobSize)
 }